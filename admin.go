@@ -0,0 +1,152 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync/atomic"
+)
+
+// Admin settings, populated from the environment in main
+var (
+	adminEnabled bool
+	adminKey     string
+)
+
+// adminOnly guards an admin handler. Admin routes are hidden unless
+// ADMIN_ENABLED is set, and require a matching X-Admin-Key when ADMIN_KEY is set.
+func adminOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !adminEnabled {
+			jsonError(w, `{"error": "Not found"}`, http.StatusNotFound)
+			return
+		}
+		if adminKey != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Admin-Key")), []byte(adminKey)) != 1 {
+			jsonError(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+type FlushResponse struct {
+	URLsRemoved   int `json:"urlsRemoved"`
+	ClicksRemoved int `json:"clicksRemoved"`
+}
+
+func flushStore(w http.ResponseWriter, r *http.Request) {
+	storeLock.Lock()
+	response := FlushResponse{URLsRemoved: len(urlStore)}
+	for _, count := range clickCounts {
+		response.ClicksRemoved += int(count.Load())
+	}
+	urlStore = make(map[string]ShortURL)
+	analytics = make(map[string]*clickLog)
+	clickCounts = make(map[string]*atomic.Int64)
+	botClickCounts = make(map[string]*atomic.Int64)
+	rollups = make(map[string][]DailyStat)
+	tombstones = make(map[string]string)
+	storeLock.Unlock()
+	redirectCache.Purge()
+
+	w.Header().Set("Content-Type", "application/json")
+	newJSONEncoder(w, r).Encode(response)
+}
+
+type MaintenanceRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+// setMaintenance turns maintenance mode on or off
+func setMaintenance(w http.ResponseWriter, r *http.Request) {
+	var req MaintenanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	maintenanceMode.Store(req.Enabled)
+
+	w.Header().Set("Content-Type", "application/json")
+	newJSONEncoder(w, r).Encode(req)
+}
+
+// analyticsPaused stops redirects from recording clicks or counting towards
+// click totals, e.g. while a load test runs against production links
+var analyticsPaused atomic.Bool
+
+type AnalyticsPauseRequest struct {
+	Paused bool `json:"paused"`
+}
+
+// setAnalyticsPaused pauses or resumes click recording
+func setAnalyticsPaused(w http.ResponseWriter, r *http.Request) {
+	var req AnalyticsPauseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	analyticsPaused.Store(req.Paused)
+
+	w.Header().Set("Content-Type", "application/json")
+	newJSONEncoder(w, r).Encode(req)
+}
+
+// maxDumpPage caps how many records one /admin/dump page may return
+const maxDumpPage = 1000
+
+type DumpEntry struct {
+	ShortURL
+	Clicks int `json:"clicks"`
+}
+
+type DumpResponse struct {
+	Total  int         `json:"total"`
+	Offset int         `json:"offset"`
+	Limit  int         `json:"limit"`
+	URLs   []DumpEntry `json:"urls"`
+}
+
+// dumpStore returns a page of raw store records, ordered by shortcode, with
+// their click counts. ?limit= defaults to 100 and is capped at maxDumpPage.
+func dumpStore(w http.ResponseWriter, r *http.Request) {
+	limit, offset := 100, 0
+	query := r.URL.Query()
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			jsonError(w, `{"error": "limit must be a non-negative integer"}`, http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxDumpPage)
+	}
+	if v := query.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			jsonError(w, `{"error": "offset must be a non-negative integer"}`, http.StatusBadRequest)
+			return
+		}
+		offset = n
+	}
+
+	storeLock.RLock()
+	codes := make([]string, 0, len(urlStore))
+	for code := range urlStore {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	response := DumpResponse{Total: len(codes), Offset: offset, Limit: limit, URLs: []DumpEntry{}}
+	if offset < len(codes) {
+		for _, code := range codes[offset:min(offset+limit, len(codes))] {
+			response.URLs = append(response.URLs, DumpEntry{
+				ShortURL: urlStore[code],
+				Clicks:   clickTotal(code),
+			})
+		}
+	}
+	storeLock.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	newJSONEncoder(w, r).Encode(response)
+}
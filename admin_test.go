@@ -0,0 +1,129 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestFlushDisabled(t *testing.T) {
+	resetStore(t)
+	set(t, &adminEnabled, false)
+	url := mustCreate(t, ShortURLRequest{URL: "https://example.com"})
+
+	wantStatus(t, do("POST", "/admin/flush", ""), http.StatusNotFound)
+	wantStatus(t, do("GET", "/"+url.ShortCode, ""), http.StatusFound)
+}
+
+func TestFlushEnabled(t *testing.T) {
+	resetStore(t)
+	set(t, &adminEnabled, true)
+	first := mustCreate(t, ShortURLRequest{URL: "https://example.com"})
+	mustCreate(t, ShortURLRequest{URL: "https://example.org", Shortcode: "second"})
+	wantStatus(t, do("GET", "/"+first.ShortCode, ""), http.StatusFound)
+	wantStatus(t, do("GET", "/"+first.ShortCode, ""), http.StatusFound)
+
+	rec := do("POST", "/admin/flush", "")
+	wantStatus(t, rec, http.StatusOK)
+	var response FlushResponse
+	decode(t, rec, &response)
+	if response.URLsRemoved != 2 || response.ClicksRemoved != 2 {
+		t.Errorf("response = %+v, want 2 URLs and 2 clicks", response)
+	}
+	wantStatus(t, do("GET", "/"+first.ShortCode, ""), http.StatusNotFound)
+}
+
+func TestFlushRequiresAdminKey(t *testing.T) {
+	resetStore(t)
+	set(t, &adminEnabled, true)
+	set(t, &adminKey, "s3cret")
+
+	wantStatus(t, do("POST", "/admin/flush", ""), http.StatusUnauthorized)
+
+	r := request("POST", "/admin/flush", "")
+	r.Header.Set("X-Admin-Key", "s3cret")
+	wantStatus(t, serve(r), http.StatusOK)
+}
+
+func TestDumpStore(t *testing.T) {
+	resetStore(t)
+	for _, code := range []string{"c", "a", "b"} {
+		mustCreate(t, ShortURLRequest{URL: "https://example.com/" + code, Shortcode: code})
+	}
+	wantStatus(t, do("GET", "/b", ""), http.StatusFound)
+
+	wantStatus(t, do("GET", "/admin/dump", ""), http.StatusNotFound)
+
+	set(t, &adminEnabled, true)
+	set(t, &adminKey, "s3cret")
+	wantStatus(t, do("GET", "/admin/dump", ""), http.StatusUnauthorized)
+
+	r := request("GET", "/admin/dump?limit=2&offset=1", "")
+	r.Header.Set("X-Admin-Key", "s3cret")
+	rec := serve(r)
+	wantStatus(t, rec, http.StatusOK)
+	var response DumpResponse
+	decode(t, rec, &response)
+	if response.Total != 3 || len(response.URLs) != 2 {
+		t.Fatalf("response = %+v", response)
+	}
+	if response.URLs[0].ShortCode != "b" || response.URLs[0].Clicks != 1 || response.URLs[1].ShortCode != "c" {
+		t.Errorf("page = %+v, want b with 1 click then c", response.URLs)
+	}
+}
+
+func TestDumpStorePaging(t *testing.T) {
+	resetStore(t)
+	set(t, &adminEnabled, true)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com"})
+
+	rec := do("GET", "/admin/dump?limit=100000", "")
+	var response DumpResponse
+	decode(t, rec, &response)
+	if response.Limit != maxDumpPage {
+		t.Errorf("limit = %d, want capped at %d", response.Limit, maxDumpPage)
+	}
+	rec = do("GET", "/admin/dump?offset=5", "")
+	wantStatus(t, rec, http.StatusOK)
+	decode(t, rec, &response)
+	if response.URLs == nil || len(response.URLs) != 0 {
+		t.Errorf("offset past the end gives %v, want an empty page", response.URLs)
+	}
+	wantStatus(t, do("GET", "/admin/dump?limit=-1", ""), http.StatusBadRequest)
+	wantStatus(t, do("GET", "/admin/dump?offset=x", ""), http.StatusBadRequest)
+}
+
+func TestPauseAnalytics(t *testing.T) {
+	resetStore(t)
+	set(t, &adminEnabled, true)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "load"})
+	wantStatus(t, do("GET", "/load", ""), http.StatusFound)
+
+	rec := do("POST", "/admin/analytics", `{"paused": true}`)
+	wantStatus(t, rec, http.StatusOK)
+	if !analyticsPaused.Load() {
+		t.Fatal("analytics not paused")
+	}
+	for i := 0; i < 5; i++ {
+		wantStatus(t, do("GET", "/load", ""), http.StatusFound)
+	}
+	stats, _ := GetStats("load", clickPage{limit: 10})
+	if stats.TotalClicks != 1 || len(stats.ClickDetails) != 1 {
+		t.Errorf("%d clicks with %d details while paused, want the 1 from before", stats.TotalClicks, len(stats.ClickDetails))
+	}
+
+	wantStatus(t, do("POST", "/admin/analytics", `{"paused": false}`), http.StatusOK)
+	wantStatus(t, do("GET", "/load", ""), http.StatusFound)
+	if stats, _ := GetStats("load", clickPage{}); stats.TotalClicks != 2 {
+		t.Errorf("TotalClicks = %d after resuming, want 2", stats.TotalClicks)
+	}
+	wantStatus(t, do("POST", "/admin/analytics", `{`), http.StatusBadRequest)
+}
+
+func TestPauseAnalyticsRequiresAdmin(t *testing.T) {
+	resetStore(t)
+	set(t, &adminEnabled, false)
+	wantStatus(t, do("POST", "/admin/analytics", `{"paused": true}`), http.StatusNotFound)
+	if analyticsPaused.Load() {
+		t.Error("analytics paused without admin access")
+	}
+}
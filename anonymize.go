@@ -0,0 +1,41 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+)
+
+// IP anonymization settings, populated from the environment in main.
+// ipAnonymization is "none", "truncate" or "hash".
+var (
+	ipAnonymization = "none"
+	ipHashSalt      []byte
+)
+
+// anonymizeIP applies the configured anonymization to ip before it is stored
+func anonymizeIP(ip string) string {
+	switch ipAnonymization {
+	case "truncate":
+		return truncateIP(ip)
+	case "hash":
+		h := hmac.New(sha256.New, ipHashSalt)
+		h.Write([]byte(ip))
+		return hex.EncodeToString(h.Sum(nil))
+	}
+	return ip
+}
+
+// truncateIP zeroes the host part of an address: the last octet of IPv4
+// addresses and everything after the /48 prefix of IPv6 ones
+func truncateIP(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return parsed.Mask(net.CIDRMask(48, 128)).String()
+}
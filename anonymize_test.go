@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestHashAnonymizationNeedsSalt(t *testing.T) {
+	if os.Getenv("TEST_LOAD_CONFIG") != "" {
+		log.SetOutput(os.Stderr)
+		loadConfig()
+		return
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHashAnonymizationNeedsSalt$")
+	cmd.Env = append(os.Environ(), "TEST_LOAD_CONFIG=1", "IP_ANONYMIZATION=hash", "IP_HASH_SALT=")
+	out, err := cmd.CombinedOutput()
+	if err == nil || !bytes.Contains(out, []byte("IP_ANONYMIZATION=hash requires IP_HASH_SALT")) {
+		t.Errorf("hashing without a salt accepted: %v\n%s", err, out)
+	}
+}
+
+func TestAnonymizeIP(t *testing.T) {
+	set(t, &ipAnonymization, "truncate")
+	tests := map[string]string{
+		"203.0.113.77":             "203.0.113.0",
+		"2001:db8:abcd:12:1:2:3:4": "2001:db8:abcd::",
+		"::ffff:203.0.113.77":      "203.0.113.0",
+		"not-an-ip":                "",
+	}
+	for ip, want := range tests {
+		if got := anonymizeIP(ip); got != want {
+			t.Errorf("truncate %q = %q, want %q", ip, got, want)
+		}
+	}
+
+	set(t, &ipAnonymization, "hash")
+	set(t, &ipHashSalt, []byte("salt"))
+	first, again := anonymizeIP("203.0.113.77"), anonymizeIP("203.0.113.77")
+	if first != again || len(first) != 64 || first == anonymizeIP("203.0.113.78") {
+		t.Errorf("hash gives %q then %q", first, again)
+	}
+	set(t, &ipHashSalt, []byte("pepper"))
+	if anonymizeIP("203.0.113.77") == first {
+		t.Error("hash ignores the salt")
+	}
+
+	set(t, &ipAnonymization, "none")
+	if got := anonymizeIP("203.0.113.77"); got != "203.0.113.77" {
+		t.Errorf("none = %q", got)
+	}
+}
+
+func TestRedirectStoresAnonymizedIP(t *testing.T) {
+	resetStore(t)
+	set(t, &ipAnonymization, "truncate")
+	set(t, &adminEnabled, true)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "anon"})
+
+	r := request("GET", "/anon", "")
+	r.RemoteAddr = "198.51.100.23:4000"
+	wantStatus(t, serve(r), http.StatusFound)
+	wantStatus(t, do("POST", "/shorturls/anon/clicks/import",
+		`[{"timestamp": "2024-01-01T00:00:00Z", "ipAddress": "198.51.100.99"}]`), http.StatusOK)
+
+	stats := getStats(t, "anon")
+	if len(stats.ClickDetails) != 2 {
+		t.Fatalf("%d clicks stored, want 2", len(stats.ClickDetails))
+	}
+	for _, click := range stats.ClickDetails {
+		if click.IPAddress != "198.51.100.0" {
+			t.Errorf("stored IP %q, want 198.51.100.0", click.IPAddress)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Audit sink settings, populated from the environment in main. Audited links
+// log nothing unless AUDIT_LOG_FILE or AUDIT_WEBHOOK_URL is set.
+var (
+	auditLogFile        string
+	auditWebhookURL     string
+	auditQueueSize      = 1000
+	auditWebhookTimeout = 5 * time.Second
+)
+
+// auditQueue feeds the audit sink; nil when no sink is configured
+var auditQueue chan AuditEntry
+
+// auditClosed is set once the queue is closed. Handlers still running after
+// a shutdown timeout drop their entries instead of sending on it.
+var (
+	auditMu     sync.RWMutex
+	auditClosed bool
+)
+
+// auditDone is closed once the sink has written everything queued
+var auditDone chan struct{}
+
+// auditsDropped counts entries lost because the queue was full or closed
+var auditsDropped atomic.Int64
+
+// auditSchemaVersion is the version of the AuditEntry format, bumped like
+// clickSchemaVersion when fields change
+const auditSchemaVersion = 1
+
+// AuditEntry records one access to an audited link
+type AuditEntry struct {
+	SchemaVersion int       `json:"schemaVersion"`
+	Timestamp     time.Time `json:"timestamp"`
+	ShortCode     string    `json:"shortCode"`
+	IPAddress     string    `json:"ipAddress"`
+	UserAgent     string    `json:"userAgent"`
+	Referrer      string    `json:"referrer"`
+	// Result is "redirected", "throttled" or the code of the error returned
+	Result      string `json:"result"`
+	Destination string `json:"destination,omitempty"`
+}
+
+// startAuditSink opens the configured sink and starts writing queued entries
+// to it in the background
+func startAuditSink() {
+	var write func(AuditEntry) error
+	switch {
+	case auditLogFile != "":
+		file, err := os.OpenFile(auditLogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			log.Fatalf("Invalid AUDIT_LOG_FILE: %v", err)
+		}
+		enc := json.NewEncoder(file)
+		write = func(entry AuditEntry) error { return enc.Encode(entry) }
+	case auditWebhookURL != "":
+		write = postAuditEntry
+	default:
+		return
+	}
+
+	auditQueue = make(chan AuditEntry, auditQueueSize)
+	auditDone = make(chan struct{})
+	go func() {
+		defer close(auditDone)
+		for entry := range auditQueue {
+			if err := write(entry); err != nil {
+				log.Printf("Writing audit entry for %s: %v", entry.ShortCode, err)
+			}
+		}
+	}()
+}
+
+// stopAuditSink closes the queue and waits for the entries already queued to
+// be written. Entries audited afterwards are dropped.
+func stopAuditSink() {
+	if auditQueue == nil {
+		return
+	}
+	auditMu.Lock()
+	auditClosed = true
+	close(auditQueue)
+	auditMu.Unlock()
+	<-auditDone
+}
+
+// postAuditEntry sends entry to AUDIT_WEBHOOK_URL as JSON
+func postAuditEntry(entry AuditEntry) error {
+	body, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), auditWebhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, auditWebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// auditRedirect queues an audit entry for a request to shortCode without
+// waiting on the sink; entries are dropped when the queue is full
+func auditRedirect(r *http.Request, shortCode, result, destination string) {
+	if auditQueue == nil {
+		return
+	}
+	entry := AuditEntry{
+		SchemaVersion: auditSchemaVersion,
+		Timestamp:     time.Now(),
+		ShortCode:     shortCode,
+		IPAddress:     anonymizeIP(clientIP(r)),
+		UserAgent:     r.UserAgent(),
+		Referrer:      r.Referer(),
+		Result:        result,
+		Destination:   destination,
+	}
+	auditMu.RLock()
+	defer auditMu.RUnlock()
+	if auditClosed {
+		auditsDropped.Add(1)
+		return
+	}
+	select {
+	case auditQueue <- entry:
+	default:
+		auditsDropped.Add(1)
+	}
+}
+
+// auditFailure audits a refused request to shortCode if the link is audited.
+// The refusal means the link itself was not resolved, so it is looked up.
+func auditFailure(r *http.Request, shortCode string, err error) {
+	if auditQueue == nil {
+		return
+	}
+	storeLock.RLock()
+	audited := urlStore[shortCode].Audited
+	storeLock.RUnlock()
+	if audited {
+		_, code := errorStatus(err)
+		auditRedirect(r, shortCode, code, "")
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// useAuditSink starts the audit sink the settings describe, stopping it when
+// the test ends unless the test already has
+func useAuditSink(t *testing.T, file, webhook string, queueSize int) {
+	t.Helper()
+	set(t, &auditLogFile, file)
+	set(t, &auditWebhookURL, webhook)
+	set(t, &auditQueueSize, queueSize)
+	set(t, &auditQueue, nil)
+	set(t, &auditDone, nil)
+	set(t, &auditClosed, false)
+	startAuditSink()
+	t.Cleanup(func() {
+		if !auditClosed {
+			stopAuditSink()
+		}
+	})
+}
+
+// readAuditLog decodes the entries of an audit log file
+func readAuditLog(t *testing.T, path string) []AuditEntry {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("audit line %q: %v", scanner.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestAuditLogFile(t *testing.T) {
+	resetStore(t)
+	path := filepath.Join(t.TempDir(), "audit.log")
+	useAuditSink(t, path, "", 100)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com/watched", Shortcode: "watched", Audited: true, RedirectRateLimit: 1})
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "plain"})
+
+	r := request("GET", "/watched", "")
+	r.RemoteAddr = "198.51.100.23:4000"
+	r.Header.Set("Referer", "https://news.example/")
+	wantStatus(t, serve(r), http.StatusFound)
+	wantStatus(t, do("GET", "/watched", ""), http.StatusTooManyRequests)
+	wantStatus(t, do("GET", "/plain", ""), http.StatusFound)
+	expireLink(t, "watched")
+	wantStatus(t, do("GET", "/watched", ""), http.StatusGone)
+	stopAuditSink()
+
+	entries := readAuditLog(t, path)
+	if len(entries) != 3 {
+		t.Fatalf("%d audit entries, want 3: %+v", len(entries), entries)
+	}
+	first := entries[0]
+	if first.SchemaVersion != auditSchemaVersion || first.ShortCode != "watched" || first.Result != "redirected" ||
+		first.Destination != "https://example.com/watched" || first.IPAddress != "198.51.100.23" ||
+		first.UserAgent != browserUserAgent || first.Referrer != "https://news.example/" ||
+		time.Since(first.Timestamp) > time.Minute {
+		t.Errorf("redirect audited as %+v", first)
+	}
+	for i, want := range []string{"redirected", "throttled", "expired"} {
+		if entries[i].Result != want || entries[i].ShortCode != "watched" {
+			t.Errorf("entry %d = %s for %s, want %s for watched", i, entries[i].Result, entries[i].ShortCode, want)
+		}
+	}
+
+	// Audit entries come on top of the usual analytics
+	if stats, _ := GetStats("watched", clickPage{}); stats.TotalClicks != 1 {
+		t.Errorf("total = %d, want 1", stats.TotalClicks)
+	}
+}
+
+func TestAuditWebhook(t *testing.T) {
+	resetStore(t)
+	received := make(chan AuditEntry, 10)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var entry AuditEntry
+		if r.Header.Get("Content-Type") != "application/json" || json.NewDecoder(r.Body).Decode(&entry) != nil {
+			t.Errorf("webhook sent %s %q", r.Method, r.Header.Get("Content-Type"))
+		}
+		received <- entry
+	}))
+	defer hook.Close()
+	useAuditSink(t, "", hook.URL, 100)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "watched", Audited: true})
+
+	wantStatus(t, do("GET", "/watched", ""), http.StatusFound)
+	select {
+	case entry := <-received:
+		if entry.ShortCode != "watched" || entry.Result != "redirected" || entry.SchemaVersion != auditSchemaVersion {
+			t.Errorf("webhook got %+v", entry)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no audit entry posted")
+	}
+}
+
+func TestAuditDoesNotBlockRedirects(t *testing.T) {
+	resetStore(t)
+	release := make(chan struct{})
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		<-release
+	}))
+	defer hook.Close()
+	defer close(release)
+	useAuditSink(t, "", hook.URL, 1)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "watched", Audited: true})
+	dropped := auditsDropped.Load()
+
+	// The sink is stuck on the first entry and the queue holds one more, so
+	// the rest are dropped rather than held up
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 10; i++ {
+			if rec := do("GET", "/watched", ""); rec.Code != http.StatusFound {
+				t.Errorf("redirect %d status = %d", i+1, rec.Code)
+			}
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("redirects waited on the audit sink")
+	}
+	if n := auditsDropped.Load() - dropped; n < 8 {
+		t.Errorf("%d audit entries dropped, want at least 8", n)
+	}
+}
+
+func TestAuditAfterStop(t *testing.T) {
+	resetStore(t)
+	useAuditSink(t, filepath.Join(t.TempDir(), "audit.log"), "", 100)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "watched", Audited: true})
+	stopAuditSink()
+	dropped := auditsDropped.Load()
+
+	// A handler outliving the shutdown drops its entry instead of sending on
+	// the closed queue
+	wantStatus(t, do("GET", "/watched", ""), http.StatusFound)
+	if auditsDropped.Load()-dropped != 1 {
+		t.Error("entry after stop not counted as dropped")
+	}
+}
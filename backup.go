@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// exportVersion is the format version written by /admin/export. Imports
+// accept this version and older ones.
+const exportVersion = 1
+
+// ExportDocument is a full backup of the store
+type ExportDocument struct {
+	Version    int               `json:"version"`
+	ExportedAt time.Time         `json:"exportedAt"`
+	URLs       []ExportEntry     `json:"urls"`
+	Tombstones map[string]string `json:"tombstones,omitempty"`
+	// RetiredCodes are rotated-out codes that must not be generated again
+	RetiredCodes []string `json:"retiredCodes,omitempty"`
+	// CodeSequence is the last value of the sequential generator
+	CodeSequence uint64 `json:"codeSequence,omitempty"`
+}
+
+// ExportEntry is one link with its click details and total
+type ExportEntry struct {
+	ShortURL
+	Clicks      []Click     `json:"clicks"`
+	TotalClicks int         `json:"totalClicks"`
+	BotClicks   int         `json:"botClicks,omitempty"`
+	Rollups     []DailyStat `json:"rollups,omitempty"`
+}
+
+// exportStore returns every link, its analytics and the rotation tombstones
+// as a single document
+func exportStore(w http.ResponseWriter, r *http.Request) {
+	doc := ExportDocument{
+		Version:      exportVersion,
+		ExportedAt:   time.Now(),
+		URLs:         []ExportEntry{},
+		CodeSequence: codeSequence.Load(),
+	}
+
+	storeLock.RLock()
+	for code, url := range urlStore {
+		doc.URLs = append(doc.URLs, ExportEntry{
+			ShortURL:    url,
+			Clicks:      analytics[code].Slice(),
+			TotalClicks: clickTotal(code),
+			BotClicks:   botTotal(code),
+			Rollups:     rollups[code],
+		})
+	}
+	if len(tombstones) > 0 {
+		doc.Tombstones = make(map[string]string, len(tombstones))
+		for code, target := range tombstones {
+			doc.Tombstones[code] = target
+		}
+	}
+	for code := range retiredCodes {
+		doc.RetiredCodes = append(doc.RetiredCodes, code)
+	}
+	storeLock.RUnlock()
+
+	sort.Strings(doc.RetiredCodes)
+	sort.Slice(doc.URLs, func(i, j int) bool { return doc.URLs[i].ShortCode < doc.URLs[j].ShortCode })
+	w.Header().Set("Content-Type", "application/json")
+	newJSONEncoder(w, r).Encode(doc)
+}
+
+type ImportResponse struct {
+	Imported int `json:"imported"`
+	Skipped  int `json:"skipped"`
+}
+
+// importStore restores a document written by exportStore. ?mode=replace
+// discards the current store first; the default, merge, keeps existing links
+// and skips imported ones whose code is already taken.
+func importStore(w http.ResponseWriter, r *http.Request) {
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = "merge"
+	}
+	if mode != "merge" && mode != "replace" {
+		jsonError(w, `{"error": "mode must be merge or replace"}`, http.StatusBadRequest)
+		return
+	}
+
+	var doc ExportDocument
+	if err := json.NewDecoder(r.Body).Decode(&doc); err != nil {
+		jsonError(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	// Documents from before versioning carry no version and share the
+	// version 1 layout
+	if doc.Version > exportVersion {
+		jsonError(w, fmt.Sprintf(`{"error": "Unsupported export version %d, expected at most %d"}`,
+			doc.Version, exportVersion), http.StatusBadRequest)
+		return
+	}
+	for i, entry := range doc.URLs {
+		if entry.ShortCode == "" {
+			jsonError(w, fmt.Sprintf(`{"error": "URL %d is missing a shortCode"}`, i), http.StatusBadRequest)
+			return
+		}
+		if err := checkStoredSchemes(entry.ShortURL); err != nil {
+			body, _ := json.Marshal(map[string]string{"error": fmt.Sprintf("URL %d: %v", i, err)})
+			jsonError(w, string(body), http.StatusBadRequest)
+			return
+		}
+		// Link groups exported before weighted destinations carry no weights
+		// and split traffic evenly
+		for j, dest := range entry.Destinations {
+			switch {
+			case dest.Weight < 0:
+				jsonError(w, fmt.Sprintf(`{"error": "URL %d: Destination weights must be positive"}`, i), http.StatusBadRequest)
+				return
+			case dest.Weight == 0:
+				entry.Destinations[j].Weight = 1
+			}
+		}
+	}
+
+	var response ImportResponse
+	storeLock.Lock()
+	if mode == "replace" {
+		urlStore = make(map[string]ShortURL)
+		analytics = make(map[string]*clickLog)
+		clickCounts = make(map[string]*atomic.Int64)
+		botClickCounts = make(map[string]*atomic.Int64)
+		rollups = make(map[string][]DailyStat)
+		tombstones = make(map[string]string)
+	}
+	for _, entry := range doc.URLs {
+		code := entry.ShortCode
+		if _, exists := urlStore[code]; exists {
+			response.Skipped++
+			continue
+		}
+		clicks := append([]Click{}, entry.Clicks...)
+		sort.SliceStable(clicks, func(i, j int) bool { return clicks[i].Timestamp.Before(clicks[j].Timestamp) })
+		urlStore[code] = entry.ShortURL
+		analytics[code] = newClickLog(clicks)
+		counter := new(atomic.Int64)
+		counter.Store(int64(max(entry.TotalClicks, len(clicks))))
+		clickCounts[code] = counter
+		// Exports from before the bot counter only have the tagged clicks
+		bots := new(atomic.Int64)
+		bots.Store(int64(max(entry.BotClicks, botClicks(clicks))))
+		botClickCounts[code] = bots
+		if len(entry.Rollups) > 0 {
+			rollups[code] = entry.Rollups
+		}
+		response.Imported++
+	}
+	for code, target := range doc.Tombstones {
+		if _, exists := urlStore[code]; !exists {
+			tombstones[code] = target
+		}
+	}
+	for _, code := range doc.RetiredCodes {
+		retiredCodes[code] = true
+	}
+	// The sequence only moves forward, so codes handed out by either
+	// instance are not handed out again
+	for {
+		current := codeSequence.Load()
+		if doc.CodeSequence <= current || codeSequence.CompareAndSwap(current, doc.CodeSequence) {
+			break
+		}
+	}
+	storeLock.Unlock()
+	redirectCache.Purge()
+
+	w.Header().Set("Content-Type", "application/json")
+	newJSONEncoder(w, r).Encode(response)
+}
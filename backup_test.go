@@ -0,0 +1,141 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func export(t *testing.T) ExportDocument {
+	t.Helper()
+	rec := do("GET", "/admin/export", "")
+	wantStatus(t, rec, http.StatusOK)
+	var doc ExportDocument
+	decode(t, rec, &doc)
+	return doc
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	resetStore(t)
+	set(t, &adminEnabled, true)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com/a", Shortcode: "a", Tags: []string{"spring"}})
+	mustCreate(t, ShortURLRequest{URL: "https://example.com/b", Shortcode: "b"})
+	mustCreate(t, ShortURLRequest{URL: "https://example.com/c", Shortcode: "c"})
+	for i := 0; i < 3; i++ {
+		wantStatus(t, do("GET", "/a", ""), http.StatusFound)
+	}
+	recordRedirect("b", nil, false, time.Now())
+	rotate(t, "b", `{"keepTombstone": true}`)
+	rotate(t, "c", "")
+
+	before := export(t)
+	if !reflect.DeepEqual(before.RetiredCodes, []string{"c"}) {
+		t.Errorf("retiredCodes = %v, want the code rotated out without a tombstone", before.RetiredCodes)
+	}
+	body := do("GET", "/admin/export", "").Body.String()
+	wantStatus(t, do("POST", "/admin/flush", ""), http.StatusOK)
+	if len(export(t).URLs) != 0 {
+		t.Fatal("flush left links behind")
+	}
+
+	rec := do("POST", "/admin/import", body)
+	wantStatus(t, rec, http.StatusOK)
+	var response ImportResponse
+	decode(t, rec, &response)
+	if response.Imported != 3 || response.Skipped != 0 {
+		t.Errorf("import = %+v, want 3 imported", response)
+	}
+
+	after := export(t)
+	after.ExportedAt = before.ExportedAt
+	if !reflect.DeepEqual(before, after) {
+		t.Errorf("round trip changed the store:\nbefore %+v\nafter  %+v", before, after)
+	}
+	if stats, _ := GetStats("a", clickPage{limit: 10}); stats.TotalClicks != 3 || len(stats.ClickDetails) != 3 {
+		t.Errorf("imported stats = %d clicks with %d details", stats.TotalClicks, len(stats.ClickDetails))
+	}
+	wantStatus(t, do("GET", "/b", ""), http.StatusMovedPermanently)
+}
+
+func TestImportModes(t *testing.T) {
+	resetStore(t)
+	set(t, &adminEnabled, true)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com/local", Shortcode: "a"})
+	mustCreate(t, ShortURLRequest{URL: "https://example.com/only-local", Shortcode: "local"})
+	doc := `{"version": 1, "urls": [
+		{"shortCode": "a", "originalUrl": "https://example.com/imported", "isActive": true, "expiresAt": "2999-01-01T00:00:00Z"},
+		{"shortCode": "new", "originalUrl": "https://example.com/new", "isActive": true, "expiresAt": "2999-01-01T00:00:00Z"}]}`
+
+	var response ImportResponse
+	decode(t, do("POST", "/admin/import", doc), &response)
+	if response.Imported != 1 || response.Skipped != 1 {
+		t.Errorf("merge = %+v, want 1 imported and 1 skipped", response)
+	}
+	if url, _ := Resolve("a"); url.OriginalURL != "https://example.com/local" {
+		t.Error("merge overwrote an existing link")
+	}
+
+	decode(t, do("POST", "/admin/import?mode=replace", doc), &response)
+	if response.Imported != 2 || response.Skipped != 0 {
+		t.Errorf("replace = %+v, want 2 imported", response)
+	}
+	if _, err := Resolve("local"); err != ErrNotFound {
+		t.Error("replace kept a link missing from the document")
+	}
+	if url, _ := Resolve("a"); url.OriginalURL != "https://example.com/imported" {
+		t.Error("replace kept the old link")
+	}
+	wantStatus(t, do("POST", "/admin/import?mode=upsert", doc), http.StatusBadRequest)
+}
+
+func TestImportValidation(t *testing.T) {
+	resetStore(t)
+	set(t, &adminEnabled, true)
+	tests := map[string]string{
+		"newer version":   `{"version": 2, "urls": []}`,
+		"no shortCode":    `{"urls": [{"originalUrl": "https://example.com"}]}`,
+		"bad scheme":      `{"urls": [{"shortCode": "x", "originalUrl": "javascript:alert(1)"}]}`,
+		"negative weight": `{"urls": [{"shortCode": "x", "originalUrl": "https://example.com", "destinations": [{"url": "https://example.com", "weight": -1}]}]}`,
+		"not json":        `{"urls": `,
+	}
+	for name, doc := range tests {
+		rec := do("POST", "/admin/import", doc)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", name, rec.Code)
+		}
+	}
+	if len(urlStore) != 0 {
+		t.Errorf("rejected imports stored %d links", len(urlStore))
+	}
+}
+
+func TestImportUnweightedDestinations(t *testing.T) {
+	resetStore(t)
+	set(t, &adminEnabled, true)
+	// Link groups exported before weights existed split traffic evenly
+	wantStatus(t, do("POST", "/admin/import", `{"urls": [{"shortCode": "grp", "originalUrl": "https://a.example.com",
+		"isActive": true, "expiresAt": "2999-01-01T00:00:00Z",
+		"destinations": [{"url": "https://a.example.com"}, {"url": "https://b.example.com"}]}]}`), http.StatusOK)
+
+	url, _ := Resolve("grp")
+	for _, dest := range url.Destinations {
+		if dest.Weight != 1 {
+			t.Errorf("%s imported with weight %d, want 1", dest.URL, dest.Weight)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		rec := do("GET", "/grp", "")
+		if !strings.HasSuffix(rec.Header().Get("Location"), ".example.com") {
+			t.Fatalf("redirect %d: %d %s", i, rec.Code, rec.Header().Get("Location"))
+		}
+	}
+}
+
+func TestBackupRequiresAdmin(t *testing.T) {
+	resetStore(t)
+	set(t, &adminEnabled, false)
+	wantStatus(t, do("GET", "/admin/export", ""), http.StatusNotFound)
+	wantStatus(t, do("POST", "/admin/import", `{"urls": []}`), http.StatusNotFound)
+}
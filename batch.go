@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// maxBatchCodes bounds how many codes one batch stats request may ask for
+const maxBatchCodes = 500
+
+type BatchStatsRequest struct {
+	Codes []string `json:"codes"`
+}
+
+type BatchStatsResponse struct {
+	Stats   map[string]URLStats `json:"stats"`
+	Missing []string            `json:"missing"`
+}
+
+// getBatchStats returns stats for several codes at once. Clients that send
+// Accept: application/msgpack get a MessagePack body using the same field
+// names as the JSON one.
+func getBatchStats(w http.ResponseWriter, r *http.Request) {
+	var req BatchStatsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	if len(req.Codes) > maxBatchCodes {
+		jsonError(w, `{"error": "Too many codes in batch"}`, http.StatusBadRequest)
+		return
+	}
+
+	page, err := parseClickPage(r)
+	if err != nil {
+		jsonError(w, `{"error": "`+err.Error()+`"}`, http.StatusBadRequest)
+		return
+	}
+
+	response := BatchStatsResponse{Stats: make(map[string]URLStats, len(req.Codes)), Missing: []string{}}
+	storeLock.RLock()
+	for _, code := range req.Codes {
+		url, exists := urlStore[code]
+		if !exists {
+			response.Missing = append(response.Missing, code)
+			continue
+		}
+		response.Stats[code] = buildURLStats(url, analytics[code].Slice(), clickTotal(code), botTotal(code), page)
+	}
+	storeLock.RUnlock()
+
+	if acceptsMsgpack(r) {
+		w.Header().Set("Content-Type", "application/msgpack")
+		enc := msgpack.NewEncoder(w)
+		enc.SetCustomStructTag("json")
+		enc.Encode(response)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	newJSONEncoder(w, r).Encode(response)
+}
+
+// acceptsMsgpack reports whether the Accept header asks for MessagePack
+func acceptsMsgpack(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, _ := strings.Cut(strings.TrimSpace(part), ";")
+		switch strings.TrimSpace(mediaType) {
+		case "application/msgpack", "application/x-msgpack", "application/vnd.msgpack":
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestBatchStats(t *testing.T) {
+	resetStore(t)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com/a", Shortcode: "a"})
+	mustCreate(t, ShortURLRequest{URL: "https://example.com/b", Shortcode: "b"})
+	wantStatus(t, do("GET", "/a", ""), http.StatusFound)
+
+	rec := do("POST", "/stats/batch", `{"codes": ["a", "b", "nope"]}`)
+	wantStatus(t, rec, http.StatusOK)
+	var response BatchStatsResponse
+	decode(t, rec, &response)
+	if len(response.Stats) != 2 || response.Stats["a"].TotalClicks != 1 || response.Stats["b"].OriginalURL != "https://example.com/b" {
+		t.Errorf("stats = %+v", response.Stats)
+	}
+	if len(response.Missing) != 1 || response.Missing[0] != "nope" {
+		t.Errorf("missing = %v", response.Missing)
+	}
+}
+
+func TestBatchStatsMsgpack(t *testing.T) {
+	resetStore(t)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com/a", Shortcode: "a"})
+	wantStatus(t, do("GET", "/a", ""), http.StatusFound)
+
+	r := request("POST", "/stats/batch", `{"codes": ["a"]}`)
+	r.Header.Set("Accept", "application/x-msgpack")
+	rec := serve(r)
+	wantStatus(t, rec, http.StatusOK)
+	if got := rec.Header().Get("Content-Type"); got != "application/msgpack" {
+		t.Fatalf("Content-Type = %q", got)
+	}
+
+	// The MessagePack body uses the JSON field names
+	var raw map[string]interface{}
+	if err := msgpack.NewDecoder(bytes.NewReader(rec.Body.Bytes())).Decode(&raw); err != nil {
+		t.Fatal(err)
+	}
+	stats, _ := raw["stats"].(map[string]interface{})
+	a, _ := stats["a"].(map[string]interface{})
+	if a["originalUrl"] != "https://example.com/a" {
+		t.Errorf("decoded %v", raw)
+	}
+}
+
+func TestBatchStatsLimits(t *testing.T) {
+	resetStore(t)
+	codes := `"x"` + strings.Repeat(`, "x"`, maxBatchCodes)
+	wantStatus(t, do("POST", "/stats/batch", `{"codes": [`+codes+`]}`), http.StatusBadRequest)
+	wantStatus(t, do("POST", "/stats/batch", `{"codes": `), http.StatusBadRequest)
+	wantStatus(t, do("POST", "/stats/batch?limit=-1", `{"codes": []}`), http.StatusBadRequest)
+}
+
+func TestBatchStatsHugeLimit(t *testing.T) {
+	resetStore(t)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com/a", Shortcode: "a"})
+	wantStatus(t, do("GET", "/a", ""), http.StatusFound)
+	wantStatus(t, do("GET", "/a", ""), http.StatusFound)
+
+	rec := do("POST", "/stats/batch?limit=9223372036854775807&offset=1", `{"codes": ["a"]}`)
+	wantStatus(t, rec, http.StatusOK)
+	var response BatchStatsResponse
+	decode(t, rec, &response)
+	if got := len(response.Stats["a"].ClickDetails); got != 1 {
+		t.Errorf("%d clicks past offset 1 with the largest limit, want 1", got)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// botUserAgentMarkers appear in the user agents of crawlers, scripts and
+// headless browsers. They are matched case-insensitively.
+var botUserAgentMarkers = []string{
+	"bot", "crawler", "spider", "slurp", "curl", "wget", "python-requests",
+	"python-urllib", "go-http-client", "java/", "okhttp", "headless", "phantomjs",
+}
+
+// botPattern matches bot user agents. BOT_PATTERNS replaces the default,
+// built from botUserAgentMarkers, with a list of regular expressions.
+var botPattern = compileBotMarkers(botUserAgentMarkers)
+
+// countBotClicks keeps bot clicks in TotalClicks, from COUNT_BOT_CLICKS
+var countBotClicks bool
+
+// compileBotMarkers builds a case-insensitive pattern matching any of markers
+func compileBotMarkers(markers []string) *regexp.Regexp {
+	quoted := make([]string, len(markers))
+	for i, marker := range markers {
+		quoted[i] = regexp.QuoteMeta(marker)
+	}
+	return regexp.MustCompile("(?i)" + strings.Join(quoted, "|"))
+}
+
+// parseBotPatterns compiles BOT_PATTERNS into one case-insensitive pattern
+func parseBotPatterns(patterns []string) (*regexp.Regexp, error) {
+	for _, pattern := range patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("pattern %q: %v", pattern, err)
+		}
+	}
+	return regexp.Compile("(?i)(?:" + strings.Join(patterns, ")|(?:") + ")")
+}
+
+// isBotUserAgent reports whether userAgent is empty or names a known bot
+func isBotUserAgent(userAgent string) bool {
+	if strings.TrimSpace(userAgent) == "" {
+		return true
+	}
+	return botPattern.MatchString(userAgent)
+}
+
+// botClicks returns how many of clicks were made by bots
+func botClicks(clicks []Click) int {
+	bots := 0
+	for _, click := range clicks {
+		if click.IsBot {
+			bots++
+		}
+	}
+	return bots
+}
+
+// riskyHumanClicks returns how many of the human clicks are high fraud risk
+func riskyHumanClicks(clicks []Click) int {
+	risky := 0
+	for _, click := range clicks {
+		if !click.IsBot && click.FraudScore >= highFraudScore {
+			risky++
+		}
+	}
+	return risky
+}
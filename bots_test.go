@@ -0,0 +1,149 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+const googlebotUserAgent = "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"
+
+func TestIsBotUserAgent(t *testing.T) {
+	tests := map[string]bool{
+		googlebotUserAgent: true,
+		"Mozilla/5.0 (compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm)": true,
+		"curl/8.5.0":                           true,
+		"python-requests/2.31.0":               true,
+		"Go-http-client/1.1":                   true,
+		"Mozilla/5.0 HeadlessChrome/120.0.0.0": true,
+		"":                                     true,
+		"   ":                                  true,
+		browserUserAgent:                       false,
+		iphoneUserAgent:                        false,
+		androidUserAgent:                       false,
+	}
+	for userAgent, want := range tests {
+		if got := isBotUserAgent(userAgent); got != want {
+			t.Errorf("isBotUserAgent(%q) = %v, want %v", userAgent, got, want)
+		}
+	}
+}
+
+func TestParseBotPatterns(t *testing.T) {
+	pattern, err := parseBotPatterns([]string{`^Monitor/\d+`, "uptime"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	set(t, &botPattern, pattern)
+	for userAgent, want := range map[string]bool{
+		"monitor/2 (status checks)": true,
+		"Pingdom UPTIME robot":      true,
+		googlebotUserAgent:          false,
+		browserUserAgent:            false,
+	} {
+		if got := isBotUserAgent(userAgent); got != want {
+			t.Errorf("with custom patterns, isBotUserAgent(%q) = %v, want %v", userAgent, got, want)
+		}
+	}
+	if _, err := parseBotPatterns([]string{"ok", "(unclosed"}); err == nil {
+		t.Error("invalid pattern accepted")
+	}
+}
+
+func TestBotClicksLeftOutOfTotal(t *testing.T) {
+	resetStore(t)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "bots"})
+	for _, userAgent := range []string{googlebotUserAgent, browserUserAgent, googlebotUserAgent} {
+		r := request("GET", "/bots", "")
+		r.Header.Set("User-Agent", userAgent)
+		wantStatus(t, serve(r), http.StatusFound)
+	}
+
+	stats, _ := GetStats("bots", clickPage{limit: 10})
+	if stats.TotalClicks != 1 || stats.HumanClicks != 1 || stats.BotClicks != 2 {
+		t.Errorf("total %d, human %d, bot %d; want 1, 1, 2", stats.TotalClicks, stats.HumanClicks, stats.BotClicks)
+	}
+	// The raw entries are all kept, tagged
+	if len(stats.ClickDetails) != 3 {
+		t.Fatalf("%d clicks stored, want 3", len(stats.ClickDetails))
+	}
+	for _, click := range stats.ClickDetails {
+		if click.IsBot != (click.UserAgent == googlebotUserAgent) {
+			t.Errorf("click from %q tagged IsBot %v", click.UserAgent, click.IsBot)
+		}
+	}
+
+	set(t, &countBotClicks, true)
+	stats, _ = GetStats("bots", clickPage{})
+	if stats.TotalClicks != 3 || stats.HumanClicks != 1 || stats.BotClicks != 2 {
+		t.Errorf("counting bots: total %d, human %d, bot %d; want 3, 1, 2", stats.TotalClicks, stats.HumanClicks, stats.BotClicks)
+	}
+}
+
+func TestBotCountsOutliveClickDetails(t *testing.T) {
+	resetStore(t)
+	set(t, &rollupInterval, 0)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "bots"})
+	for _, userAgent := range []string{googlebotUserAgent, browserUserAgent, googlebotUserAgent} {
+		r := request("GET", "/bots", "")
+		r.Header.Set("User-Agent", userAgent)
+		wantStatus(t, serve(r), http.StatusFound)
+	}
+	// Pruning every click detail leaves the counters to tell bots apart
+	pruneClicksBefore(time.Now().Add(time.Minute))
+
+	stats, _ := GetStats("bots", clickPage{limit: 10})
+	if len(stats.ClickDetails) != 0 {
+		t.Fatalf("%d clicks left after pruning", len(stats.ClickDetails))
+	}
+	if stats.TotalClicks != 1 || stats.HumanClicks != 1 || stats.BotClicks != 2 {
+		t.Errorf("total %d, human %d, bot %d; want 1, 1, 2", stats.TotalClicks, stats.HumanClicks, stats.BotClicks)
+	}
+
+	// The bare count agrees with the stats either way
+	var count ClickCountResponse
+	decode(t, do("GET", "/shorturls/bots/count", ""), &count)
+	if count.Clicks != 1 {
+		t.Errorf("count = %d, want the 1 human click", count.Clicks)
+	}
+	set(t, &countBotClicks, true)
+	decode(t, do("GET", "/shorturls/bots/count", ""), &count)
+	if count.Clicks != 3 {
+		t.Errorf("counting bots: count = %d, want 3", count.Clicks)
+	}
+}
+
+func TestCountedOnlyBotClicks(t *testing.T) {
+	resetStore(t)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "priv", TrackAnalytics: new(bool)})
+	for _, userAgent := range []string{googlebotUserAgent, browserUserAgent} {
+		r := request("GET", "/priv", "")
+		r.Header.Set("User-Agent", userAgent)
+		wantStatus(t, serve(r), http.StatusFound)
+	}
+	stats, _ := GetStats("priv", clickPage{})
+	if len(stats.ClickDetails) != 0 || stats.HumanClicks != 1 || stats.BotClicks != 1 {
+		t.Errorf("%d details, human %d, bot %d; want 0, 1, 1", len(stats.ClickDetails), stats.HumanClicks, stats.BotClicks)
+	}
+}
+
+func TestBotCountsSurviveExport(t *testing.T) {
+	resetStore(t)
+	set(t, &adminEnabled, true)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "bots"})
+	r := request("GET", "/bots", "")
+	r.Header.Set("User-Agent", googlebotUserAgent)
+	wantStatus(t, serve(r), http.StatusFound)
+	wantStatus(t, do("GET", "/bots", ""), http.StatusFound)
+	// Without click details the export has only the counters to go on
+	set(t, &rollupInterval, 0)
+	pruneClicksBefore(time.Now().Add(time.Minute))
+
+	body := do("GET", "/admin/export", "").Body.String()
+	wantStatus(t, do("POST", "/admin/flush", ""), http.StatusOK)
+	wantStatus(t, do("POST", "/admin/import", body), http.StatusOK)
+	stats, _ := GetStats("bots", clickPage{})
+	if stats.HumanClicks != 1 || stats.BotClicks != 1 {
+		t.Errorf("after import: human %d, bot %d; want 1 and 1", stats.HumanClicks, stats.BotClicks)
+	}
+}
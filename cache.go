@@ -0,0 +1,102 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+)
+
+// redirectCache keeps hot ShortURL records in front of urlStore so popular
+// redirects skip storeLock. It is nil (disabled) unless REDIRECT_CACHE_SIZE is
+// set, and any code that changes or removes a record must invalidate it once
+// the store holds the new value. Readers fill it while holding storeLock.
+var redirectCache *lruCache
+
+// lruCache is a fixed-size cache of ShortURL records that evicts roughly
+// the least recently used. Lookups only mark their entry as used, so they
+// share a read lock; eviction gives marked entries a second chance instead
+// of keeping the order exact. All methods are safe on a nil cache, which
+// behaves as always empty.
+type lruCache struct {
+	mu      sync.RWMutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type lruEntry struct {
+	code string
+	url  ShortURL
+	// used is set by lookups since the entry last reached the front
+	used atomic.Bool
+}
+
+func newLRUCache(size int) *lruCache {
+	return &lruCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element, size),
+	}
+}
+
+func (c *lruCache) Get(code string) (ShortURL, bool) {
+	if c == nil {
+		return ShortURL{}, false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	elem, ok := c.entries[code]
+	if !ok {
+		return ShortURL{}, false
+	}
+	entry := elem.Value.(*lruEntry)
+	entry.used.Store(true)
+	return entry.url, true
+}
+
+func (c *lruCache) Add(code string, url ShortURL) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[code]; ok {
+		elem.Value.(*lruEntry).url = url
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[code] = c.order.PushFront(&lruEntry{code: code, url: url})
+	for c.order.Len() > c.size {
+		// Entries looked up since they were last moved go back to the front
+		oldest := c.order.Back()
+		entry := oldest.Value.(*lruEntry)
+		if entry.used.Swap(false) {
+			c.order.MoveToFront(oldest)
+			continue
+		}
+		c.order.Remove(oldest)
+		delete(c.entries, entry.code)
+	}
+}
+
+func (c *lruCache) Remove(code string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[code]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, code)
+	}
+}
+
+func (c *lruCache) Purge() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	c.entries = make(map[string]*list.Element, c.size)
+}
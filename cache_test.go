@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestLRUCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newLRUCache(2)
+	c.Add("a", ShortURL{ShortCode: "a"})
+	c.Add("b", ShortURL{ShortCode: "b"})
+	c.Get("a")
+	c.Add("c", ShortURL{ShortCode: "c"})
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("b survived although it was least recently used")
+	}
+	for _, code := range []string{"a", "c"} {
+		if _, ok := c.Get(code); !ok {
+			t.Errorf("%s was evicted", code)
+		}
+	}
+	c.Purge()
+	if _, ok := c.Get("a"); ok {
+		t.Error("a survived a purge")
+	}
+}
+
+func TestNilLRUCache(t *testing.T) {
+	var c *lruCache
+	c.Add("a", ShortURL{})
+	c.Remove("a")
+	c.Purge()
+	if _, ok := c.Get("a"); ok {
+		t.Error("nil cache returned an entry")
+	}
+}
+
+func TestRedirectFillsAndInvalidatesCache(t *testing.T) {
+	resetStore(t)
+	set(t, &adminEnabled, true)
+	redirectCache = newLRUCache(10)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "hot"})
+	wantStatus(t, do("GET", "/hot", ""), http.StatusFound)
+	if _, ok := redirectCache.Get("hot"); !ok {
+		t.Fatal("redirect did not fill the cache")
+	}
+
+	wantStatus(t, do("POST", "/admin/flush", ""), http.StatusOK)
+	wantStatus(t, do("GET", "/hot", ""), http.StatusNotFound)
+}
+
+func TestRedirectCacheNotStaleUnderRace(t *testing.T) {
+	resetStore(t)
+	set(t, &adminEnabled, true)
+	redirectCache = newLRUCache(10)
+
+	// A reader that caches the record after the writer invalidated it would
+	// keep serving the link after it was removed
+	for i := 0; i < 200; i++ {
+		mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "hot"})
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			do("GET", "/hot", "")
+		}()
+		go func() {
+			defer wg.Done()
+			do("POST", "/admin/flush", "")
+		}()
+		wg.Wait()
+
+		if rec := do("GET", "/hot", ""); rec.Code != http.StatusNotFound {
+			t.Fatalf("round %d: redirect after flush: status %d", i, rec.Code)
+		}
+	}
+}
+
+// benchmarkRedirect serves a redirect to one of 100 hot codes per iteration
+// from parallel clients while another client keeps hitting the first code
+func benchmarkRedirect(b *testing.B, cacheSize int) {
+	resetStore(b)
+	if cacheSize > 0 {
+		redirectCache = newLRUCache(cacheSize)
+	}
+	handler := newHandler(newRouter())
+	codes := make([]string, 100)
+	for i := range codes {
+		codes[i] = fmt.Sprintf("code%d", i)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, request("POST", "/shorturls", `{"url": "https://example.com", "shortcode": "`+codes[i]+`"}`))
+		if rec.Code != http.StatusCreated {
+			b.Fatalf("creating %s: status %d", codes[i], rec.Code)
+		}
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				handler.ServeHTTP(httptest.NewRecorder(), request("GET", "/"+codes[0], ""))
+			}
+		}
+	}()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, request("GET", "/"+codes[i%len(codes)], ""))
+			if rec.Code != http.StatusFound {
+				b.Errorf("status %d", rec.Code)
+				return
+			}
+			i++
+		}
+	})
+	b.StopTimer()
+	close(stop)
+	<-done
+}
+
+func BenchmarkRedirectUncached(b *testing.B) { benchmarkRedirect(b, 0) }
+func BenchmarkRedirectCached(b *testing.B)   { benchmarkRedirect(b, 1000) }
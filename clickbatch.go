@@ -0,0 +1,100 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Click batching settings, populated from the environment in main. Clicks
+// are written to the store as they happen unless CLICK_BATCH_SIZE is set.
+var (
+	clickBatchSize     int
+	clickBatchInterval = time.Second
+)
+
+// clickBatch buffers redirect clicks between store writes; nil when
+// batching is off
+var clickBatch *clickBatcher
+
+// clickBatcher collects clicks in memory and writes them to the store in one
+// go, once size clicks are waiting or the flush interval passes. Until then
+// they are missing from stats.
+type clickBatcher struct {
+	mu      sync.Mutex
+	size    int
+	pending []pendingClick
+	full    chan struct{}
+}
+
+// pendingClick is a buffered redirect; click is nil for counted-only clicks
+type pendingClick struct {
+	code  string
+	click *Click
+	bot   bool
+}
+
+func newClickBatcher(size int) *clickBatcher {
+	return &clickBatcher{size: size, full: make(chan struct{}, 1)}
+}
+
+// add buffers a click for code, waking the flusher once the batch is full
+func (b *clickBatcher) add(code string, click *Click, bot bool) {
+	b.mu.Lock()
+	b.pending = append(b.pending, pendingClick{code: code, click: click, bot: bot})
+	full := len(b.pending) >= b.size
+	b.mu.Unlock()
+	if full {
+		select {
+		case b.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// flush writes the buffered clicks to the store, dropping those of links
+// deleted in the meantime. It returns the number of clicks written.
+func (b *clickBatcher) flush() int {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	batch := b.pending
+	b.pending = nil
+	b.mu.Unlock()
+	if len(batch) == 0 {
+		return 0
+	}
+
+	storeLock.Lock()
+	defer storeLock.Unlock()
+	written := 0
+	for _, pending := range batch {
+		if _, exists := urlStore[pending.code]; !exists {
+			continue
+		}
+		storeClick(pending.code, pending.click, pending.bot)
+		written++
+	}
+	return written
+}
+
+// run flushes whenever the batch fills up or interval passes, until stop is
+// closed. The caller flushes once more on shutdown.
+func (b *clickBatcher) run(interval time.Duration, stop <-chan struct{}) {
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-b.full:
+			b.flush()
+		case <-tick:
+			b.flush()
+		case <-stop:
+			return
+		}
+	}
+}
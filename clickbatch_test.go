@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// runClickBatch turns batching on with the given size and interval until the
+// test ends
+func runClickBatch(t *testing.T, size int, interval time.Duration) {
+	t.Helper()
+	set(t, &clickBatch, newClickBatcher(size))
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		clickBatch.run(interval, stop)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		close(stop)
+		<-done
+	})
+}
+
+func storedClicks(code string) int {
+	storeLock.RLock()
+	defer storeLock.RUnlock()
+	return clickTotal(code)
+}
+
+func waitForClicks(t *testing.T, code string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for storedClicks(code) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d clicks stored for %s, want %d", storedClicks(code), code, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestClickBatchFlushesWhenFull(t *testing.T) {
+	resetStore(t)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "batch"})
+	runClickBatch(t, 3, time.Hour)
+
+	wantStatus(t, do("GET", "/batch", ""), http.StatusFound)
+	wantStatus(t, do("GET", "/batch", ""), http.StatusFound)
+	time.Sleep(20 * time.Millisecond)
+	if n := storedClicks("batch"); n != 0 {
+		t.Fatalf("%d clicks written before the batch filled", n)
+	}
+	wantStatus(t, do("GET", "/batch", ""), http.StatusFound)
+	waitForClicks(t, "batch", 3)
+
+	stats, _ := GetStats("batch", clickPage{limit: 10})
+	if stats.TotalClicks != 3 || len(stats.ClickDetails) != 3 {
+		t.Errorf("total %d with %d details, want 3 and 3", stats.TotalClicks, len(stats.ClickDetails))
+	}
+}
+
+func TestClickBatchFlushesOnInterval(t *testing.T) {
+	resetStore(t)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "batch"})
+	runClickBatch(t, 100, 10*time.Millisecond)
+
+	wantStatus(t, do("GET", "/batch", ""), http.StatusFound)
+	waitForClicks(t, "batch", 1)
+}
+
+func TestClickBatchFlushOnShutdown(t *testing.T) {
+	resetStore(t)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "batch"})
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "gone"})
+	batch := newClickBatcher(100)
+	set(t, &clickBatch, batch)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		batch.run(time.Hour, stop)
+		close(done)
+	}()
+
+	wantStatus(t, do("GET", "/batch", ""), http.StatusFound)
+	wantStatus(t, do("GET", "/batch", ""), http.StatusFound)
+	wantStatus(t, do("GET", "/gone", ""), http.StatusFound)
+	rotate(t, "gone", `{}`)
+	close(stop)
+	<-done
+
+	// What main does once the server has stopped; the click through the
+	// retired code is dropped
+	if flushed := batch.flush(); flushed != 2 {
+		t.Errorf("flushed %d clicks, want 2", flushed)
+	}
+	if n := storedClicks("batch"); n != 2 {
+		t.Errorf("%d clicks stored, want 2", n)
+	}
+	if flushed := batch.flush(); flushed != 0 {
+		t.Errorf("second flush wrote %d clicks", flushed)
+	}
+	var off *clickBatcher
+	if off.flush() != 0 {
+		t.Error("flush with batching off wrote clicks")
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import "sync"
+
+// clickLog holds a link's click details oldest first in a growable ring
+// buffer, so recording a click and dropping the oldest ones are both O(1).
+// A nil *clickLog is empty. Its contents have their own lock so redirects
+// can record clicks holding storeLock only for reading; the analytics map
+// itself is still guarded by storeLock.
+type clickLog struct {
+	mu    sync.Mutex
+	buf   []Click
+	head  int // index of the oldest click in buf
+	count int
+}
+
+// minClickLogCap is the capacity a clickLog starts with on its first click
+const minClickLogCap = 8
+
+// newClickLog returns a log holding clicks, which must be oldest first
+func newClickLog(clicks []Click) *clickLog {
+	l := &clickLog{buf: make([]Click, max(len(clicks), minClickLogCap))}
+	l.count = copy(l.buf, clicks)
+	return l
+}
+
+// Len returns the number of clicks held
+func (l *clickLog) Len() int {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.count
+}
+
+// At returns the i-th oldest click
+func (l *clickLog) At(i int) Click {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.buf[(l.head+i)%len(l.buf)]
+}
+
+// Push records click as the newest
+func (l *clickLog) Push(click Click) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.push(click)
+}
+
+// PushIfEmpty records click only if the log holds no clicks yet, reporting
+// whether it did
+func (l *clickLog) PushIfEmpty(click Click) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.count > 0 {
+		return false
+	}
+	l.push(click)
+	return true
+}
+
+// push records click as the newest, doubling the buffer when it is full.
+// The caller must hold l.mu.
+func (l *clickLog) push(click Click) {
+	if l.count == len(l.buf) {
+		l.resize(max(2*len(l.buf), minClickLogCap))
+	}
+	l.buf[(l.head+l.count)%len(l.buf)] = click
+	l.count++
+}
+
+// DropOldest discards the n oldest clicks, shrinking the buffer once it is
+// mostly empty so pruned details can be freed
+func (l *clickLog) DropOldest(n int) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n = min(n, l.count)
+	if n <= 0 {
+		return
+	}
+	for i := 0; i < n; i++ {
+		l.buf[(l.head+i)%len(l.buf)] = Click{}
+	}
+	l.head = (l.head + n) % len(l.buf)
+	l.count -= n
+	if len(l.buf) > minClickLogCap && l.count < len(l.buf)/4 {
+		l.resize(max(2*l.count, minClickLogCap))
+	}
+}
+
+// Slice returns a copy of the clicks, oldest first
+func (l *clickLog) Slice() []Click {
+	if l == nil {
+		return []Click{}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	clicks := make([]Click, l.count)
+	n := copy(clicks, l.buf[l.head:min(l.head+l.count, len(l.buf))])
+	copy(clicks[n:], l.buf[:l.count-n])
+	return clicks
+}
+
+// resize moves the clicks into a buffer of capacity size >= l.count. The
+// caller must hold l.mu.
+func (l *clickLog) resize(size int) {
+	buf := make([]Click, size)
+	n := copy(buf, l.buf[l.head:min(l.head+l.count, len(l.buf))])
+	copy(buf[n:], l.buf[:l.count-n])
+	l.buf, l.head = buf, 0
+}
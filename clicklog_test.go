@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func numberedClick(n int) Click {
+	return Click{Timestamp: time.Unix(int64(n), 0)}
+}
+
+// clickNumbers returns the numbers of numberedClick clicks
+func clickNumbers(clicks []Click) []int {
+	numbers := make([]int, len(clicks))
+	for i, click := range clicks {
+		numbers[i] = int(click.Timestamp.Unix())
+	}
+	return numbers
+}
+
+func wantClicks(t *testing.T, l *clickLog, want ...int) {
+	t.Helper()
+	got := clickNumbers(l.Slice())
+	if fmt.Sprint(got) != fmt.Sprint(want) || l.Len() != len(want) {
+		t.Fatalf("log holds %v (Len %d), want %v", got, l.Len(), want)
+	}
+	for i, n := range want {
+		if at := int(l.At(i).Timestamp.Unix()); at != n {
+			t.Fatalf("At(%d) = %d, want %d", i, at, n)
+		}
+	}
+}
+
+func TestClickLogPushAndDrop(t *testing.T) {
+	l := newClickLog(nil)
+	for i := 1; i <= 5; i++ {
+		l.Push(numberedClick(i))
+	}
+	wantClicks(t, l, 1, 2, 3, 4, 5)
+
+	l.DropOldest(2)
+	wantClicks(t, l, 3, 4, 5)
+	l.DropOldest(0)
+	l.DropOldest(-1)
+	wantClicks(t, l, 3, 4, 5)
+	l.DropOldest(10)
+	wantClicks(t, l)
+	l.Push(numberedClick(6))
+	wantClicks(t, l, 6)
+}
+
+func TestClickLogWraparound(t *testing.T) {
+	l := newClickLog(nil)
+	for i := 1; i <= minClickLogCap; i++ {
+		l.Push(numberedClick(i))
+	}
+	l.DropOldest(3)
+	// These land at the front of the buffer, behind the head
+	for i := minClickLogCap + 1; i <= minClickLogCap+3; i++ {
+		l.Push(numberedClick(i))
+	}
+	if len(l.buf) != minClickLogCap || l.head != 3 {
+		t.Fatalf("buffer of %d with head %d, want a full wrapped buffer of %d", len(l.buf), l.head, minClickLogCap)
+	}
+	wantClicks(t, l, 4, 5, 6, 7, 8, 9, 10, 11)
+
+	// Growing a wrapped buffer keeps the order
+	l.Push(numberedClick(12))
+	if len(l.buf) != 2*minClickLogCap {
+		t.Errorf("buffer holds %d after growing, want %d", len(l.buf), 2*minClickLogCap)
+	}
+	wantClicks(t, l, 4, 5, 6, 7, 8, 9, 10, 11, 12)
+}
+
+func TestClickLogShrinks(t *testing.T) {
+	clicks := make([]Click, 100)
+	for i := range clicks {
+		clicks[i] = numberedClick(i)
+	}
+	l := newClickLog(clicks)
+	l.DropOldest(95)
+	if len(l.buf) > 4*l.Len() && len(l.buf) > minClickLogCap {
+		t.Errorf("buffer of %d kept for %d clicks", len(l.buf), l.Len())
+	}
+	wantClicks(t, l, 95, 96, 97, 98, 99)
+
+	// Shrinking copies the clicks, so callers' slices are not aliased
+	clicks[99].Referrer = "changed"
+	if l.At(4).Referrer != "" {
+		t.Error("log shares memory with the slice it was built from")
+	}
+}
+
+func TestClickLogNil(t *testing.T) {
+	var l *clickLog
+	if l.Len() != 0 || len(l.Slice()) != 0 || l.Slice() == nil {
+		t.Errorf("nil log gives Len %d and Slice %v", l.Len(), l.Slice())
+	}
+	l.DropOldest(1)
+}
+
+func TestClickLogPushIfEmpty(t *testing.T) {
+	l := &clickLog{}
+	if !l.PushIfEmpty(numberedClick(1)) || l.PushIfEmpty(numberedClick(2)) {
+		t.Fatal("PushIfEmpty did not keep exactly the first click")
+	}
+	if l.Len() != 1 || l.At(0).Timestamp.Unix() != 1 {
+		t.Errorf("log holds %v", l.Slice())
+	}
+}
+
+// BenchmarkClickLogRetention records one click and expires the oldest per iteration,
+// holding window clicks, as retention does for a busy link
+func BenchmarkClickLogRetention(b *testing.B) {
+	for _, window := range []int{1000, 100000} {
+		b.Run(fmt.Sprint(window), func(b *testing.B) {
+			l := newClickLog(make([]Click, window))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				l.Push(numberedClick(i))
+				l.DropOldest(1)
+			}
+		})
+	}
+}
+
+// BenchmarkClickSliceRetention is the same workload on a plain slice, which
+// has to move every remaining click when the oldest is dropped
+func BenchmarkClickSliceRetention(b *testing.B) {
+	for _, window := range []int{1000, 100000} {
+		b.Run(fmt.Sprint(window), func(b *testing.B) {
+			clicks := make([]Click, window)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				clicks = append(clicks, numberedClick(i))
+				clicks = append(clicks[:0], clicks[1:]...)
+			}
+		})
+	}
+}
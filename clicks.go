@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type ImportClicksResponse struct {
+	Imported    int `json:"imported"`
+	TotalClicks int `json:"totalClicks"`
+}
+
+// importClicks appends historical clicks with their original timestamps.
+// It is registered behind adminOnly since the timestamps are client-provided.
+func importClicks(w http.ResponseWriter, r *http.Request) {
+	shortCode := mux.Vars(r)["shortcode"]
+
+	var clicks []Click
+	if err := json.NewDecoder(r.Body).Decode(&clicks); err != nil {
+		jsonError(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	for i := range clicks {
+		clicks[i].IPAddress = anonymizeIP(clicks[i].IPAddress)
+	}
+	for i, click := range clicks {
+		if click.Timestamp.IsZero() {
+			jsonError(w, fmt.Sprintf(`{"error": "Click %d is missing a timestamp"}`, i), http.StatusBadRequest)
+			return
+		}
+		if click.Timestamp.After(now) {
+			jsonError(w, fmt.Sprintf(`{"error": "Click %d has a timestamp in the future"}`, i), http.StatusBadRequest)
+			return
+		}
+	}
+
+	storeLock.Lock()
+	if _, exists := urlStore[shortCode]; !exists {
+		storeLock.Unlock()
+		jsonError(w, `{"error": "Short URL not found"}`, http.StatusNotFound)
+		return
+	}
+	merged := append(analytics[shortCode].Slice(), clicks...)
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Timestamp.Before(merged[j].Timestamp)
+	})
+	analytics[shortCode] = newClickLog(merged)
+	countClicks(shortCode, len(clicks))
+	countBots(shortCode, botClicks(clicks))
+	total := clickTotal(shortCode)
+	storeLock.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	newJSONEncoder(w, r).Encode(ImportClicksResponse{Imported: len(clicks), TotalClicks: total})
+}
+
+type HeatmapResponse struct {
+	Timezone string `json:"timezone"`
+	// Matrix is indexed by day of week (0 = Sunday) and then hour of day
+	Matrix [7][24]int `json:"matrix"`
+}
+
+// getClickHeatmap buckets clicks by day of week and hour of day in the
+// timezone given by ?tz= (an IANA name, defaulting to UTC)
+func getClickHeatmap(w http.ResponseWriter, r *http.Request) {
+	shortCode := mux.Vars(r)["shortcode"]
+
+	tz := r.URL.Query().Get("tz")
+	if tz == "" {
+		tz = "UTC"
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		jsonError(w, `{"error": "Invalid timezone"}`, http.StatusBadRequest)
+		return
+	}
+
+	storeLock.RLock()
+	_, exists := urlStore[shortCode]
+	clicks := analytics[shortCode].Slice()
+	storeLock.RUnlock()
+
+	if !exists {
+		jsonError(w, `{"error": "Short URL not found"}`, http.StatusNotFound)
+		return
+	}
+
+	response := HeatmapResponse{Timezone: loc.String()}
+	for _, click := range clicks {
+		t := click.Timestamp.In(loc)
+		response.Matrix[t.Weekday()][t.Hour()]++
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	newJSONEncoder(w, r).Encode(response)
+}
+
+// clickPage selects a window of click details for the stats response
+type clickPage struct {
+	limit  int
+	offset int
+	desc   bool
+}
+
+// parseClickPage reads ?limit=, ?offset= and ?sort=asc|desc, defaulting to
+// the most recent 100 clicks, newest first
+func parseClickPage(r *http.Request) (clickPage, error) {
+	page := clickPage{limit: 100, desc: true}
+	query := r.URL.Query()
+
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			return page, errors.New("limit must be a non-negative integer")
+		}
+		page.limit = limit
+	}
+	if v := query.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return page, errors.New("offset must be a non-negative integer")
+		}
+		page.offset = offset
+	}
+	switch query.Get("sort") {
+	case "", "desc":
+	case "asc":
+		page.desc = false
+	default:
+		return page, errors.New("sort must be asc or desc")
+	}
+	return page, nil
+}
+
+// apply returns a sorted copy of the requested window of clicks
+func (p clickPage) apply(clicks []Click) []Click {
+	sorted := make([]Click, len(clicks))
+	copy(sorted, clicks)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if p.desc {
+			return sorted[i].Timestamp.After(sorted[j].Timestamp)
+		}
+		return sorted[i].Timestamp.Before(sorted[j].Timestamp)
+	})
+
+	if p.offset >= len(sorted) {
+		return []Click{}
+	}
+	// offset+limit can overflow for huge limits, so bound the limit by what
+	// is left instead
+	end := p.offset + min(p.limit, len(sorted)-p.offset)
+	return sorted[p.offset:end]
+}
+
+// exportClicksJSONL streams a link's clicks as newline-delimited JSON, one
+// click per line, flushing as it goes
+func exportClicksJSONL(w http.ResponseWriter, r *http.Request) {
+	shortCode := mux.Vars(r)["shortcode"]
+
+	storeLock.RLock()
+	_, exists := urlStore[shortCode]
+	clicks := analytics[shortCode].Slice()
+	storeLock.RUnlock()
+
+	if !exists {
+		jsonError(w, `{"error": "Short URL not found"}`, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	rc := http.NewResponseController(w)
+	enc := json.NewEncoder(w)
+	for i, click := range clicks {
+		if err := enc.Encode(click); err != nil {
+			return
+		}
+		if i%100 == 99 {
+			rc.Flush()
+		}
+	}
+	rc.Flush()
+}
+
+type ClickCountResponse struct {
+	Clicks int `json:"clicks"`
+}
+
+// getClickCount returns just the number of clicks, as a bare number for
+// clients that prefer text/plain
+func getClickCount(w http.ResponseWriter, r *http.Request) {
+	shortCode := mux.Vars(r)["shortcode"]
+
+	storeLock.RLock()
+	_, exists := urlStore[shortCode]
+	count := reportedClicks(shortCode)
+	storeLock.RUnlock()
+
+	if !exists {
+		jsonError(w, `{"error": "Short URL not found"}`, http.StatusNotFound)
+		return
+	}
+
+	if prefersPlainText(r) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(w, count)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	newJSONEncoder(w, r).Encode(ClickCountResponse{Clicks: count})
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestImportClicks(t *testing.T) {
+	resetStore(t)
+	set(t, &adminEnabled, true)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "imp"})
+	live := request("GET", "/imp", "")
+	live.Header.Set("Referer", "live")
+	wantStatus(t, serve(live), http.StatusFound)
+
+	now := time.Now()
+	body := fmt.Sprintf(`[{"timestamp": %q, "referrer": "recent"}, {"timestamp": %q, "referrer": "old"}]`,
+		now.Add(-time.Minute).Format(time.RFC3339), now.Add(-48*time.Hour).Format(time.RFC3339))
+	rec := do("POST", "/shorturls/imp/clicks/import", body)
+	wantStatus(t, rec, http.StatusOK)
+	var response ImportClicksResponse
+	decode(t, rec, &response)
+	if response.Imported != 2 || response.TotalClicks != 3 {
+		t.Errorf("response = %+v, want 2 imported of 3", response)
+	}
+
+	var order []string
+	for _, click := range getStats(t, "imp?sort=asc").ClickDetails {
+		order = append(order, click.Referrer)
+	}
+	if fmt.Sprint(order) != "[old recent live]" {
+		t.Errorf("clicks in order %v, want oldest first", order)
+	}
+}
+
+func TestImportClicksRejectsBadTimestamps(t *testing.T) {
+	resetStore(t)
+	set(t, &adminEnabled, true)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "imp"})
+
+	future := time.Now().Add(time.Hour).Format(time.RFC3339)
+	for _, body := range []string{`[{"referrer": "none"}]`, `[{"timestamp": "` + future + `"}]`} {
+		wantStatus(t, do("POST", "/shorturls/imp/clicks/import", body), http.StatusBadRequest)
+	}
+	wantStatus(t, do("POST", "/shorturls/missing/clicks/import", `[]`), http.StatusNotFound)
+	if n := getStats(t, "imp").TotalClicks; n != 0 {
+		t.Errorf("%d clicks counted after rejected imports", n)
+	}
+
+	set(t, &adminEnabled, false)
+	wantStatus(t, do("POST", "/shorturls/imp/clicks/import", `[]`), http.StatusNotFound)
+}
+
+func TestClickHeatmap(t *testing.T) {
+	resetStore(t)
+	set(t, &adminEnabled, true)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "heat"})
+	// Sunday 2024-03-03 23:30 UTC is Monday 08:30 in Tokyo
+	wantStatus(t, do("POST", "/shorturls/heat/clicks/import",
+		`[{"timestamp": "2024-03-03T23:30:00Z"}, {"timestamp": "2024-03-03T23:35:00Z"}]`), http.StatusOK)
+
+	rec := do("GET", "/shorturls/heat/heatmap", "")
+	wantStatus(t, rec, http.StatusOK)
+	var response HeatmapResponse
+	decode(t, rec, &response)
+	if response.Timezone != "UTC" || response.Matrix[time.Sunday][23] != 2 {
+		t.Errorf("UTC heatmap = %+v", response)
+	}
+
+	rec = do("GET", "/shorturls/heat/heatmap?tz=Asia/Tokyo", "")
+	wantStatus(t, rec, http.StatusOK)
+	decode(t, rec, &response)
+	if response.Matrix[time.Monday][8] != 2 {
+		t.Errorf("Tokyo heatmap = %+v", response.Matrix)
+	}
+
+	wantStatus(t, do("GET", "/shorturls/heat/heatmap?tz=Mars/Olympus", ""), http.StatusBadRequest)
+	wantStatus(t, do("GET", "/shorturls/missing/heatmap", ""), http.StatusNotFound)
+}
+
+func TestStatsClickPagination(t *testing.T) {
+	resetStore(t)
+	set(t, &adminEnabled, true)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "page"})
+	start := time.Now().Add(-time.Hour)
+	var clicks []string
+	for i := 0; i < 5; i++ {
+		at := start.Add(time.Duration(i) * time.Minute).Format(time.RFC3339)
+		clicks = append(clicks, fmt.Sprintf(`{"timestamp": %q, "referrer": "%d", "userAgent": %q}`, at, i, browserUserAgent))
+	}
+	body := "[" + strings.Join(clicks, ", ") + "]"
+	wantStatus(t, do("POST", "/shorturls/page/clicks/import", body), http.StatusOK)
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"", "[4 3 2 1 0]"},
+		{"?limit=2", "[4 3]"},
+		{"?limit=2&offset=1&sort=asc", "[1 2]"},
+		{"?offset=9", "[]"},
+	}
+	for _, tt := range tests {
+		rec := do("GET", "/shorturls/page"+tt.query, "")
+		wantStatus(t, rec, http.StatusOK)
+		var stats URLStats
+		decode(t, rec, &stats)
+		var got []string
+		for _, click := range stats.ClickDetails {
+			got = append(got, click.Referrer)
+		}
+		if fmt.Sprint(got) != tt.want {
+			t.Errorf("%q: clicks %v, want %s", tt.query, got, tt.want)
+		}
+		if stats.TotalClicks != 5 {
+			t.Errorf("%q: totalClicks = %d, want 5", tt.query, stats.TotalClicks)
+		}
+	}
+
+	for _, query := range []string{"?limit=-1", "?offset=x", "?sort=random"} {
+		wantStatus(t, do("GET", "/shorturls/page"+query, ""), http.StatusBadRequest)
+	}
+}
+
+func TestExportClicksJSONL(t *testing.T) {
+	resetStore(t)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "jl"})
+	start := time.Now().Add(-time.Hour)
+	var clicks []Click
+	for i := 0; i < 150; i++ {
+		clicks = append(clicks, Click{Timestamp: start.Add(time.Duration(i) * time.Second), Referrer: fmt.Sprint(i)})
+	}
+	addClicks(t, "jl", clicks...)
+
+	rec := do("GET", "/shorturls/jl/clicks.jsonl", "")
+	wantStatus(t, rec, http.StatusOK)
+	if got := rec.Header().Get("Content-Type"); got != "application/x-ndjson" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	lines := strings.Split(strings.TrimSuffix(rec.Body.String(), "\n"), "\n")
+	if len(lines) != 150 {
+		t.Fatalf("%d lines, want 150", len(lines))
+	}
+	for i, line := range []string{lines[0], lines[149]} {
+		var click Click
+		if err := json.Unmarshal([]byte(line), &click); err != nil {
+			t.Fatalf("line %q: %v", line, err)
+		}
+		if want := fmt.Sprint(i * 149); click.Referrer != want {
+			t.Errorf("click referrer %q, want %s", click.Referrer, want)
+		}
+	}
+	wantStatus(t, do("GET", "/shorturls/missing/clicks.jsonl", ""), http.StatusNotFound)
+}
+
+func TestClickCount(t *testing.T) {
+	resetStore(t)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "cnt", TrackAnalytics: new(bool)})
+	for i := 0; i < 3; i++ {
+		wantStatus(t, do("GET", "/cnt", ""), http.StatusFound)
+	}
+
+	rec := do("GET", "/shorturls/cnt/count", "")
+	wantStatus(t, rec, http.StatusOK)
+	var response ClickCountResponse
+	decode(t, rec, &response)
+	if response.Clicks != 3 {
+		t.Errorf("clicks = %d, want 3", response.Clicks)
+	}
+
+	r := request("GET", "/shorturls/cnt/count", "")
+	r.Header.Set("Accept", "text/plain")
+	if got := serve(r).Body.String(); got != "3\n" {
+		t.Errorf("plain text count = %q", got)
+	}
+	wantStatus(t, do("GET", "/shorturls/missing/count", ""), http.StatusNotFound)
+}
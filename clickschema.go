@@ -0,0 +1,31 @@
+package main
+
+import "encoding/json"
+
+// clickSchemaVersion is the version of the Click format written in stats,
+// exports and click logs. Older payloads are upgraded as they are decoded:
+//
+//	1  no schemaVersion field, no bot tagging
+//	2  adds isBot
+//
+// Fields from newer versions are ignored rather than rejected.
+const clickSchemaVersion = 2
+
+// UnmarshalJSON decodes a click of any schema version into the current one,
+// filling in the fields that older versions lack
+func (c *Click) UnmarshalJSON(data []byte) error {
+	type plain Click
+	var decoded plain
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*c = Click(decoded)
+	if c.SchemaVersion < 1 {
+		c.SchemaVersion = 1
+	}
+	if c.SchemaVersion < 2 {
+		c.IsBot = isBotUserAgent(c.UserAgent)
+	}
+	c.SchemaVersion = clickSchemaVersion
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDecodeClickVersion1(t *testing.T) {
+	// Version 1 clicks have no schemaVersion and were never tagged as bots
+	var clicks []Click
+	payload := `[
+		{"timestamp": "2024-01-01T00:00:00Z", "userAgent": "` + googlebotUserAgent + `"},
+		{"timestamp": "2024-01-01T00:01:00Z", "userAgent": "` + browserUserAgent + `"}
+	]`
+	if err := json.Unmarshal([]byte(payload), &clicks); err != nil {
+		t.Fatal(err)
+	}
+	if !clicks[0].IsBot || clicks[1].IsBot {
+		t.Errorf("isBot not filled in from the user agent: %+v", clicks)
+	}
+	for _, click := range clicks {
+		if click.SchemaVersion != clickSchemaVersion || click.Timestamp.IsZero() {
+			t.Errorf("decoded %+v", click)
+		}
+	}
+}
+
+func TestDecodeClickCurrentVersion(t *testing.T) {
+	// A version 2 click keeps its own tagging, even if the patterns disagree
+	var click Click
+	payload := `{"schemaVersion": 2, "timestamp": "2024-01-01T00:00:00Z", "userAgent": "curl/8.5.0", "isBot": false}`
+	if err := json.Unmarshal([]byte(payload), &click); err != nil {
+		t.Fatal(err)
+	}
+	if click.IsBot {
+		t.Error("version 2 click re-tagged")
+	}
+
+	// Newer versions decode, ignoring fields this one does not know
+	payload = `{"schemaVersion": 3, "timestamp": "2024-01-01T00:00:00Z", "isBot": true, "deviceClass": "tv"}`
+	if err := json.Unmarshal([]byte(payload), &click); err != nil || !click.IsBot {
+		t.Errorf("newer click decoded as %+v, %v", click, err)
+	}
+	if err := json.Unmarshal([]byte(`{"timestamp": 7}`), &click); err == nil {
+		t.Error("malformed click accepted")
+	}
+}
+
+func TestClickSchemaVersionInStats(t *testing.T) {
+	resetStore(t)
+	set(t, &adminEnabled, true)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "ver"})
+	wantStatus(t, do("GET", "/ver", ""), http.StatusFound)
+	wantStatus(t, do("POST", "/shorturls/ver/clicks/import",
+		`[{"timestamp": "2024-01-01T00:00:00Z", "userAgent": "`+googlebotUserAgent+`"}]`), http.StatusOK)
+
+	rec := do("GET", "/shorturls/ver", "")
+	wantStatus(t, rec, http.StatusOK)
+	if n := strings.Count(rec.Body.String(), `"schemaVersion":2`); n != 2 {
+		t.Errorf("%d clicks written with schemaVersion 2, want 2:\n%s", n, rec.Body)
+	}
+	stats, _ := GetStats("ver", clickPage{})
+	if stats.HumanClicks != 1 || stats.BotClicks != 1 {
+		t.Errorf("human %d, bot %d; want the imported version 1 click counted as a bot", stats.HumanClicks, stats.BotClicks)
+	}
+}
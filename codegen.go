@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/speps/go-hashids"
+)
+
+// codeGenerator selects how shortcodes are generated: "hashids" (the default),
+// "seq" for short sequential base62 codes or "deterministic" to derive the
+// code from the destination URL
+var codeGenerator = "hashids"
+
+// hashidsSalt salts the hashids generator
+var hashidsSalt = "url-shortener-salt"
+
+// codeSequence is the last value handed out by the sequential generator. It
+// only ever grows, so codes are never reused even after a flush, and exports
+// carry it to the instance they are imported into.
+var codeSequence atomic.Uint64
+
+const base62Alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// generateShortCode produces a candidate shortcode with the configured
+// generator. Candidates may collide, so callers that need a fresh code retry
+// with increasing attempt numbers.
+func generateShortCode(destination string, attempt int) string {
+	switch codeGenerator {
+	case "seq":
+		return sequentialCode(codeSequence.Add(1))
+	case "deterministic":
+		return deterministicCode(destination, attempt)
+	}
+	return hashidsCode(attempt)
+}
+
+// deterministicCode hashes the normalized destination into a base62 code, so
+// the same URL always yields the same first candidate. Distinct URLs that
+// hash alike are separated by attempt, which is mixed into the hash.
+func deterministicCode(destination string, attempt int) string {
+	input := normalizeURL(destination)
+	if attempt > 0 {
+		input += "\x00" + strconv.Itoa(attempt)
+	}
+	sum := sha256.Sum256([]byte(input))
+	// 40 bits give seven-character codes with room to spare
+	return sequentialCode(binary.BigEndian.Uint64(sum[:8])>>24 + 1)
+}
+
+// deterministicMatch returns the live link the deterministic generator
+// already issued for destination under prefix, following the same candidate
+// sequence as uniqueShortCode. The caller must hold storeLock.
+func deterministicMatch(prefix, destination string, now time.Time) (ShortURL, bool) {
+	if codeGenerator != "deterministic" {
+		return ShortURL{}, false
+	}
+	want := normalizeURL(destination)
+	for attempt := 0; ; attempt++ {
+		code := prefix + deterministicCode(destination, attempt)
+		url, exists := urlStore[code]
+		_, rotated := tombstones[code]
+		if !exists && !rotated && !retiredCodes[code] && !isReservedCode(code) {
+			return ShortURL{}, false
+		}
+		if exists && normalizeURL(url.OriginalURL) == want && url.IsActive && now.Before(url.ExpiresAt) {
+			return url, true
+		}
+	}
+}
+
+// hashidsCode derives a shortcode from the current time. Codes generated
+// within the same second collide unless attempt differs.
+func hashidsCode(attempt int) string {
+	hd := hashids.NewData()
+	hd.Salt = hashidsSalt
+	hd.MinLength = 5
+	h, _ := hashids.NewWithData(hd)
+	numbers := []int{int(time.Now().Unix())}
+	if attempt > 0 {
+		numbers = append(numbers, attempt)
+	}
+	code, _ := h.Encode(numbers)
+	return code
+}
+
+// uniqueShortCode generates a code for destination, starting with prefix,
+// that is neither stored, pooled nor reserved. The caller must hold storeLock.
+func uniqueShortCode(prefix, destination string) string {
+	code, _ := nextUniqueCode(prefix, destination, 0)
+	return code
+}
+
+// nextUniqueCode is uniqueShortCode trying candidates from attempt on. It
+// also returns the attempt that gave the code, so callers generating many
+// codes in a row can carry on from there instead of retrying every candidate
+// they already took. The caller must hold storeLock.
+func nextUniqueCode(prefix, destination string, attempt int) (string, int) {
+	for ; ; attempt++ {
+		code := prefix + generateShortCode(destination, attempt)
+		_, exists := urlStore[code]
+		_, rotated := tombstones[code]
+		if !exists && !rotated && !retiredCodes[code] && !pooledCodes[code] && !isReservedCode(code) {
+			return code, attempt
+		}
+	}
+}
+
+// sequentialCode encodes n >= 1 in bijective base62, giving the sequence
+// a, b, ..., 9, aa, ab, ... with no padding
+func sequentialCode(n uint64) string {
+	var buf []byte
+	for n > 0 {
+		n--
+		buf = append(buf, base62Alphabet[n%62])
+		n /= 62
+	}
+	for i, j := 0, len(buf)-1; i < j; i, j = i+1, j-1 {
+		buf[i], buf[j] = buf[j], buf[i]
+	}
+	return string(buf)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSequentialCode(t *testing.T) {
+	tests := map[uint64]string{1: "a", 2: "b", 26: "z", 27: "A", 62: "9", 63: "aa", 64: "ab", 62 + 62*62: "99", 62 + 62*62 + 1: "aaa"}
+	for n, want := range tests {
+		if got := sequentialCode(n); got != want {
+			t.Errorf("sequentialCode(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestSequentialGeneratorSkipsTakenCodes(t *testing.T) {
+	resetStore(t)
+	set(t, &codeGenerator, "seq")
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "b"})
+
+	var codes []string
+	for i := 0; i < 3; i++ {
+		codes = append(codes, mustCreate(t, ShortURLRequest{URL: "https://example.com"}).ShortCode)
+	}
+	if got := strings.Join(codes, ","); got != "a,c,d" {
+		t.Errorf("codes = %s, want a,c,d", got)
+	}
+}
+
+func TestSequenceSurvivesExportImport(t *testing.T) {
+	resetStore(t)
+	set(t, &codeGenerator, "seq")
+	set(t, &adminEnabled, true)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com/1"})
+	mustCreate(t, ShortURLRequest{URL: "https://example.com/2"})
+	rec := do("GET", "/admin/export", "")
+	wantStatus(t, rec, http.StatusOK)
+	var doc ExportDocument
+	decode(t, rec, &doc)
+	if doc.CodeSequence != 2 {
+		t.Fatalf("exported codeSequence = %d, want 2", doc.CodeSequence)
+	}
+
+	// A fresh instance picks up after the exported codes, even once the
+	// links themselves are gone
+	resetStore(t)
+	wantStatus(t, do("POST", "/admin/import", rec.Body.String()), http.StatusOK)
+	wantStatus(t, do("POST", "/admin/flush", ""), http.StatusOK)
+	if code := mustCreate(t, ShortURLRequest{URL: "https://example.com/3"}).ShortCode; code != "c" {
+		t.Errorf("next code after import = %q, want c", code)
+	}
+
+	// An older document never winds the sequence back
+	wantStatus(t, do("POST", "/admin/import", `{"codeSequence": 1}`), http.StatusOK)
+	if got := codeSequence.Load(); got != 3 {
+		t.Errorf("codeSequence = %d after importing an older one, want 3", got)
+	}
+}
+
+func TestDeterministicCodes(t *testing.T) {
+	resetStore(t)
+	set(t, &codeGenerator, "deterministic")
+
+	first := mustCreate(t, ShortURLRequest{URL: "https://example.com/page"})
+	again := mustCreate(t, ShortURLRequest{URL: "https://EXAMPLE.com:443/page"})
+	other := mustCreate(t, ShortURLRequest{URL: "https://example.com/other"})
+	if first.ShortCode != again.ShortCode {
+		t.Errorf("identical URLs got %q and %q", first.ShortCode, again.ShortCode)
+	}
+	if first.ShortCode != deterministicCode("https://example.com/page", 0) {
+		t.Errorf("code %q is not derived from the URL", first.ShortCode)
+	}
+	if other.ShortCode == first.ShortCode {
+		t.Error("different URLs share a code")
+	}
+	if n := len(urlStore); n != 2 {
+		t.Errorf("%d links stored, want the repeat to reuse the first", n)
+	}
+}
+
+func TestDeterministicCodeCollision(t *testing.T) {
+	resetStore(t)
+	set(t, &codeGenerator, "deterministic")
+	// Another URL already holds the first candidate
+	taken := deterministicCode("https://example.com/page", 0)
+	mustCreate(t, ShortURLRequest{URL: "https://example.org/squatter", Shortcode: taken})
+
+	url := mustCreate(t, ShortURLRequest{URL: "https://example.com/page"})
+	if want := deterministicCode("https://example.com/page", 1); url.ShortCode != want {
+		t.Errorf("code = %q, want the second candidate %q", url.ShortCode, want)
+	}
+	if again := mustCreate(t, ShortURLRequest{URL: "https://example.com/page"}); again.ShortCode != url.ShortCode {
+		t.Errorf("repeat got %q, want %q past the collision", again.ShortCode, url.ShortCode)
+	}
+	rec := do("GET", "/shorturls/"+taken+"/info", "")
+	var stored ShortURL
+	decode(t, rec, &stored)
+	if stored.OriginalURL != "https://example.org/squatter" {
+		t.Errorf("colliding link now points at %s", stored.OriginalURL)
+	}
+}
+
+func TestDeterministicCodeAfterRotation(t *testing.T) {
+	resetStore(t)
+	set(t, &codeGenerator, "deterministic")
+	first := mustCreate(t, ShortURLRequest{URL: "https://example.com/page"})
+	rotated := rotate(t, first.ShortCode, "")
+
+	// The rotated-out code stays retired; the repeat finds the new code
+	again := mustCreate(t, ShortURLRequest{URL: "https://example.com/page"})
+	if again.ShortCode != rotated.ShortCode {
+		t.Errorf("repeat got %q, want the rotated code %q", again.ShortCode, rotated.ShortCode)
+	}
+	wantStatus(t, do("GET", "/"+first.ShortCode, ""), http.StatusNotFound)
+
+	// Even once the link is gone the old code is not handed out again
+	storeLock.Lock()
+	delete(urlStore, rotated.ShortCode)
+	storeLock.Unlock()
+	if fresh := mustCreate(t, ShortURLRequest{URL: "https://example.com/page"}); fresh.ShortCode == first.ShortCode {
+		t.Errorf("retired code %q reissued", first.ShortCode)
+	}
+}
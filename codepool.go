@@ -0,0 +1,71 @@
+package main
+
+import "time"
+
+// codePoolSize is how many generated codes are kept ready for new links, so
+// creation does not pay for generation. 0 disables the pool.
+var codePoolSize int
+
+// codePool holds the ready codes. It is nil when the pool is disabled.
+var codePool chan string
+
+// pooledCodes tracks the codes sitting in codePool so that neither the pool
+// nor on-demand generation hands one out twice. It is guarded by storeLock.
+var pooledCodes = make(map[string]bool)
+
+// startCodePool starts filling the pool in the background until stop is
+// closed. Deterministic codes depend on the URL, so they are never pooled.
+func startCodePool(stop <-chan struct{}) {
+	if codePoolSize <= 0 || codeGenerator == "deterministic" {
+		return
+	}
+	codePool = make(chan string, codePoolSize)
+	go fillCodePool(codePool, stop)
+}
+
+// fillCodePool keeps pool topped up, blocking while it is full
+func fillCodePool(pool chan<- string, stop <-chan struct{}) {
+	// Codes pooled within the same second would otherwise have every hashids
+	// candidate before them retried, making a fill quadratic in the pool size
+	attempt, second := 0, time.Now().Unix()
+	for {
+		if now := time.Now().Unix(); now != second {
+			attempt, second = 0, now
+		}
+		storeLock.Lock()
+		code, used := nextUniqueCode("", "", attempt)
+		pooledCodes[code] = true
+		storeLock.Unlock()
+		attempt = used + 1
+
+		select {
+		case pool <- code:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// takePooledCode pops a ready code, reporting false when the pool is empty
+// or disabled. Pooled codes carry no prefix, so tenants generate on demand.
+// Codes claimed as custom shortcodes or retired since they were pooled are
+// discarded.
+// The caller must hold storeLock.
+func takePooledCode(tenant string) (string, bool) {
+	if tenant != "" {
+		return "", false
+	}
+	for {
+		select {
+		case code := <-codePool:
+			delete(pooledCodes, code)
+			_, exists := urlStore[code]
+			_, rotated := tombstones[code]
+			if !exists && !rotated && !retiredCodes[code] && !isReservedCode(code) {
+				return code, true
+			}
+		default:
+			return "", false
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// runCodePool fills a pool of size for the rest of the test, the way
+// startCodePool does but waiting for the filler to stop afterwards
+func runCodePool(t *testing.T, size int) {
+	t.Helper()
+	stop, done := make(chan struct{}), make(chan struct{})
+	codePool = make(chan string, size)
+	go func() {
+		fillCodePool(codePool, stop)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		close(stop)
+		<-done
+		codePool = nil
+	})
+}
+
+// waitForPool waits until the pool holds n codes
+func waitForPool(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for len(codePool) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("pool holds %d codes, want %d", len(codePool), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCodePoolRefills(t *testing.T) {
+	resetStore(t)
+	set(t, &codeGenerator, "seq")
+	runCodePool(t, 5)
+	waitForPool(t, 5)
+
+	seen := make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		code := mustCreate(t, ShortURLRequest{URL: "https://example.com"}).ShortCode
+		if seen[code] {
+			t.Fatalf("code %q handed out twice", code)
+		}
+		seen[code] = true
+	}
+	// The pool tops itself back up with codes nobody holds
+	waitForPool(t, 5)
+	storeLock.RLock()
+	defer storeLock.RUnlock()
+	if len(pooledCodes) < 5 {
+		t.Errorf("%d pooled codes tracked, want at least 5", len(pooledCodes))
+	}
+	for code := range pooledCodes {
+		if _, taken := urlStore[code]; taken || seen[code] {
+			t.Errorf("pooled code %q is already in use", code)
+		}
+	}
+}
+
+func TestCodePoolSkipsClaimedCodes(t *testing.T) {
+	resetStore(t)
+	set(t, &codeGenerator, "seq")
+	runCodePool(t, 3)
+	waitForPool(t, 3)
+
+	// Sequential codes are pooled in order, so "a" is next out of the pool
+	mustCreate(t, ShortURLRequest{URL: "https://example.com/custom", Shortcode: "a"})
+	url := mustCreate(t, ShortURLRequest{URL: "https://example.com/generated"})
+	if url.ShortCode == "a" {
+		t.Fatal("pool handed out a code claimed as a custom shortcode")
+	}
+	if stored, _ := Resolve("a"); stored.OriginalURL != "https://example.com/custom" {
+		t.Errorf("custom link overwritten: %+v", stored)
+	}
+}
+
+func TestCodePoolSkipsRetiredCodes(t *testing.T) {
+	resetStore(t)
+	set(t, &codeGenerator, "seq")
+	runCodePool(t, 3)
+	waitForPool(t, 3)
+
+	// An import can retire a code while it sits in the pool
+	storeLock.Lock()
+	retiredCodes["a"] = true
+	storeLock.Unlock()
+	if url := mustCreate(t, ShortURLRequest{URL: "https://example.com"}); url.ShortCode == "a" {
+		t.Error("pool handed out a retired code")
+	}
+}
+
+func TestCodePoolDisabled(t *testing.T) {
+	resetStore(t)
+	set(t, &codeGenerator, "deterministic")
+	set(t, &codePoolSize, 5)
+	startCodePool(make(chan struct{}))
+	if codePool != nil {
+		t.Error("deterministic codes are pooled")
+	}
+	if _, ok := takePooledCode(""); ok {
+		t.Error("took a code from a disabled pool")
+	}
+	if code := mustCreate(t, ShortURLRequest{URL: "https://example.com"}).ShortCode; code == "" {
+		t.Error("no code generated without a pool")
+	}
+}
+
+func TestNextUniqueCodeCarriesOn(t *testing.T) {
+	resetStore(t)
+	set(t, &codeGenerator, "deterministic")
+	storeLock.Lock()
+	defer storeLock.Unlock()
+	code, attempt := nextUniqueCode("", "", 0)
+	pooledCodes[code] = true
+	next, nextAttempt := nextUniqueCode("", "", attempt+1)
+	if next == code || nextAttempt != attempt+1 {
+		t.Errorf("carrying on gave %q at attempt %d after %q at %d", next, nextAttempt, code, attempt)
+	}
+}
+
+func TestCodePoolFillsLargePool(t *testing.T) {
+	resetStore(t)
+	set(t, &codeGenerator, "hashids")
+	// Retrying every earlier candidate for each code would take far longer
+	runCodePool(t, 3000)
+	waitForPool(t, 3000)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// Compaction settings, populated from the environment in main
+var (
+	compactionInterval  = 10 * time.Minute
+	compactionThreshold = 0.5
+)
+
+// runCompaction periodically compacts the store until stop is closed
+func runCompaction(stop <-chan struct{}) {
+	ticker := time.NewTicker(compactionInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if removed := compactStore(compactionThreshold); removed > 0 {
+				log.Printf("Compacted store, dropped %d stale analytics entries", removed)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// compactStore rebuilds the store maps into fresh ones when the fraction of
+// analytics entries that are empty or belong to no stored URL exceeds
+// threshold. Go maps never shrink, so after many removals rebuilding is the
+// only way to release their memory. It returns the number of entries dropped.
+func compactStore(threshold float64) int {
+	storeLock.Lock()
+	defer storeLock.Unlock()
+
+	if len(analytics) == 0 {
+		return 0
+	}
+	stale := 0
+	for code, clicks := range analytics {
+		if _, exists := urlStore[code]; !exists || clicks.Len() == 0 {
+			stale++
+		}
+	}
+	if float64(stale)/float64(len(analytics)) <= threshold {
+		return 0
+	}
+
+	freshStore := make(map[string]ShortURL, len(urlStore))
+	freshAnalytics := make(map[string]*clickLog, len(analytics)-stale)
+	freshCounts := make(map[string]*atomic.Int64, len(clickCounts))
+	freshBotCounts := make(map[string]*atomic.Int64, len(botClickCounts))
+	freshRollups := make(map[string][]DailyStat, len(rollups))
+	for code, url := range urlStore {
+		freshStore[code] = url
+		if clicks := analytics[code]; clicks.Len() > 0 {
+			freshAnalytics[code] = clicks
+		}
+		if count, ok := clickCounts[code]; ok {
+			freshCounts[code] = count
+		}
+		if count, ok := botClickCounts[code]; ok {
+			freshBotCounts[code] = count
+		}
+		if days, ok := rollups[code]; ok {
+			freshRollups[code] = days
+		}
+	}
+	urlStore, analytics, clickCounts, botClickCounts, rollups = freshStore, freshAnalytics, freshCounts, freshBotCounts, freshRollups
+	return stale
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCompactStore(t *testing.T) {
+	resetStore(t)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "kept"})
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "idle"})
+	wantStatus(t, do("GET", "/kept", ""), http.StatusFound)
+	storeLock.Lock()
+	analytics["gone1"] = newClickLog([]Click{{}})
+	analytics["gone2"] = newClickLog([]Click{{}})
+	storeLock.Unlock()
+
+	// idle, gone1 and gone2 are stale: 3 of 4 entries
+	if removed := compactStore(0.8); removed != 0 {
+		t.Fatalf("compacted %d entries below the threshold", removed)
+	}
+	if removed := compactStore(0.5); removed != 3 {
+		t.Fatalf("compactStore removed %d entries, want 3", removed)
+	}
+
+	storeLock.RLock()
+	if len(urlStore) != 2 || len(analytics) != 1 || analytics["kept"].Len() != 1 {
+		t.Errorf("after compaction: %d URLs, analytics %v", len(urlStore), analytics)
+	}
+	storeLock.RUnlock()
+	if getStats(t, "kept").TotalClicks != 1 {
+		t.Errorf("click count lost in compaction")
+	}
+}
+
+func TestCompactEmptyStore(t *testing.T) {
+	resetStore(t)
+	if removed := compactStore(0); removed != 0 {
+		t.Errorf("compactStore on an empty store removed %d", removed)
+	}
+}
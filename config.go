@@ -0,0 +1,365 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxURLs caps the number of live stored links; 0 means unlimited
+var maxURLs int
+
+// allowGetCreate registers GET /shorturls/create for legacy clients
+var allowGetCreate bool
+
+// tlsCertFile and tlsKeyFile enable HTTPS when both are set
+var tlsCertFile, tlsKeyFile string
+
+// port is the TCP port the server listens on
+var port = "8080"
+
+// readTimeout, writeTimeout and idleTimeout bound how long a client may take
+// to send a request, receive the response and hold an idle keep-alive
+// connection, so slow clients cannot tie up the server
+var (
+	readTimeout  = 10 * time.Second
+	writeTimeout = 30 * time.Second
+	idleTimeout  = 120 * time.Second
+)
+
+// routePrefix mounts the API and short links under a path such as "/s",
+// for running behind a reverse proxy. It is empty or starts with "/".
+var routePrefix string
+
+// loadConfig reads the optional tunables from the environment, falling back
+// to the JSON file named by CONFIG_FILE for anything the environment leaves
+// unset. Unknown keys in the file are rejected.
+func loadConfig() {
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		settings, err := readConfigFile(path)
+		if err != nil {
+			log.Fatalf("Invalid CONFIG_FILE: %v", err)
+		}
+		fileSettings = settings
+	}
+
+	if v := setting("PORT"); v != "" {
+		port = v
+	}
+	if v := strings.Trim(setting("ROUTE_PREFIX"), "/"); v != "" {
+		routePrefix = "/" + v
+	}
+	if v := setting("HASHIDS_SALT"); v != "" {
+		hashidsSalt = v
+	}
+	adminEnabled = envBool("ADMIN_ENABLED")
+	adminKey = setting("ADMIN_KEY")
+	if keys := envList("API_KEYS"); len(keys) > 0 {
+		tenants, err := parseAPIKeys(keys)
+		if err != nil {
+			log.Fatalf("Invalid API_KEYS: %v", err)
+		}
+		apiKeyTenants = tenants
+	}
+	logBodies = envBool("LOG_BODIES")
+	serverTiming = envBool("SERVER_TIMING")
+	prettyJSON = envBool("PRETTY_JSON")
+	problemJSON = envBool("PROBLEM_JSON")
+	logBodyLimit = envInt("LOG_BODY_LIMIT", logBodyLimit)
+	if v := setting("LOG_LEVEL"); v != "" {
+		level, err := parseLogLevel(v)
+		if err != nil {
+			log.Fatalf("Invalid LOG_LEVEL: %v", err)
+		}
+		logMinLevel = level
+	}
+	routes, err := parseRouteLevels(setting("LOG_ROUTE_LEVELS"))
+	if err != nil {
+		log.Fatalf("Invalid LOG_ROUTE_LEVELS: %v", err)
+	}
+	logRoutes = routes
+	reservedCodes = envList("RESERVED_CODES")
+	maxURLs = envInt("MAX_URLS", 0)
+	maxValidity.Store(int64(envDuration("MAX_VALIDITY", 0)))
+	clickSampleRate = envFloat("CLICK_SAMPLE_RATE", clickSampleRate)
+	if clickSampleRate < 0 || clickSampleRate > 1 {
+		log.Fatalf("Invalid CLICK_SAMPLE_RATE %v", clickSampleRate)
+	}
+	switch v := setting("EVICTION_POLICY"); v {
+	case "":
+	case "reject", "lru", "earliest-expiry":
+		evictionPolicy = v
+	default:
+		log.Fatalf("Invalid EVICTION_POLICY %q", v)
+	}
+	redirectAllowlist = envList("REDIRECT_ALLOWLIST")
+	switch v := setting("DEFAULT_URL_SCHEME"); v {
+	case "":
+	case "http", "https":
+		defaultScheme = v
+	default:
+		log.Fatalf("Invalid DEFAULT_URL_SCHEME %q", v)
+	}
+	domains := blockedShortenerList(envList("BLOCKED_SHORTENER_DOMAINS"))
+	blockedShortenerDomains.Store(&domains)
+	if v := setting("REDIRECT_MODE"); v != "" {
+		if !validRedirectMode(v) {
+			log.Fatalf("Invalid REDIRECT_MODE %q", v)
+		}
+		redirectMode = v
+	}
+	if v := setting("EXPIRED_TEMPLATE"); v != "" {
+		loadExpiredTemplate(v)
+	}
+	if v := setting("ROBOTS_TXT_FILE"); v != "" {
+		loadRobotsTxt(v)
+	}
+	if v := setting("LEGAL_BLOCK_NOTICE"); v != "" {
+		legalBlockNotice = v
+	}
+	if v := setting("EXPIRED_MESSAGE"); v != "" {
+		expiredMessage = v
+	}
+	clickRetention = envDuration("CLICK_RETENTION", 0)
+	clickRetentionInterval = envDuration("CLICK_RETENTION_INTERVAL", clickRetentionInterval)
+	rollupInterval = envDuration("ROLLUP_INTERVAL", rollupInterval)
+	inactivityReapInterval = envDuration("INACTIVITY_REAP_INTERVAL", inactivityReapInterval)
+	clickBatchSize = envInt("CLICK_BATCH_SIZE", 0)
+	clickBatchInterval = envDuration("CLICK_BATCH_INTERVAL", clickBatchInterval)
+	compactionInterval = envDuration("COMPACTION_INTERVAL", compactionInterval)
+	compactionThreshold = envFloat("COMPACTION_THRESHOLD", compactionThreshold)
+	drainDelay = time.Duration(envInt("DRAIN_DELAY", 0)) * time.Second
+	readTimeout = envDuration("READ_TIMEOUT", readTimeout)
+	writeTimeout = envDuration("WRITE_TIMEOUT", writeTimeout)
+	idleTimeout = envDuration("IDLE_TIMEOUT", idleTimeout)
+	codePoolSize = envInt("CODE_POOL_SIZE", 0)
+	switch v := setting("CODE_GENERATOR"); v {
+	case "":
+	case "hashids", "seq", "deterministic":
+		codeGenerator = v
+	default:
+		log.Fatalf("Invalid CODE_GENERATOR %q", v)
+	}
+	rateLimitRequests = envInt("RATE_LIMIT", 0)
+	rateLimitWindow = envDuration("RATE_LIMIT_WINDOW", rateLimitWindow)
+	rateLimitJitter = envDuration("RATE_LIMIT_JITTER", rateLimitJitter)
+	redirectRateLimit = envFloat("REDIRECT_RATE_LIMIT", 0)
+	creationLimiter = newRateLimiter(rateLimitRequests, rateLimitWindow)
+	allowGetCreate = envBool("ALLOW_GET_CREATE")
+	fetchFavicon = envBool("FETCH_FAVICON")
+	faviconTimeout = envDuration("FAVICON_TIMEOUT", faviconTimeout)
+	maintenanceMode.Store(envBool("MAINTENANCE"))
+	analyticsPaused.Store(envBool("ANALYTICS_PAUSED"))
+	stripTrailingSlash = envBool("STRIP_TRAILING_SLASH")
+	forceHTTPS = envBool("FORCE_HTTPS")
+	ranges, err := parseCIDRs(envList("DATACENTER_RANGES"))
+	if err != nil {
+		log.Fatalf("Invalid DATACENTER_RANGES: %v", err)
+	}
+	datacenterRanges = ranges
+	excludeFraudClicks = envBool("EXCLUDE_FRAUD_CLICKS")
+	auditLogFile, auditWebhookURL = setting("AUDIT_LOG_FILE"), setting("AUDIT_WEBHOOK_URL")
+	if auditLogFile != "" && auditWebhookURL != "" {
+		log.Fatal("Set only one of AUDIT_LOG_FILE and AUDIT_WEBHOOK_URL")
+	}
+	auditQueueSize = envInt("AUDIT_QUEUE_SIZE", auditQueueSize)
+	auditWebhookTimeout = envDuration("AUDIT_WEBHOOK_TIMEOUT", auditWebhookTimeout)
+	if patterns := envList("BOT_PATTERNS"); len(patterns) > 0 {
+		pattern, err := parseBotPatterns(patterns)
+		if err != nil {
+			log.Fatalf("Invalid BOT_PATTERNS: %v", err)
+		}
+		botPattern = pattern
+	}
+	countBotClicks = envBool("COUNT_BOT_CLICKS")
+	canonicalHost = setting("CANONICAL_HOST")
+	hstsMaxAge = envInt("HSTS_MAX_AGE", hstsMaxAge)
+	metricsTopCodes = envInt("METRICS_TOP_CODES", metricsTopCodes)
+	instanceID = setting("INSTANCE_ID")
+	if instanceID == "" {
+		instanceID = defaultInstanceID()
+	}
+
+	tlsCertFile, tlsKeyFile = setting("TLS_CERT"), setting("TLS_KEY")
+	if (tlsCertFile == "") != (tlsKeyFile == "") {
+		log.Fatal("TLS_CERT and TLS_KEY must be set together")
+	}
+	for _, file := range []string{tlsCertFile, tlsKeyFile} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			log.Fatalf("Invalid TLS file: %v", err)
+		}
+	}
+	switch v := setting("IP_ANONYMIZATION"); v {
+	case "":
+	case "none", "truncate", "hash":
+		ipAnonymization = v
+	default:
+		log.Fatalf("Invalid IP_ANONYMIZATION %q", v)
+	}
+	ipHashSalt = []byte(setting("IP_HASH_SALT"))
+	// Without a secret salt the whole IPv4 space can be hashed and reversed
+	if ipAnonymization == "hash" && len(ipHashSalt) == 0 {
+		log.Fatal("IP_ANONYMIZATION=hash requires IP_HASH_SALT")
+	}
+	if path := setting("GEOIP_DB"); path != "" {
+		openGeoDB(path)
+	}
+	signingSecret = []byte(setting("SIGNING_SECRET"))
+	configuredBaseURL = strings.TrimSuffix(setting("BASE_URL"), "/")
+	switch v := setting("NESTED_LINKS"); v {
+	case "", "reject":
+	case "resolve":
+		resolveNestedLinks = true
+	default:
+		log.Fatalf("Invalid NESTED_LINKS %q", v)
+	}
+	if pattern := setting("SELF_URL_PATTERN"); pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			log.Fatalf("Invalid SELF_URL_PATTERN: %v", err)
+		}
+		selfURLPattern = re
+	}
+	if size := envInt("REDIRECT_CACHE_SIZE", 0); size > 0 {
+		redirectCache = newLRUCache(size)
+	}
+
+	for name := range fileSettings {
+		if !knownSettings[name] {
+			log.Fatalf("Invalid CONFIG_FILE: unknown setting %q", strings.ToLower(name))
+		}
+	}
+}
+
+// fileSettings holds the values read from CONFIG_FILE, keyed by the upper-case
+// name of the environment variable they stand in for
+var fileSettings map[string]string
+
+// knownSettings records every setting loadConfig reads, so that unknown keys
+// in the config file can be reported
+var knownSettings = make(map[string]bool)
+
+// setting returns the value of the named tunable, preferring the environment
+// over the config file
+func setting(name string) string {
+	knownSettings[name] = true
+	if v, ok := os.LookupEnv(name); ok {
+		return v
+	}
+	return fileSettings[name]
+}
+
+// readConfigFile parses a JSON object of settings such as
+// {"port": 8080, "max_urls": 1000, "reserved_codes": ["api", "help"]}.
+// Keys are the environment variable names in any case; arrays become
+// comma-separated lists.
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	settings := make(map[string]string, len(raw))
+	for key, value := range raw {
+		s, err := settingString(value)
+		if err != nil {
+			return nil, fmt.Errorf("setting %q: %v", key, err)
+		}
+		settings[strings.ToUpper(key)] = s
+	}
+	return settings, nil
+}
+
+func settingString(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			s, err := settingString(item)
+			if err != nil {
+				return "", err
+			}
+			items[i] = s
+		}
+		return strings.Join(items, ","), nil
+	}
+	return "", fmt.Errorf("unsupported value %v", value)
+}
+
+// blockedShortenerList resolves BLOCKED_SHORTENER_DOMAINS, which replaces
+// the default list when set; "none" empties it
+func blockedShortenerList(list []string) []string {
+	switch {
+	case len(list) == 1 && list[0] == "none":
+		return nil
+	case len(list) > 0:
+		return list
+	}
+	return defaultBlockedShortenerDomains
+}
+
+// envBool reports whether the named setting is set to a true value
+func envBool(name string) bool {
+	v, err := strconv.ParseBool(setting(name))
+	return err == nil && v
+}
+
+// envInt parses the named setting as an integer, falling back to
+// def when it is unset or malformed
+func envInt(name string, def int) int {
+	v, err := strconv.Atoi(setting(name))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// envList splits the named comma-separated setting, dropping
+// blank entries
+func envList(name string) []string {
+	var list []string
+	for _, item := range strings.Split(setting(name), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// envFloat parses the named setting as a float, falling back to
+// def when it is unset or malformed
+func envFloat(name string, def float64) float64 {
+	v, err := strconv.ParseFloat(setting(name), 64)
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// envDuration parses the named setting as a duration such as
+// "90s" or "10m", falling back to def when it is unset or malformed
+func envDuration(name string, def time.Duration) time.Duration {
+	v, err := time.ParseDuration(setting(name))
+	if err != nil {
+		return def
+	}
+	return v
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadConfigFile(t *testing.T) {
+	path := writeConfigFile(t, `{"port": 9090, "max_urls": 1000, "Admin_Enabled": true,
+		"reserved_codes": ["api", "help"], "click_sample_rate": 0.25, "base_url": "https://sho.rt"}`)
+	settings, err := readConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"PORT":              "9090",
+		"MAX_URLS":          "1000",
+		"ADMIN_ENABLED":     "true",
+		"RESERVED_CODES":    "api,help",
+		"CLICK_SAMPLE_RATE": "0.25",
+		"BASE_URL":          "https://sho.rt",
+	}
+	if len(settings) != len(want) {
+		t.Errorf("settings = %v", settings)
+	}
+	for key, value := range want {
+		if settings[key] != value {
+			t.Errorf("%s = %q, want %q", key, settings[key], value)
+		}
+	}
+}
+
+func TestReadConfigFileErrors(t *testing.T) {
+	for _, content := range []string{`not json`, `{"port": null}`, `{"api_keys": {"a": "b"}}`, `["port"]`} {
+		if _, err := readConfigFile(writeConfigFile(t, content)); err == nil {
+			t.Errorf("readConfigFile(%s) succeeded", content)
+		}
+	}
+	if _, err := readConfigFile(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("missing file accepted")
+	}
+}
+
+func TestSettingPrefersEnvironment(t *testing.T) {
+	set(t, &fileSettings, map[string]string{"TEST_SETTING": "file", "TEST_FILE_ONLY": "file"})
+	t.Setenv("TEST_SETTING", "env")
+	if got := setting("TEST_SETTING"); got != "env" {
+		t.Errorf("setting = %q, want the environment value", got)
+	}
+	if got := setting("TEST_FILE_ONLY"); got != "file" {
+		t.Errorf("setting = %q, want the file value", got)
+	}
+	// Set but empty in the environment still overrides the file
+	t.Setenv("TEST_FILE_ONLY", "")
+	if got := setting("TEST_FILE_ONLY"); got != "" {
+		t.Errorf("setting = %q, want the empty environment value", got)
+	}
+	if !knownSettings["TEST_SETTING"] {
+		t.Error("setting did not record the name as known")
+	}
+}
+
+func TestEnvHelpers(t *testing.T) {
+	set(t, &fileSettings, map[string]string{
+		"T_BOOL": "yes", "T_INT": "12", "T_BADINT": "twelve",
+		"T_LIST": " a, ,b ,", "T_FLOAT": "0.5", "T_DURATION": "90s",
+	})
+	if envBool("T_BOOL") {
+		t.Error(`envBool("yes") = true, want only strconv.ParseBool values`)
+	}
+	if got := envInt("T_INT", 1); got != 12 {
+		t.Errorf("envInt = %d", got)
+	}
+	if got := envInt("T_BADINT", 1); got != 1 {
+		t.Errorf("envInt of a malformed value = %d, want the default", got)
+	}
+	if got := envList("T_LIST"); len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Errorf("envList = %q", got)
+	}
+	if got := envFloat("T_FLOAT", 1); got != 0.5 {
+		t.Errorf("envFloat = %g", got)
+	}
+	if got := envDuration("T_DURATION", 0); got.Seconds() != 90 {
+		t.Errorf("envDuration = %v", got)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import "sync/atomic"
+
+// countClicks adds n to the click total of code. The caller must hold
+// storeLock for writing, since the counter may not exist yet.
+func countClicks(code string, n int) {
+	addCount(clickCounts, code, n)
+}
+
+// countBots adds n to the bot click total of code. The caller must hold
+// storeLock for writing.
+func countBots(code string, n int) {
+	addCount(botClickCounts, code, n)
+}
+
+// addCount adds n to the counter for code in counts, creating it if needed
+func addCount(counts map[string]*atomic.Int64, code string, n int) {
+	counter, ok := counts[code]
+	if !ok {
+		counter = new(atomic.Int64)
+		counts[code] = counter
+	}
+	counter.Add(int64(n))
+}
+
+// clickTotal returns the number of redirects through code. The caller must
+// hold storeLock.
+func clickTotal(code string) int {
+	if counter, ok := clickCounts[code]; ok {
+		return int(counter.Load())
+	}
+	return 0
+}
+
+// botTotal returns how many of the redirects through code came from bots.
+// The caller must hold storeLock.
+func botTotal(code string) int {
+	if counter, ok := botClickCounts[code]; ok {
+		return min(int(counter.Load()), clickTotal(code))
+	}
+	return 0
+}
+
+// reportedClicks returns the click total the stats report for code, which
+// leaves bots out unless COUNT_BOT_CLICKS is set. The caller must hold
+// storeLock.
+func reportedClicks(code string) int {
+	if countBotClicks {
+		return clickTotal(code)
+	}
+	return clickTotal(code) - botTotal(code)
+}
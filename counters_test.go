@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClickCounters(t *testing.T) {
+	resetStore(t)
+	if clickTotal("none") != 0 {
+		t.Error("unknown code has clicks")
+	}
+	countClicks("none", 2)
+	countClicks("none", 3)
+	if got := clickTotal("none"); got != 5 {
+		t.Errorf("clickTotal = %d, want 5", got)
+	}
+}
+
+func TestTotalSurvivesPruning(t *testing.T) {
+	resetStore(t)
+	set(t, &rollupInterval, 0)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "kept"})
+	old := time.Now().Add(-48 * time.Hour)
+	for i := 0; i < 4; i++ {
+		recordRedirect("kept", &Click{Timestamp: old}, false, time.Now())
+	}
+	pruneClicksBefore(time.Now().Add(-time.Hour))
+
+	for i := 0; i < 3; i++ {
+		wantStatus(t, do("GET", "/kept", ""), http.StatusFound)
+	}
+	stats, _ := GetStats("kept", clickPage{limit: 100})
+	if stats.TotalClicks != 7 || len(stats.ClickDetails) != 3 {
+		t.Errorf("TotalClicks = %d with %d details, want 7 with 3", stats.TotalClicks, len(stats.ClickDetails))
+	}
+}
+
+func TestConcurrentClickCounting(t *testing.T) {
+	resetStore(t)
+	// Only a sample of the clicks keep their details; all are counted
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "busy", ClickSampleRate: 0.1})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			do("GET", "/busy", "")
+		}()
+	}
+	wg.Wait()
+	stats, _ := GetStats("busy", clickPage{limit: 100})
+	if stats.TotalClicks != 100 {
+		t.Errorf("TotalClicks = %d, want 100", stats.TotalClicks)
+	}
+	if len(stats.ClickDetails) >= 100 {
+		t.Errorf("%d details kept at a 10%% sample rate", len(stats.ClickDetails))
+	}
+}
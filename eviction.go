@@ -0,0 +1,74 @@
+package main
+
+import "time"
+
+// evictionPolicy decides what happens when MAX_URLS is reached: "reject" new
+// links (the default), evict the least recently accessed ("lru") or evict the
+// one closest to expiring ("earliest-expiry")
+var evictionPolicy = "reject"
+
+// makeRoom evicts live entries according to evictionPolicy until the store is
+// below MAX_URLS. It reports whether there is now room. The caller must hold
+// storeLock.
+func makeRoom(now time.Time) bool {
+	for storeFull(now) {
+		victim, ok := evictionCandidate(now)
+		if !ok {
+			return false
+		}
+		delete(urlStore, victim)
+		delete(analytics, victim)
+		delete(clickCounts, victim)
+		delete(botClickCounts, victim)
+		delete(rollups, victim)
+		redirectCache.Remove(victim)
+	}
+	return true
+}
+
+// dropExpiredLinks deletes the links expired at now, along with their
+// analytics, and returns how many were removed. The caller must hold
+// storeLock.
+func dropExpiredLinks(now time.Time) int {
+	dropped := 0
+	for code, url := range urlStore {
+		if now.Before(url.ExpiresAt) {
+			continue
+		}
+		delete(urlStore, code)
+		delete(analytics, code)
+		delete(clickCounts, code)
+		delete(botClickCounts, code)
+		delete(rollups, code)
+		redirectCache.Remove(code)
+		dropped++
+	}
+	return dropped
+}
+
+// evictionCandidate picks the live entry the policy would evict first
+func evictionCandidate(now time.Time) (string, bool) {
+	var victim string
+	var victimAt time.Time
+	for code, url := range urlStore {
+		if !now.Before(url.ExpiresAt) {
+			continue
+		}
+		var at time.Time
+		switch evictionPolicy {
+		case "lru":
+			at = url.LastAccessedAt
+			if at.IsZero() {
+				at = url.CreatedAt
+			}
+		case "earliest-expiry":
+			at = url.ExpiresAt
+		default:
+			return "", false
+		}
+		if victim == "" || at.Before(victimAt) {
+			victim, victimAt = code, at
+		}
+	}
+	return victim, victim != ""
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// fillStore creates links a, b and c expiring in that order from last to
+// first, where only b has never been accessed
+func fillStore(t *testing.T) {
+	t.Helper()
+	mustCreate(t, ShortURLRequest{URL: "https://example.com/a", Shortcode: "a", Validity: 3, ValidityUnit: "hours"})
+	mustCreate(t, ShortURLRequest{URL: "https://example.com/b", Shortcode: "b", Validity: 2, ValidityUnit: "hours"})
+	mustCreate(t, ShortURLRequest{URL: "https://example.com/c", Shortcode: "c", Validity: 1, ValidityUnit: "hours"})
+	now := time.Now()
+	storeLock.Lock()
+	for code, at := range map[string]time.Time{"a": now, "c": now} {
+		url := urlStore[code]
+		url.LastAccessedAt = at
+		urlStore[code] = url
+	}
+	storeLock.Unlock()
+}
+
+func TestEvictionPolicies(t *testing.T) {
+	tests := []struct {
+		policy  string
+		evicted string
+	}{
+		{"lru", "b"},
+		{"earliest-expiry", "c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			resetStore(t)
+			set(t, &maxURLs, 3)
+			set(t, &evictionPolicy, tt.policy)
+			fillStore(t)
+
+			mustCreate(t, ShortURLRequest{URL: "https://example.com/d", Shortcode: "d"})
+			storeLock.RLock()
+			defer storeLock.RUnlock()
+			if _, ok := urlStore[tt.evicted]; ok || len(urlStore) != 3 {
+				t.Errorf("store holds %d links including %s, want %s evicted", len(urlStore), tt.evicted, tt.evicted)
+			}
+			if _, ok := analytics[tt.evicted]; ok {
+				t.Errorf("analytics of %s kept", tt.evicted)
+			}
+		})
+	}
+}
+
+func TestEvictionPolicyReject(t *testing.T) {
+	resetStore(t)
+	set(t, &maxURLs, 3)
+	set(t, &evictionPolicy, "reject")
+	fillStore(t)
+
+	wantStatus(t, do("POST", "/shorturls", `{"url": "https://example.com/d"}`), http.StatusInsufficientStorage)
+}
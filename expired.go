@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// expiredTemplate is the page shown to browsers hitting an expired link,
+// parsed from the html/template file named by EXPIRED_TEMPLATE. Without one
+// it is nil and every client gets the JSON error.
+var expiredTemplate *template.Template
+
+// expiredMessage replaces the error text of the JSON 410 response
+var expiredMessage = ErrExpired.Error()
+
+// loadExpiredTemplate parses the template file at path
+func loadExpiredTemplate(path string) {
+	tmpl, err := template.ParseFiles(path)
+	if err != nil {
+		log.Fatalf("Invalid EXPIRED_TEMPLATE: %v", err)
+	}
+	expiredTemplate = tmpl
+}
+
+// ExpiredPage is the data the expired template is rendered with
+type ExpiredPage struct {
+	ShortCode string
+}
+
+// writeExpired sends the 410 for an expired link, rendering the configured
+// template for clients that prefer HTML
+func writeExpired(w http.ResponseWriter, r *http.Request) {
+	if expiredTemplate != nil && prefersHTML(r) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusGone)
+		if err := expiredTemplate.Execute(w, ExpiredPage{ShortCode: mux.Vars(r)["shortcode"]}); err != nil {
+			log.Printf("Rendering expired page: %v", err)
+		}
+		return
+	}
+
+	body, _ := json.Marshal(struct {
+		Error string `json:"error"`
+		Code  string `json:"code"`
+	}{expiredMessage, "expired"})
+	jsonError(w, string(body), http.StatusGone)
+}
+
+// prefersHTML reports whether the Accept header lists text/html ahead of any
+// JSON media type, as browsers do
+func prefersHTML(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, _ := strings.Cut(strings.TrimSpace(part), ";")
+		switch strings.TrimSpace(mediaType) {
+		case "text/html":
+			return true
+		case "application/json", "*/*":
+			return false
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const browserAccept = "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+
+// expireLink moves code's expiry into the past
+func expireLink(t *testing.T, code string) {
+	t.Helper()
+	storeLock.Lock()
+	defer storeLock.Unlock()
+	url, ok := urlStore[code]
+	if !ok {
+		t.Fatalf("no link %q to expire", code)
+	}
+	url.ExpiresAt = time.Now().Add(-time.Second)
+	urlStore[code] = url
+}
+
+func getExpired(t *testing.T, accept string) (status int, contentType, body string) {
+	t.Helper()
+	r := request("GET", "/gone", "")
+	if accept != "" {
+		r.Header.Set("Accept", accept)
+	}
+	rec := serve(r)
+	return rec.Code, rec.Header().Get("Content-Type"), rec.Body.String()
+}
+
+func TestExpiredTemplate(t *testing.T) {
+	resetStore(t)
+	path := filepath.Join(t.TempDir(), "expired.html")
+	if err := os.WriteFile(path, []byte(`<h1>Link {{.ShortCode}} has expired</h1>`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	set(t, &expiredTemplate, nil)
+	loadExpiredTemplate(path)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "gone"})
+	expireLink(t, "gone")
+
+	status, contentType, body := getExpired(t, browserAccept)
+	if status != http.StatusGone || !strings.HasPrefix(contentType, "text/html") || body != "<h1>Link gone has expired</h1>" {
+		t.Errorf("browser got %d %q: %s", status, contentType, body)
+	}
+	// API clients still get JSON
+	for _, accept := range []string{"application/json", "", "application/json, text/html"} {
+		status, contentType, body := getExpired(t, accept)
+		if status != http.StatusGone || contentType != "application/json" || !strings.Contains(body, `"code":"expired"`) {
+			t.Errorf("Accept %q got %d %q: %s", accept, status, contentType, body)
+		}
+	}
+}
+
+func TestExpiredDefaultBody(t *testing.T) {
+	resetStore(t)
+	set(t, &expiredTemplate, nil)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "gone"})
+	expireLink(t, "gone")
+
+	status, contentType, body := getExpired(t, browserAccept)
+	if status != http.StatusGone || contentType != "application/json" || !strings.Contains(body, `"error":"Short URL has expired"`) {
+		t.Errorf("without a template got %d %q: %s", status, contentType, body)
+	}
+
+	set(t, &expiredMessage, "This campaign has ended")
+	if _, _, body := getExpired(t, ""); !strings.Contains(body, `"error":"This campaign has ended"`) {
+		t.Errorf("custom message missing: %s", body)
+	}
+}
+
+func TestPrefersHTML(t *testing.T) {
+	tests := map[string]bool{
+		browserAccept:                     true,
+		"text/html;q=0.9":                 true,
+		"application/json":                false,
+		"application/json, text/html":     false,
+		"*/*":                             false,
+		"":                                false,
+		"application/xml, text/html;q=.5": true,
+	}
+	for accept, want := range tests {
+		r := request("GET", "/", "")
+		r.Header.Set("Accept", accept)
+		if got := prefersHTML(r); got != want {
+			t.Errorf("prefersHTML(%q) = %v, want %v", accept, got, want)
+		}
+	}
+}
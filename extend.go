@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// maxValidity caps how far in the future a link may expire, as a
+// time.Duration; 0 means no cap. It is atomic so SIGHUP can change it.
+var maxValidity atomic.Int64
+
+type ExtendRequest struct {
+	AdditionalMinutes int `json:"additionalMinutes"`
+	// Reactivate allows extending a link that has already expired, counting
+	// the extension from now
+	Reactivate bool `json:"reactivate"`
+}
+
+type ExtendResponse struct {
+	ShortCode string `json:"shortCode"`
+	Expiry    string `json:"expiry"`
+}
+
+// extendExpiry pushes a link's expiry further out
+func extendExpiry(w http.ResponseWriter, r *http.Request) {
+	shortCode := mux.Vars(r)["shortcode"]
+
+	var req ExtendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	// Beyond the largest Duration the extension would wrap around
+	if req.AdditionalMinutes <= 0 || int64(req.AdditionalMinutes) > math.MaxInt64/int64(time.Minute) {
+		jsonError(w, `{"error": "additionalMinutes must be positive and within range"}`, http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	storeLock.Lock()
+	url, exists := urlStore[shortCode]
+	if !exists {
+		storeLock.Unlock()
+		jsonError(w, `{"error": "Short URL not found"}`, http.StatusNotFound)
+		return
+	}
+	base := url.ExpiresAt
+	if now.After(base) {
+		if !req.Reactivate {
+			storeLock.Unlock()
+			jsonError(w, `{"error": "Short URL has expired"}`, http.StatusGone)
+			return
+		}
+		base = now
+	}
+	expiresAt := base.Add(time.Duration(req.AdditionalMinutes) * time.Minute)
+	if limit := time.Duration(maxValidity.Load()); limit > 0 && expiresAt.Sub(now) > limit {
+		storeLock.Unlock()
+		jsonError(w, `{"error": "Extension exceeds the maximum validity"}`, http.StatusBadRequest)
+		return
+	}
+	url.ExpiresAt = expiresAt
+	urlStore[shortCode] = url
+	storeLock.Unlock()
+	redirectCache.Remove(shortCode)
+
+	w.Header().Set("Content-Type", "application/json")
+	newJSONEncoder(w, r).Encode(ExtendResponse{ShortCode: shortCode, Expiry: expiresAt.Format(time.RFC3339)})
+}
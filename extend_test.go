@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestExtendExpiry(t *testing.T) {
+	resetStore(t)
+	url := mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "ext", Validity: 10})
+
+	rec := do("POST", "/shorturls/ext/extend", `{"additionalMinutes": 50}`)
+	wantStatus(t, rec, http.StatusOK)
+	var response ExtendResponse
+	decode(t, rec, &response)
+	want := url.ExpiresAt.Add(50 * time.Minute)
+	if response.Expiry != want.Format(time.RFC3339) {
+		t.Errorf("expiry = %s, want %s", response.Expiry, want.Format(time.RFC3339))
+	}
+	rec = do("GET", "/shorturls/ext/info", "")
+	var stored ShortURL
+	decode(t, rec, &stored)
+	if !stored.ExpiresAt.Equal(want) {
+		t.Errorf("stored expiry = %v, want %v", stored.ExpiresAt, want)
+	}
+
+	for _, body := range []string{`{"additionalMinutes": 0}`, `{"additionalMinutes": -5}`, `{"additionalMinutes": 153722868}`, `{`} {
+		wantStatus(t, do("POST", "/shorturls/ext/extend", body), http.StatusBadRequest)
+	}
+	wantStatus(t, do("POST", "/shorturls/missing/extend", `{"additionalMinutes": 5}`), http.StatusNotFound)
+}
+
+func TestExtendExpiredLink(t *testing.T) {
+	resetStore(t)
+	redirectCache = newLRUCache(10)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "ext"})
+	storeLock.Lock()
+	url := urlStore["ext"]
+	url.ExpiresAt = time.Now().Add(-time.Hour)
+	urlStore["ext"] = url
+	storeLock.Unlock()
+
+	wantStatus(t, do("POST", "/shorturls/ext/extend", `{"additionalMinutes": 5}`), http.StatusGone)
+	wantStatus(t, do("GET", "/ext", ""), http.StatusGone)
+
+	// Reactivating counts from now and invalidates the cached copy
+	wantStatus(t, do("POST", "/shorturls/ext/extend", `{"additionalMinutes": 5, "reactivate": true}`), http.StatusOK)
+	wantStatus(t, do("GET", "/ext", ""), http.StatusFound)
+}
+
+func TestExtendRespectsMaxValidity(t *testing.T) {
+	resetStore(t)
+	maxValidity.Store(int64(time.Hour))
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "ext", Validity: 30})
+
+	wantStatus(t, do("POST", "/shorturls/ext/extend", `{"additionalMinutes": 45}`), http.StatusBadRequest)
+	wantStatus(t, do("POST", "/shorturls/ext/extend", `{"additionalMinutes": 20}`), http.StatusOK)
+	wantStatus(t, do("POST", "/shorturls", `{"url": "https://example.com", "validity": 2, "validityUnit": "hours"}`), http.StatusBadRequest)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Favicon settings, populated from the environment in main
+var (
+	fetchFavicon   bool
+	faviconTimeout = 2 * time.Second
+)
+
+// faviconClient fetches destination pages for their favicon. Destinations
+// are user-supplied, so it only connects to public addresses, checked after
+// DNS resolution on every dial, redirects included.
+var faviconClient = &http.Client{
+	Transport: &http.Transport{
+		// A proxy would hide the real destination from the dialer check
+		Proxy: nil,
+		DialContext: (&net.Dialer{
+			Control: func(network, address string, _ syscall.RawConn) error {
+				return checkFaviconAddress(address)
+			},
+		}).DialContext,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 5 {
+			return errors.New("too many redirects")
+		}
+		if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+			return fmt.Errorf("redirect to %s: URL", req.URL.Scheme)
+		}
+		return nil
+	},
+}
+
+// checkFaviconAddress rejects dial addresses that are not publicly routable:
+// loopback, private, link-local (such as cloud metadata at 169.254.169.254),
+// shared, multicast and unspecified ones
+func checkFaviconAddress(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublicIP(ip) {
+		return fmt.Errorf("favicon fetch from non-public address %s refused", host)
+	}
+	return nil
+}
+
+// sharedAddressSpace is the carrier-grade NAT range of RFC 6598
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// isPublicIP reports whether ip is a publicly routable unicast address
+func isPublicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() && !ip.IsInterfaceLocalMulticast() &&
+		!ip.IsMulticast() && !ip.IsUnspecified() && !sharedAddressSpace.Contains(ip)
+}
+
+// storeFavicon resolves the favicon of a newly created link in the
+// background, so creation never waits on the destination, and records it
+// unless the link has since been replaced
+func storeFavicon(created ShortURL) {
+	favicon := resolveFavicon(created.OriginalURL)
+	if favicon == "" {
+		return
+	}
+	storeLock.Lock()
+	stored, ok := urlStore[created.ShortCode]
+	if ok && stored.CreatedAt.Equal(created.CreatedAt) {
+		stored.FaviconURL = favicon
+		urlStore[created.ShortCode] = stored
+		redirectCache.Remove(created.ShortCode)
+	}
+	storeLock.Unlock()
+}
+
+var (
+	linkTagPattern = regexp.MustCompile(`(?is)<link\b[^>]*>`)
+	relPattern     = regexp.MustCompile(`(?is)\brel\s*=\s*["']?([^"'>]+)`)
+	hrefPattern    = regexp.MustCompile(`(?is)\bhref\s*=\s*["']?([^"'\s>]+)`)
+)
+
+// resolveFavicon finds the favicon of the page at destination, from its
+// <link rel="icon"> tag or else the site's /favicon.ico. It returns "" when the
+// page cannot be fetched within faviconTimeout.
+func resolveFavicon(destination string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), faviconTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, destination, nil)
+	if err != nil {
+		return ""
+	}
+	resp, err := faviconClient.Do(req)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+	page, _ := io.ReadAll(io.LimitReader(resp.Body, 256<<10))
+
+	// Redirects may have moved us to another host, so resolve against the final URL
+	base := resp.Request.URL
+	if href := faviconHref(string(page)); href != "" {
+		if ref, err := url.Parse(href); err == nil {
+			return base.ResolveReference(ref).String()
+		}
+	}
+	return base.ResolveReference(&url.URL{Path: "/favicon.ico"}).String()
+}
+
+// faviconHref returns the href of the first icon <link> tag in page
+func faviconHref(page string) string {
+	for _, tag := range linkTagPattern.FindAllString(page, -1) {
+		rel := relPattern.FindStringSubmatch(tag)
+		if rel == nil {
+			continue
+		}
+		for _, token := range strings.Fields(strings.ToLower(rel[1])) {
+			if token == "icon" {
+				if href := hrefPattern.FindStringSubmatch(tag); href != nil {
+					return href[1]
+				}
+			}
+		}
+	}
+	return ""
+}
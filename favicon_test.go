@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFaviconHref(t *testing.T) {
+	tests := map[string]string{
+		`<link rel="stylesheet" href="/a.css"><link rel="icon" href="/i.png">`: "/i.png",
+		`<LINK REL='shortcut icon' HREF='https://cdn.example/f.ico'>`:          "https://cdn.example/f.ico",
+		`<link href=/x.svg rel=icon>`:                                          "/x.svg",
+		`<link rel="apple-touch-icon" href="/t.png">`:                          "",
+		`<p>no links</p>`: "",
+	}
+	for page, want := range tests {
+		if got := faviconHref(page); got != want {
+			t.Errorf("faviconHref(%q) = %q, want %q", page, got, want)
+		}
+	}
+}
+
+func TestIsPublicIP(t *testing.T) {
+	tests := map[string]bool{
+		"93.184.216.34":   true,
+		"2606:4700::1111": true,
+		"127.0.0.1":       false,
+		"10.1.2.3":        false,
+		"192.168.0.1":     false,
+		"169.254.169.254": false,
+		"100.64.0.1":      false,
+		"0.0.0.0":         false,
+		"224.0.0.1":       false,
+		"::1":             false,
+		"fd00::1":         false,
+		"fe80::1":         false,
+	}
+	for ip, want := range tests {
+		if got := isPublicIP(net.ParseIP(ip)); got != want {
+			t.Errorf("isPublicIP(%s) = %v, want %v", ip, got, want)
+		}
+	}
+}
+
+// faviconSite serves a page whose icon link is href, or none when it is empty
+func faviconSite(t *testing.T, href string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/moved" {
+			http.Redirect(w, r, "/page", http.StatusFound)
+			return
+		}
+		if href != "" {
+			fmt.Fprintf(w, `<html><head><link rel="icon" href=%q></head></html>`, href)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestResolveFavicon(t *testing.T) {
+	// The test sites listen on loopback, which the real client refuses
+	set(t, &faviconClient, &http.Client{})
+	withIcon := faviconSite(t, "img/icon.png")
+	without := faviconSite(t, "")
+
+	if got, want := resolveFavicon(withIcon.URL+"/moved"), withIcon.URL+"/img/icon.png"; got != want {
+		t.Errorf("resolveFavicon = %q, want %q", got, want)
+	}
+	if got, want := resolveFavicon(without.URL+"/page"), without.URL+"/favicon.ico"; got != want {
+		t.Errorf("resolveFavicon without an icon link = %q, want %q", got, want)
+	}
+	if got := resolveFavicon("http://" + closedAddress(t)); got != "" {
+		t.Errorf("resolveFavicon of an unreachable site = %q", got)
+	}
+}
+
+func TestResolveFaviconRefusesPrivateAddresses(t *testing.T) {
+	site := faviconSite(t, "/icon.png")
+	if got := resolveFavicon(site.URL); got != "" {
+		t.Errorf("fetched a favicon from loopback: %q", got)
+	}
+
+	// Every dial is checked, so redirects cannot lead there either
+	if err := checkFaviconAddress(site.Listener.Addr().String()); err == nil {
+		t.Error("loopback dial address accepted")
+	}
+	if err := checkFaviconAddress("169.254.169.254:80"); err == nil {
+		t.Error("metadata address accepted")
+	}
+	if err := checkFaviconAddress("93.184.216.34:443"); err != nil {
+		t.Errorf("public address refused: %v", err)
+	}
+}
+
+func TestCreateStoresFaviconInBackground(t *testing.T) {
+	resetStore(t)
+	set(t, &faviconClient, &http.Client{})
+	set(t, &fetchFavicon, true)
+	site := faviconSite(t, "/icon.png")
+
+	url := mustCreate(t, ShortURLRequest{URL: site.URL + "/page", Shortcode: "fav"})
+	if url.FaviconURL != "" {
+		t.Errorf("creation waited for the favicon")
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		storeLock.RLock()
+		favicon := urlStore["fav"].FaviconURL
+		storeLock.RUnlock()
+		if favicon == site.URL+"/icon.png" {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("favicon = %q after 2s, want %s/icon.png", favicon, site.URL)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// closedAddress returns a loopback address nothing listens on
+func closedAddress(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
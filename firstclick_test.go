@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTrackFirstClickOnly(t *testing.T) {
+	resetStore(t)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "once", TrackFirstClickOnly: true})
+	for _, referrer := range []string{"https://first.example", "https://second.example", "https://third.example"} {
+		r := request("GET", "/once", "")
+		r.Header.Set("Referer", referrer)
+		wantStatus(t, serve(r), http.StatusFound)
+	}
+
+	stats, _ := GetStats("once", clickPage{limit: 10})
+	if stats.TotalClicks != 3 {
+		t.Errorf("total = %d, want 3", stats.TotalClicks)
+	}
+	if len(stats.ClickDetails) != 1 || stats.ClickDetails[0].Referrer != "https://first.example" {
+		t.Errorf("details = %+v, want the first click alone", stats.ClickDetails)
+	}
+}
+
+func TestTrackFirstClickOnlyIgnoresSampling(t *testing.T) {
+	resetStore(t)
+	// A sample rate of 0 would store no click details at all
+	set(t, &clickSampleRate, 0)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "once", TrackFirstClickOnly: true})
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "sampled"})
+	wantStatus(t, do("GET", "/once", ""), http.StatusFound)
+	wantStatus(t, do("GET", "/sampled", ""), http.StatusFound)
+
+	if stats, _ := GetStats("once", clickPage{limit: 10}); len(stats.ClickDetails) != 1 {
+		t.Errorf("first click not kept: %+v", stats.ClickDetails)
+	}
+	if stats, _ := GetStats("sampled", clickPage{limit: 10}); len(stats.ClickDetails) != 0 || stats.TotalClicks != 1 {
+		t.Errorf("sampled-out link: total %d with %d details", stats.TotalClicks, len(stats.ClickDetails))
+	}
+}
+
+func TestTrackFirstClickOnlyBatched(t *testing.T) {
+	resetStore(t)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "once", TrackFirstClickOnly: true})
+	batch := newClickBatcher(100)
+	set(t, &clickBatch, batch)
+
+	// Clicks buffered together still leave a single detail once written
+	for i := 0; i < 3; i++ {
+		recordRedirect("once", &Click{Timestamp: time.Now()}, false, time.Now())
+	}
+	batch.flush()
+	stats, _ := GetStats("once", clickPage{limit: 10})
+	if stats.TotalClicks != 3 || len(stats.ClickDetails) != 1 {
+		t.Errorf("total %d with %d details, want 3 and 1", stats.TotalClicks, len(stats.ClickDetails))
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"net"
+)
+
+// datacenterRanges are CIDR blocks of hosting providers, from
+// DATACENTER_RANGES. Real visitors rarely browse from them.
+var datacenterRanges []*net.IPNet
+
+// excludeFraudClicks leaves clicks scoring highFraudScore or more out of
+// the valid click total in stats
+var excludeFraudClicks bool
+
+// highFraudScore is where the "high" fraud bucket starts
+const highFraudScore = 70
+
+// parseCIDRs parses DATACENTER_RANGES entries
+func parseCIDRs(entries []string) ([]*net.IPNet, error) {
+	ranges := make([]*net.IPNet, 0, len(entries))
+	for _, entry := range entries {
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("range %q: %v", entry, err)
+		}
+		ranges = append(ranges, network)
+	}
+	return ranges, nil
+}
+
+// inDatacenter reports whether ip falls in one of datacenterRanges
+func inDatacenter(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range datacenterRanges {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// fraudScore rates how likely a click is to be fake, from 0 (clearly human)
+// to 100. ip must be the raw client address, before anonymization.
+func fraudScore(ip string, isBot bool, referrer string) int {
+	score := 0
+	if isBot {
+		score += 60
+	}
+	if inDatacenter(ip) {
+		score += 30
+	}
+	if referrer == "" {
+		score += 10
+	}
+	return min(score, 100)
+}
+
+// fraudBucket names the band score falls in: "low", "medium" or "high"
+func fraudBucket(score int) string {
+	switch {
+	case score >= highFraudScore:
+		return "high"
+	case score >= 30:
+		return "medium"
+	}
+	return "low"
+}
+
+// clicksByFraudBucket counts clicks per fraud bucket, returning the number
+// of high-scoring clicks as well
+func clicksByFraudBucket(clicks []Click) (map[string]int, int) {
+	counts := map[string]int{"low": 0, "medium": 0, "high": 0}
+	for _, click := range clicks {
+		counts[fraudBucket(click.FraudScore)]++
+	}
+	return counts, counts["high"]
+}
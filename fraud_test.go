@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func useDatacenterRanges(t *testing.T, entries ...string) {
+	t.Helper()
+	ranges, err := parseCIDRs(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set(t, &datacenterRanges, ranges)
+}
+
+func TestFraudScore(t *testing.T) {
+	useDatacenterRanges(t, "198.51.100.0/24")
+	tests := []struct {
+		ip       string
+		isBot    bool
+		referrer string
+		want     int
+		bucket   string
+	}{
+		{"203.0.113.7", false, "https://news.example", 0, "low"},
+		{"203.0.113.7", false, "", 10, "low"},
+		{"198.51.100.20", false, "", 40, "medium"},
+		{"203.0.113.7", true, "https://news.example", 60, "medium"},
+		{"203.0.113.7", true, "", 70, "high"},
+		{"198.51.100.20", true, "", 100, "high"},
+		{"not-an-ip", false, "https://news.example", 0, "low"},
+	}
+	for _, tt := range tests {
+		score := fraudScore(tt.ip, tt.isBot, tt.referrer)
+		if score != tt.want || fraudBucket(score) != tt.bucket {
+			t.Errorf("fraudScore(%s, bot %v, %q) = %d (%s), want %d (%s)",
+				tt.ip, tt.isBot, tt.referrer, score, fraudBucket(score), tt.want, tt.bucket)
+		}
+	}
+}
+
+func TestParseCIDRs(t *testing.T) {
+	ranges, err := parseCIDRs([]string{"198.51.100.0/24", "2001:db8::/32"})
+	if err != nil || len(ranges) != 2 {
+		t.Fatalf("parseCIDRs = %v, %v", ranges, err)
+	}
+	if _, err := parseCIDRs([]string{"198.51.100.0"}); err == nil {
+		t.Error("address without a prefix length accepted")
+	}
+}
+
+func TestRedirectFraudScore(t *testing.T) {
+	resetStore(t)
+	useDatacenterRanges(t, "198.51.100.0/24")
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "ads"})
+
+	// A human clicking through from a page, and a crawler hitting the link
+	// straight from a hosting provider
+	human := request("GET", "/ads", "")
+	human.Header.Set("Referer", "https://news.example/story")
+	human.RemoteAddr = "203.0.113.7:4000"
+	wantStatus(t, serve(human), http.StatusFound)
+	bot := request("GET", "/ads", "")
+	bot.Header.Set("User-Agent", "curl/8.5.0")
+	bot.RemoteAddr = "198.51.100.20:4000"
+	wantStatus(t, serve(bot), http.StatusFound)
+
+	stats, _ := GetStats("ads", clickPage{limit: 10})
+	if len(stats.ClickDetails) != 2 {
+		t.Fatalf("%d clicks stored, want 2", len(stats.ClickDetails))
+	}
+	for _, click := range stats.ClickDetails {
+		want := 0
+		if click.IsBot {
+			want = 100
+		}
+		if click.FraudScore != want {
+			t.Errorf("click from %s (bot %v) scored %d, want %d", click.IPAddress, click.IsBot, click.FraudScore, want)
+		}
+	}
+	want := map[string]int{"low": 1, "medium": 0, "high": 1}
+	for bucket, n := range want {
+		if stats.ClicksByFraudBucket[bucket] != n {
+			t.Errorf("clicksByFraudBucket = %v, want %v", stats.ClicksByFraudBucket, want)
+			break
+		}
+	}
+}
+
+func TestExcludeFraudClicks(t *testing.T) {
+	resetStore(t)
+	set(t, &countBotClicks, true)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "ads"})
+	human := request("GET", "/ads", "")
+	human.Header.Set("Referer", "https://news.example/story")
+	wantStatus(t, serve(human), http.StatusFound)
+	bot := request("GET", "/ads", "")
+	bot.Header.Set("User-Agent", "")
+	wantStatus(t, serve(bot), http.StatusFound)
+
+	stats, _ := GetStats("ads", clickPage{limit: 10})
+	if stats.TotalClicks != 2 || stats.ValidClicks != 2 {
+		t.Errorf("total %d, valid %d without exclusion, want 2 and 2", stats.TotalClicks, stats.ValidClicks)
+	}
+	set(t, &excludeFraudClicks, true)
+	stats, _ = GetStats("ads", clickPage{limit: 10})
+	if stats.TotalClicks != 2 || stats.ValidClicks != 1 {
+		t.Errorf("total %d, valid %d with exclusion, want 2 and 1", stats.TotalClicks, stats.ValidClicks)
+	}
+}
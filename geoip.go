@@ -0,0 +1,123 @@
+package main
+
+import (
+	"log"
+	"math"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+// geoDB resolves client IPs to locations. It is nil, and clicks carry no geo
+// data, unless GEOIP_DB names a MaxMind City or Country database.
+var geoDB *geoip2.Reader
+
+// geoCountryOnly is set for Country databases, which have no coordinates
+var geoCountryOnly bool
+
+// openGeoDB opens the GeoIP database at path, refusing database types that
+// cannot resolve a country, such as ASN or ISP ones
+func openGeoDB(path string) {
+	db, err := geoip2.Open(path)
+	if err != nil {
+		log.Fatalf("Invalid GEOIP_DB: %v", err)
+	}
+	dbType := db.Metadata().DatabaseType
+	switch {
+	case strings.Contains(dbType, "City"), strings.Contains(dbType, "Enterprise"):
+	case strings.Contains(dbType, "Country"):
+		geoCountryOnly = true
+	default:
+		log.Fatalf("Invalid GEOIP_DB: unsupported database type %q, expected City or Country", dbType)
+	}
+	geoDB = db
+}
+
+// geoInfo is what a GeoIP lookup contributes to a click
+type geoInfo struct {
+	Country   string
+	Latitude  float64
+	Longitude float64
+	HasCoords bool
+}
+
+// lookupGeo resolves ip, returning a zero geoInfo when there is no database
+// or the address is unknown
+func lookupGeo(ip string) geoInfo {
+	parsed := net.ParseIP(ip)
+	if geoDB == nil || parsed == nil {
+		return geoInfo{}
+	}
+	if geoCountryOnly {
+		country, err := geoDB.Country(parsed)
+		if err != nil {
+			return geoInfo{}
+		}
+		return geoInfo{Country: country.Country.IsoCode}
+	}
+	city, err := geoDB.City(parsed)
+	if err != nil {
+		return geoInfo{}
+	}
+	info := geoInfo{Country: city.Country.IsoCode}
+	// MaxMind reports 0,0 with zero accuracy when it has no coordinates
+	if city.Location.AccuracyRadius > 0 {
+		info.Latitude = city.Location.Latitude
+		info.Longitude = city.Location.Longitude
+		info.HasCoords = true
+	}
+	return info
+}
+
+// applyGeo copies a lookup result onto click
+func applyGeo(click *Click, info geoInfo) {
+	click.Country = info.Country
+	if info.HasCoords {
+		lat, lon := info.Latitude, info.Longitude
+		click.Latitude, click.Longitude = &lat, &lon
+	}
+}
+
+// GeoCluster counts clicks around a rounded coordinate
+type GeoCluster struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Clicks    int     `json:"clicks"`
+}
+
+// clusterPrecision rounds coordinates to one decimal place, roughly 11km cells
+const clusterPrecision = 10
+
+// clickClusters groups clicks with coordinates into grid cells for heat-maps,
+// busiest first. Clicks without coordinates are skipped.
+func clickClusters(clicks []Click) []GeoCluster {
+	type cell struct{ lat, lon float64 }
+	counts := make(map[cell]int)
+	for _, click := range clicks {
+		if click.Latitude == nil || click.Longitude == nil {
+			continue
+		}
+		c := cell{
+			lat: math.Round(*click.Latitude*clusterPrecision) / clusterPrecision,
+			lon: math.Round(*click.Longitude*clusterPrecision) / clusterPrecision,
+		}
+		counts[c]++
+	}
+
+	clusters := make([]GeoCluster, 0, len(counts))
+	for c, n := range counts {
+		clusters = append(clusters, GeoCluster{Latitude: c.lat, Longitude: c.lon, Clicks: n})
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		if clusters[i].Clicks != clusters[j].Clicks {
+			return clusters[i].Clicks > clusters[j].Clicks
+		}
+		if clusters[i].Latitude != clusters[j].Latitude {
+			return clusters[i].Latitude < clusters[j].Latitude
+		}
+		return clusters[i].Longitude < clusters[j].Longitude
+	})
+	return clusters
+}
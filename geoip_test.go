@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// MaxMind DB encoding of the few data types the test databases need
+func mmdbString(s string) []byte { return append([]byte{2<<5 | byte(len(s))}, s...) }
+
+func mmdbUint16(n uint16) []byte { return []byte{5<<5 | 2, byte(n >> 8), byte(n)} }
+
+func mmdbDouble(f float64) []byte {
+	return binary.BigEndian.AppendUint64([]byte{3<<5 | 8}, math.Float64bits(f))
+}
+
+func mmdbMap(pairs ...[]byte) []byte {
+	out := []byte{7<<5 | byte(len(pairs)/2)}
+	return append(out, bytes.Join(pairs, nil)...)
+}
+
+// writeGeoDB writes an IPv4 database of the given type with a single node:
+// 0.0.0.0/1 resolves to London and the other half of the space is unknown
+func writeGeoDB(t *testing.T, dbType string) string {
+	t.Helper()
+	var db bytes.Buffer
+	// 24-bit records: left points at data offset 0 (node count + 16), right
+	// equals the node count, meaning no data
+	db.Write([]byte{0, 0, 17, 0, 0, 1})
+	db.Write(make([]byte, 16))
+	db.Write(mmdbMap(
+		mmdbString("country"), mmdbMap(mmdbString("iso_code"), mmdbString("GB")),
+		mmdbString("location"), mmdbMap(
+			mmdbString("accuracy_radius"), mmdbUint16(10),
+			mmdbString("latitude"), mmdbDouble(51.5142),
+			mmdbString("longitude"), mmdbDouble(-0.0931),
+		),
+	))
+	db.WriteString("\xAB\xCD\xEFMaxMind.com")
+	db.Write(mmdbMap(
+		mmdbString("node_count"), []byte{6<<5 | 1, 1},
+		mmdbString("record_size"), mmdbUint16(24),
+		mmdbString("ip_version"), mmdbUint16(4),
+		mmdbString("database_type"), mmdbString(dbType),
+		mmdbString("binary_format_major_version"), mmdbUint16(2),
+	))
+
+	path := filepath.Join(t.TempDir(), "geo.mmdb")
+	if err := os.WriteFile(path, db.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func useGeoDB(t *testing.T, dbType string) {
+	t.Helper()
+	set(t, &geoDB, nil)
+	set(t, &geoCountryOnly, false)
+	openGeoDB(writeGeoDB(t, dbType))
+	t.Cleanup(func() { geoDB.Close() })
+}
+
+func TestLookupGeoCity(t *testing.T) {
+	useGeoDB(t, "GeoLite2-City")
+
+	info := lookupGeo("81.2.69.142")
+	if info.Country != "GB" || !info.HasCoords || info.Latitude != 51.5142 || info.Longitude != -0.0931 {
+		t.Errorf("lookupGeo = %+v", info)
+	}
+	for _, ip := range []string{"203.0.113.7", "not-an-ip", "2001:db8::1"} {
+		if info := lookupGeo(ip); info != (geoInfo{}) {
+			t.Errorf("lookupGeo(%s) = %+v, want nothing", ip, info)
+		}
+	}
+}
+
+func TestLookupGeoCountryDatabase(t *testing.T) {
+	useGeoDB(t, "GeoLite2-Country")
+	if !geoCountryOnly {
+		t.Fatal("Country database opened as City")
+	}
+	// Even with location data present, a Country database yields no coordinates
+	if info := lookupGeo("81.2.69.142"); info != (geoInfo{Country: "GB"}) {
+		t.Errorf("lookupGeo = %+v, want country only", info)
+	}
+}
+
+func TestOpenGeoDBRejectsOtherTypes(t *testing.T) {
+	if path := os.Getenv("TEST_GEOIP_DB"); path != "" {
+		log.SetOutput(os.Stderr)
+		openGeoDB(path)
+		return
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestOpenGeoDBRejectsOtherTypes$")
+	cmd.Env = append(os.Environ(), "TEST_GEOIP_DB="+writeGeoDB(t, "GeoLite2-ASN"))
+	out, err := cmd.CombinedOutput()
+	if err == nil || !bytes.Contains(out, []byte(`unsupported database type "GeoLite2-ASN"`)) {
+		t.Errorf("ASN database accepted: %v\n%s", err, out)
+	}
+}
+
+func TestRedirectClusters(t *testing.T) {
+	resetStore(t)
+	useGeoDB(t, "GeoIP2-City")
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "geo"})
+
+	for _, addr := range []string{"81.2.69.142:1000", "81.2.69.160:1000", "203.0.113.7:1000"} {
+		r := request("GET", "/geo", "")
+		r.RemoteAddr = addr
+		wantStatus(t, serve(r), http.StatusFound)
+	}
+
+	stats := getStats(t, "geo")
+	if len(stats.Locations) != 1 || stats.Locations[0] != (GeoCluster{Latitude: 51.5, Longitude: -0.1, Clicks: 2}) {
+		t.Errorf("locations = %+v", stats.Locations)
+	}
+	for _, click := range stats.ClickDetails {
+		if (click.Latitude == nil) != (click.Country == "") {
+			t.Errorf("click %+v has a country and coordinates out of step", click)
+		}
+	}
+}
+
+func TestClickClusters(t *testing.T) {
+	coord := func(f float64) *float64 { return &f }
+	clusters := clickClusters([]Click{
+		{Latitude: coord(48.87), Longitude: coord(2.31)},
+		{Latitude: coord(40.71), Longitude: coord(-74.01)},
+		{Latitude: coord(48.93), Longitude: coord(2.29)},
+		{},
+	})
+	want := []GeoCluster{{48.9, 2.3, 2}, {40.7, -74, 1}}
+	if len(clusters) != len(want) {
+		t.Fatalf("clusters = %+v", clusters)
+	}
+	for i := range want {
+		if clusters[i] != want[i] {
+			t.Errorf("cluster %d = %+v, want %+v", i, clusters[i], want[i])
+		}
+	}
+	if clickClusters(nil) == nil {
+		t.Error("no clicks gives null rather than an empty list")
+	}
+}
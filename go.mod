@@ -4,5 +4,14 @@ go 1.24.3
 
 require (
 	github.com/gorilla/mux v1.8.1
+	github.com/oschwald/geoip2-golang v1.13.0
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
 	github.com/speps/go-hashids v2.0.0+incompatible
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+)
+
+require (
+	github.com/oschwald/maxminddb-golang v1.13.0 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	golang.org/x/sys v0.20.0 // indirect
 )
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// drainDelay is how long /readyz reports 503 before the server shuts down,
+// giving load balancers time to stop routing to this instance
+var drainDelay time.Duration
+
+// draining is set once shutdown has begun
+var draining atomic.Bool
+
+// shutdownTimeout bounds how long shutdown waits for in-flight requests
+const shutdownTimeout = 10 * time.Second
+
+// drainAndShutdown fails readiness first and keeps srv serving for delay
+// while the load balancer catches up, then shuts it down
+func drainAndShutdown(srv *http.Server, delay time.Duration) {
+	draining.Store(true)
+	if delay > 0 {
+		log.Printf("Draining for %v before shutdown", delay)
+		time.Sleep(delay)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("Shutdown: %v", err)
+	}
+}
+
+// healthz reports that the process is up
+func healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"status": "ok"}`))
+}
+
+// readyz reports whether this instance should receive traffic
+func readyz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if draining.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"status": "draining"}`))
+		return
+	}
+	w.Write([]byte(`{"status": "ready"}`))
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestReadyzWhileDraining(t *testing.T) {
+	resetStore(t)
+	wantStatus(t, do("GET", "/readyz", ""), http.StatusOK)
+
+	draining.Store(true)
+	defer draining.Store(false)
+	rec := do("GET", "/readyz", "")
+	wantStatus(t, rec, http.StatusServiceUnavailable)
+	if got := rec.Body.String(); got != `{"status": "draining"}` {
+		t.Errorf("body = %q", got)
+	}
+	// Liveness is unaffected, so the instance is not restarted mid-drain
+	wantStatus(t, do("GET", "/healthz", ""), http.StatusOK)
+}
+
+func TestDrainAndShutdown(t *testing.T) {
+	resetStore(t)
+	defer draining.Store(false)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newServer(newHandler(newRouter()))
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(ln) }()
+	base := "http://" + ln.Addr().String()
+	get := func(path string) (int, error) {
+		resp, err := http.Get(base + path)
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		drainAndShutdown(srv, 300*time.Millisecond)
+		close(done)
+	}()
+	deadline := time.Now().Add(time.Second)
+	for !draining.Load() {
+		if time.Now().After(deadline) {
+			t.Fatal("draining never started")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Until the delay is up, only readiness fails
+	if status, err := get("/readyz"); err != nil || status != http.StatusServiceUnavailable {
+		t.Errorf("/readyz while draining: %d, %v; want 503", status, err)
+	}
+	if status, err := get("/healthz"); err != nil || status != http.StatusOK {
+		t.Errorf("/healthz while draining: %d, %v; want 200", status, err)
+	}
+	if status, err := get("/stats/summary"); err != nil || status != http.StatusOK {
+		t.Errorf("normal route while draining: %d, %v; want 200", status, err)
+	}
+	select {
+	case <-done:
+		t.Fatal("shut down before the drain delay was up")
+	default:
+	}
+
+	<-done
+	if err := <-served; err != http.ErrServerClosed {
+		t.Errorf("Serve returned %v, want ErrServerClosed", err)
+	}
+	if _, err := get("/healthz"); err == nil {
+		t.Error("server still answering after shutdown")
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// testHost is the Host the test requests arrive on
+const testHost = "short.test"
+
+func TestMain(m *testing.M) {
+	// The request log would bury test failures; tests that check it capture
+	// it with captureLog
+	log.SetOutput(io.Discard)
+	domains := blockedShortenerList(nil)
+	blockedShortenerDomains.Store(&domains)
+	os.Exit(m.Run())
+}
+
+// resetStore empties the store and the state derived from it, so each test
+// starts from a fresh server
+func resetStore(t testing.TB) {
+	t.Helper()
+	storeLock.Lock()
+	urlStore = make(map[string]ShortURL)
+	analytics = make(map[string]*clickLog)
+	clickCounts = make(map[string]*atomic.Int64)
+	botClickCounts = make(map[string]*atomic.Int64)
+	tombstones = make(map[string]string)
+	retiredCodes = make(map[string]bool)
+	rollups = make(map[string][]DailyStat)
+	pooledCodes = make(map[string]bool)
+	storeLock.Unlock()
+	codePool = nil
+	codeSequence.Store(0)
+	redirectCache = nil
+	redirectRates = newRateTracker(redirectRates.tau, redirectRates.maxTracked)
+	redirectLimits = newRedirectLimiter()
+	maintenanceMode.Store(false)
+	analyticsPaused.Store(false)
+	draining.Store(false)
+	maxValidity.Store(0)
+}
+
+// set assigns v to the setting at p for the rest of the test
+func set[T any](t testing.TB, p *T, v T) {
+	t.Helper()
+	old := *p
+	*p = v
+	t.Cleanup(func() { *p = old })
+}
+
+// captureLog collects everything logged for the rest of the test
+func captureLog(t *testing.T) *strings.Builder {
+	t.Helper()
+	var buf strings.Builder
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(io.Discard) })
+	return &buf
+}
+
+// mustCreate stores the link req describes, failing the test on error
+func mustCreate(t *testing.T, req ShortURLRequest) ShortURL {
+	t.Helper()
+	url, _, err := CreateURL(req, testHost)
+	if err != nil {
+		t.Fatalf("CreateURL(%+v): %v", req, err)
+	}
+	return url
+}
+
+// addClicks imports clicks for code through the admin API. Clicks without a
+// user agent come from a browser, so they are not counted as bots.
+func addClicks(t *testing.T, code string, clicks ...Click) {
+	t.Helper()
+	set(t, &adminEnabled, true)
+	imported := append([]Click(nil), clicks...)
+	for i := range imported {
+		if imported[i].UserAgent == "" {
+			imported[i].UserAgent = browserUserAgent
+		}
+	}
+	body, _ := json.Marshal(imported)
+	wantStatus(t, do("POST", "/shorturls/"+code+"/clicks/import", string(body)), http.StatusOK)
+}
+
+// getStats fetches the stats of code through the API
+func getStats(t *testing.T, code string) URLStats {
+	t.Helper()
+	rec := do("GET", "/shorturls/"+code, "")
+	wantStatus(t, rec, http.StatusOK)
+	var stats URLStats
+	decode(t, rec, &stats)
+	return stats
+}
+
+// serve sends r through the router and middleware the server runs with
+func serve(r *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	newHandler(newRouter()).ServeHTTP(rec, r)
+	return rec
+}
+
+// browserUserAgent is sent with test requests so they look like a visitor's
+const browserUserAgent = "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0"
+
+// request builds a browser request for target on testHost with an optional
+// body
+func request(method, target, body string) *http.Request {
+	var r *http.Request
+	if body == "" {
+		r = httptest.NewRequest(method, target, nil)
+	} else {
+		r = httptest.NewRequest(method, target, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+	}
+	r.Host = testHost
+	r.Header.Set("User-Agent", browserUserAgent)
+	return r
+}
+
+// do serves a request for target with an optional body
+func do(method, target, body string) *httptest.ResponseRecorder {
+	return serve(request(method, target, body))
+}
+
+// decode unmarshals the JSON response body into v
+func decode(t *testing.T, rec *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("decoding %q: %v", rec.Body.String(), err)
+	}
+}
+
+// wantStatus fails the test unless rec has the expected status
+func wantStatus(t *testing.T, rec *httptest.ResponseRecorder, want int) {
+	t.Helper()
+	if rec.Code != want {
+		t.Fatalf("status = %d, want %d; body %q", rec.Code, want, rec.Body.String())
+	}
+}
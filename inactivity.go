@@ -0,0 +1,62 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// inactivityReapInterval is how often links idle past their inactivity
+// expiry are removed
+var inactivityReapInterval = time.Minute
+
+// idleExpired reports whether url has gone unused for longer than its
+// inactivity expiry at now. Links never clicked are idle since creation.
+func idleExpired(url ShortURL, now time.Time) bool {
+	if url.InactivityExpiry <= 0 {
+		return false
+	}
+	idleSince := url.LastAccessedAt
+	if idleSince.IsZero() {
+		idleSince = url.CreatedAt
+	}
+	return now.Sub(idleSince) > time.Duration(url.InactivityExpiry)*time.Second
+}
+
+// runInactivityReaper removes idle links periodically until stop is closed
+func runInactivityReaper(stop <-chan struct{}) {
+	ticker := time.NewTicker(inactivityReapInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			if removed := reapIdleLinks(now); removed > 0 {
+				log.Printf("Reaped %d idle links", removed)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// reapIdleLinks deletes the links idle past their inactivity expiry at now,
+// along with their analytics, and returns how many were removed
+func reapIdleLinks(now time.Time) int {
+	var reaped []string
+	storeLock.Lock()
+	for code, url := range urlStore {
+		if idleExpired(url, now) {
+			delete(urlStore, code)
+			delete(analytics, code)
+			delete(clickCounts, code)
+			delete(botClickCounts, code)
+			delete(rollups, code)
+			reaped = append(reaped, code)
+		}
+	}
+	storeLock.Unlock()
+
+	for _, code := range reaped {
+		redirectCache.Remove(code)
+	}
+	return len(reaped)
+}
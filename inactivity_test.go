@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestIdleExpired(t *testing.T) {
+	created := time.Now().Add(-time.Hour)
+	url := ShortURL{CreatedAt: created, InactivityExpiry: 600}
+	if !idleExpired(url, time.Now()) {
+		t.Error("link never clicked in an hour not idle")
+	}
+	url.LastAccessedAt = time.Now().Add(-5 * time.Minute)
+	if idleExpired(url, time.Now()) {
+		t.Error("link clicked 5 minutes ago counted idle")
+	}
+	if idleExpired(ShortURL{CreatedAt: created}, time.Now()) {
+		t.Error("link without an inactivity expiry counted idle")
+	}
+}
+
+func TestReapIdleLinks(t *testing.T) {
+	resetStore(t)
+	redirectCache = newLRUCache(10)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "used", InactivityExpiry: 60})
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "idle", InactivityExpiry: 60})
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "plain"})
+	wantStatus(t, do("GET", "/idle", ""), http.StatusFound)
+
+	// Two minutes on, only the link clicked in the last minute is kept
+	later := time.Now().Add(2 * time.Minute)
+	recordRedirect("used", nil, false, later.Add(-30*time.Second))
+	if removed := reapIdleLinks(later); removed != 1 {
+		t.Errorf("reaped %d links, want 1", removed)
+	}
+	for code, want := range map[string]error{"used": nil, "idle": ErrNotFound, "plain": nil} {
+		if _, err := Resolve(code); err != want {
+			t.Errorf("Resolve(%s) = %v, want %v", code, err, want)
+		}
+	}
+	wantStatus(t, do("POST", "/shorturls", `{"url": "https://example.com", "inactivityExpiry": -1}`), http.StatusBadRequest)
+}
+
+func TestIdleLinkExpiresBeforeReaping(t *testing.T) {
+	resetStore(t)
+	redirectCache = newLRUCache(10)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "idle", InactivityExpiry: 60})
+	storeLock.Lock()
+	url := urlStore["idle"]
+	url.CreatedAt = time.Now().Add(-2 * time.Minute)
+	urlStore["idle"] = url
+	storeLock.Unlock()
+
+	// Idle links answer 410 until the reaper removes them
+	wantStatus(t, do("GET", "/idle", ""), http.StatusGone)
+
+	// The cached copy is idle, but the store knows about a later redirect
+	recordRedirect("idle", nil, false, time.Now())
+	wantStatus(t, do("GET", "/idle", ""), http.StatusFound)
+}
@@ -0,0 +1,46 @@
+package main
+
+import "strings"
+
+// clickLanguage returns the first locale of an Accept-Language header, e.g.
+// "en-US" for "en-US,en;q=0.9", or "" when the header is missing, a wildcard
+// or malformed. The primary subtag is lowercased and a region uppercased.
+func clickLanguage(header string) string {
+	first, _, _ := strings.Cut(header, ",")
+	tag, _, _ := strings.Cut(first, ";")
+	tag = strings.TrimSpace(tag)
+
+	subtags := strings.Split(tag, "-")
+	for i, subtag := range subtags {
+		if subtag == "" || len(subtag) > 8 {
+			return ""
+		}
+		for _, c := range subtag {
+			isLetter := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+			if !isLetter && (i == 0 || c < '0' || c > '9') {
+				return ""
+			}
+		}
+		switch {
+		case i == 0:
+			subtags[i] = strings.ToLower(subtag)
+		case len(subtag) == 2:
+			subtags[i] = strings.ToUpper(subtag)
+		}
+	}
+	return strings.Join(subtags, "-")
+}
+
+// clicksByLanguage counts clicks per visitor language, with "unknown" for
+// clicks that sent no usable Accept-Language
+func clicksByLanguage(clicks []Click) map[string]int {
+	counts := make(map[string]int)
+	for _, click := range clicks {
+		language := click.Language
+		if language == "" {
+			language = "unknown"
+		}
+		counts[language]++
+	}
+	return counts
+}
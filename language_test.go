@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestClickLanguage(t *testing.T) {
+	tests := map[string]string{
+		"en-US,en;q=0.9":     "en-US",
+		"de;q=0.8, en":       "de",
+		" FR-ca ":            "fr-CA",
+		"zh-Hant-TW,zh;q=.5": "zh-Hant-TW",
+		"es-419":             "es-419",
+		"":                   "",
+		"*":                  "",
+		"en_US":              "",
+		"1en":                "",
+		"en--US":             "",
+		"verylongtag-x":      "",
+		"<script>":           "",
+	}
+	for header, want := range tests {
+		if got := clickLanguage(header); got != want {
+			t.Errorf("clickLanguage(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestClicksByLanguage(t *testing.T) {
+	resetStore(t)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "lang"})
+	for _, header := range []string{"en-US,en;q=0.9", "en-us", "de-DE", "", "garbage!"} {
+		r := request("GET", "/lang", "")
+		if header != "" {
+			r.Header.Set("Accept-Language", header)
+		}
+		wantStatus(t, serve(r), http.StatusFound)
+	}
+
+	stats, _ := GetStats("lang", clickPage{limit: 10})
+	want := map[string]int{"en-US": 2, "de-DE": 1, "unknown": 2}
+	if len(stats.ClicksByLanguage) != len(want) {
+		t.Errorf("clicksByLanguage = %v, want %v", stats.ClicksByLanguage, want)
+	}
+	for language, n := range want {
+		if stats.ClicksByLanguage[language] != n {
+			t.Errorf("clicksByLanguage[%s] = %d, want %d", language, stats.ClicksByLanguage[language], n)
+		}
+	}
+	if stats.ClickDetails[2].Language != "de-DE" {
+		t.Errorf("third click language = %q", stats.ClickDetails[2].Language)
+	}
+}
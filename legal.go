@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// legalBlockNotice is the 451 message for blocked links without a notice
+// of their own
+var legalBlockNotice = "This link is unavailable for legal reasons"
+
+// LegalBlockError reports a link taken down for legal reasons
+type LegalBlockError struct {
+	Notice string
+}
+
+func (e *LegalBlockError) Error() string {
+	if e.Notice != "" {
+		return e.Notice
+	}
+	return legalBlockNotice
+}
+
+type LegalBlockRequest struct {
+	Blocked bool `json:"blocked"`
+	// Notice replaces LEGAL_BLOCK_NOTICE for this link
+	Notice string `json:"notice"`
+}
+
+// setLegalBlock flags a link as legally blocked, or lifts the block, so that
+// redirects through it answer 451 instead
+func setLegalBlock(w http.ResponseWriter, r *http.Request) {
+	shortCode := mux.Vars(r)["shortcode"]
+
+	var req LegalBlockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+
+	storeLock.Lock()
+	url, exists := urlStore[shortCode]
+	if exists {
+		url.LegalBlocked = req.Blocked
+		url.LegalNotice = ""
+		if req.Blocked {
+			url.LegalNotice = req.Notice
+		}
+		urlStore[shortCode] = url
+	}
+	storeLock.Unlock()
+	redirectCache.Remove(shortCode)
+
+	if !exists {
+		jsonError(w, `{"error": "Short URL not found"}`, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	newJSONEncoder(w, r).Encode(url)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func legalError(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	wantStatus(t, rec, http.StatusUnavailableForLegalReasons)
+	var body struct {
+		Error string `json:"error"`
+		Code  string `json:"code"`
+	}
+	decode(t, rec, &body)
+	if body.Code != "legal_block" {
+		t.Errorf("code = %q, want legal_block", body.Code)
+	}
+	return body.Error
+}
+
+func TestLegalBlock(t *testing.T) {
+	resetStore(t)
+	set(t, &adminEnabled, true)
+	redirectCache = newLRUCache(10)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "takedown"})
+	wantStatus(t, do("GET", "/takedown", ""), http.StatusFound)
+
+	wantStatus(t, do("POST", "/shorturls/takedown/legal-block", `{"blocked": true}`), http.StatusOK)
+	if msg := legalError(t, do("GET", "/takedown", "")); msg != legalBlockNotice {
+		t.Errorf("notice = %q, want the default", msg)
+	}
+
+	wantStatus(t, do("POST", "/shorturls/takedown/legal-block", `{"blocked": true, "notice": "Removed after a DMCA notice"}`), http.StatusOK)
+	if msg := legalError(t, do("GET", "/takedown", "")); msg != "Removed after a DMCA notice" {
+		t.Errorf("notice = %q, want the link's own", msg)
+	}
+
+	set(t, &legalBlockNotice, "Blocked by court order")
+	wantStatus(t, do("POST", "/shorturls/takedown/legal-block", `{"blocked": true}`), http.StatusOK)
+	if msg := legalError(t, do("GET", "/takedown", "")); msg != "Blocked by court order" {
+		t.Errorf("notice = %q, want LEGAL_BLOCK_NOTICE", msg)
+	}
+
+	// Lifting the block restores the redirect
+	wantStatus(t, do("POST", "/shorturls/takedown/legal-block", `{"blocked": false}`), http.StatusOK)
+	wantStatus(t, do("GET", "/takedown", ""), http.StatusFound)
+}
+
+func TestLegalBlockRequests(t *testing.T) {
+	resetStore(t)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "takedown"})
+	wantStatus(t, do("POST", "/shorturls/takedown/legal-block", `{"blocked": true}`), http.StatusNotFound)
+
+	set(t, &adminEnabled, true)
+	wantStatus(t, do("POST", "/shorturls/missing/legal-block", `{"blocked": true}`), http.StatusNotFound)
+	wantStatus(t, do("POST", "/shorturls/takedown/legal-block", `{`), http.StatusBadRequest)
+	wantStatus(t, do("GET", "/takedown", ""), http.StatusFound)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limits on per-URL metadata
+const (
+	maxMetadataKeys     = 20
+	maxMetadataKeyLen   = 64
+	maxMetadataValueLen = 512
+)
+
+// validMetadata reports whether metadata is within the size limits
+func validMetadata(metadata map[string]string) bool {
+	if len(metadata) > maxMetadataKeys {
+		return false
+	}
+	for key, value := range metadata {
+		if key == "" || len(key) > maxMetadataKeyLen || len(value) > maxMetadataValueLen {
+			return false
+		}
+	}
+	return true
+}
+
+type ListResponse struct {
+	Total int        `json:"total"`
+	URLs  []ShortURL `json:"urls"`
+}
+
+// maxListPage caps how many URLs one list page may return
+const maxListPage = 1000
+
+// listShortURLs returns stored URLs ordered by shortcode. ?meta=key:value
+// keeps only URLs whose metadata has that exact entry, and ?meta=key only
+// those that have the key at all. ?limit= (default 100, capped at
+// maxListPage) and ?offset= page through the results.
+func listShortURLs(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit, offset, ok := parseListPage(w, r)
+	if !ok {
+		return
+	}
+	limit = min(limit, maxListPage)
+	metaKey, metaValue, matchValue := strings.Cut(query.Get("meta"), ":")
+
+	matches := []ShortURL{}
+	storeLock.RLock()
+	for _, url := range urlStore {
+		if metaKey != "" {
+			value, ok := url.Metadata[metaKey]
+			if !ok || (matchValue && value != metaValue) {
+				continue
+			}
+		}
+		matches = append(matches, url)
+	}
+	storeLock.RUnlock()
+
+	writeListPage(w, r, matches, limit, offset)
+}
+
+// maxSearchPage caps how many results one search page may return
+const maxSearchPage = 1000
+
+// searchShortURLs returns the stored URLs whose original URL contains ?q=,
+// ignoring case, paged like listShortURLs with ?limit= capped at
+// maxSearchPage
+func searchShortURLs(w http.ResponseWriter, r *http.Request) {
+	q := strings.ToLower(r.URL.Query().Get("q"))
+	if q == "" {
+		jsonError(w, `{"error": "q is required"}`, http.StatusBadRequest)
+		return
+	}
+	limit, offset, ok := parseListPage(w, r)
+	if !ok {
+		return
+	}
+	limit = min(limit, maxSearchPage)
+
+	matches := []ShortURL{}
+	storeLock.RLock()
+	for _, url := range urlStore {
+		if strings.Contains(strings.ToLower(url.OriginalURL), q) {
+			matches = append(matches, url)
+		}
+	}
+	storeLock.RUnlock()
+
+	writeListPage(w, r, matches, limit, offset)
+}
+
+// maxRecentLinks caps ?n= on the recent links listing
+const maxRecentLinks = 100
+
+// recentShortURLs returns the ?n= (default 10) most recently created URLs,
+// newest first. Expired and inactive URLs are left out unless
+// ?includeExpired=true.
+func recentShortURLs(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	n := 10
+	if v := query.Get("n"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 || parsed > maxRecentLinks {
+			jsonError(w, fmt.Sprintf(`{"error": "n must be between 1 and %d"}`, maxRecentLinks), http.StatusBadRequest)
+			return
+		}
+		n = parsed
+	}
+	includeExpired := query.Get("includeExpired") == "true"
+
+	now := time.Now()
+	matches := []ShortURL{}
+	storeLock.RLock()
+	for _, url := range urlStore {
+		if includeExpired || (url.IsActive && now.Before(url.ExpiresAt)) {
+			matches = append(matches, url)
+		}
+	}
+	storeLock.RUnlock()
+
+	sort.Slice(matches, func(i, j int) bool {
+		if !matches[i].CreatedAt.Equal(matches[j].CreatedAt) {
+			return matches[i].CreatedAt.After(matches[j].CreatedAt)
+		}
+		return matches[i].ShortCode < matches[j].ShortCode
+	})
+	response := ListResponse{Total: len(matches), URLs: matches[:min(n, len(matches))]}
+
+	w.Header().Set("Content-Type", "application/json")
+	newJSONEncoder(w, r).Encode(response)
+}
+
+// expiringShortURLs returns the active URLs that expire within ?within=, a
+// duration such as "30m", soonest first
+func expiringShortURLs(w http.ResponseWriter, r *http.Request) {
+	within, err := time.ParseDuration(r.URL.Query().Get("within"))
+	if err != nil || within <= 0 {
+		jsonError(w, `{"error": "within must be a positive duration such as 30m"}`, http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	deadline := now.Add(within)
+	matches := []ShortURL{}
+	storeLock.RLock()
+	for _, url := range urlStore {
+		if url.IsActive && now.Before(url.ExpiresAt) && !url.ExpiresAt.After(deadline) {
+			matches = append(matches, url)
+		}
+	}
+	storeLock.RUnlock()
+
+	sort.Slice(matches, func(i, j int) bool {
+		if !matches[i].ExpiresAt.Equal(matches[j].ExpiresAt) {
+			return matches[i].ExpiresAt.Before(matches[j].ExpiresAt)
+		}
+		return matches[i].ShortCode < matches[j].ShortCode
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	newJSONEncoder(w, r).Encode(ListResponse{Total: len(matches), URLs: matches})
+}
+
+// parseListPage reads ?limit= (default 100) and ?offset=, writing a 400 and
+// reporting false if either is invalid
+func parseListPage(w http.ResponseWriter, r *http.Request) (limit, offset int, ok bool) {
+	query := r.URL.Query()
+	limit = 100
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			jsonError(w, `{"error": "limit must be a non-negative integer"}`, http.StatusBadRequest)
+			return 0, 0, false
+		}
+		limit = n
+	}
+	if v := query.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			jsonError(w, `{"error": "offset must be a non-negative integer"}`, http.StatusBadRequest)
+			return 0, 0, false
+		}
+		offset = n
+	}
+	return limit, offset, true
+}
+
+// writeListPage sorts matches by shortcode and writes the requested page
+func writeListPage(w http.ResponseWriter, r *http.Request, matches []ShortURL, limit, offset int) {
+	sort.Slice(matches, func(i, j int) bool { return matches[i].ShortCode < matches[j].ShortCode })
+	response := ListResponse{Total: len(matches), URLs: []ShortURL{}}
+	if offset < len(matches) {
+		response.URLs = matches[offset : offset+min(limit, len(matches)-offset)]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	newJSONEncoder(w, r).Encode(response)
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// listCodes returns the shortcodes of a list response, in order
+func listCodes(t *testing.T, target string) []string {
+	t.Helper()
+	rec := do("GET", target, "")
+	wantStatus(t, rec, http.StatusOK)
+	var response ListResponse
+	decode(t, rec, &response)
+	codes := []string{}
+	for _, url := range response.URLs {
+		codes = append(codes, url.ShortCode)
+	}
+	return codes
+}
+
+func TestMetadata(t *testing.T) {
+	resetStore(t)
+	wantStatus(t, do("POST", "/shorturls", `{"url": "https://example.com", "shortcode": "meta",
+		"metadata": {"campaign": "spring", "note": "hello"}}`), http.StatusCreated)
+
+	var info ShortURL
+	decode(t, do("GET", "/shorturls/meta/info", ""), &info)
+	if info.Metadata["campaign"] != "spring" || info.Metadata["note"] != "hello" {
+		t.Errorf("info metadata = %v", info.Metadata)
+	}
+	stats := getStats(t, "meta")
+	if len(stats.Metadata) != 2 {
+		t.Errorf("stats metadata = %v", stats.Metadata)
+	}
+}
+
+func TestMetadataLimits(t *testing.T) {
+	resetStore(t)
+	tooMany := make([]string, maxMetadataKeys+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf(`"k%d": "v"`, i)
+	}
+	for _, metadata := range []string{
+		`{` + strings.Join(tooMany, ", ") + `}`,
+		`{"": "empty key"}`,
+		`{"` + strings.Repeat("k", maxMetadataKeyLen+1) + `": "v"}`,
+		`{"k": "` + strings.Repeat("v", maxMetadataValueLen+1) + `"}`,
+	} {
+		rec := do("POST", "/shorturls", `{"url": "https://example.com", "metadata": `+metadata+`}`)
+		wantStatus(t, rec, http.StatusBadRequest)
+	}
+}
+
+func TestListFilterByMetadata(t *testing.T) {
+	resetStore(t)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "a", Metadata: map[string]string{"campaign": "spring"}})
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "b", Metadata: map[string]string{"campaign": "autumn"}})
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "c"})
+
+	tests := map[string]string{
+		"/shorturls":                                    "a,b,c",
+		"/shorturls?meta=campaign":                      "a,b",
+		"/shorturls?meta=campaign:autumn":               "b",
+		"/shorturls?meta=campaign:":                     "",
+		"/shorturls?meta=owner":                         "",
+		"/shorturls?limit=9223372036854775807&offset=1": "b,c",
+	}
+	for target, want := range tests {
+		if got := strings.Join(listCodes(t, target), ","); got != want {
+			t.Errorf("%s lists %q, want %q", target, got, want)
+		}
+	}
+}
+
+func TestListPageCap(t *testing.T) {
+	resetStore(t)
+	for i := 0; i <= maxListPage; i++ {
+		mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: fmt.Sprintf("c%04d", i)})
+	}
+	if got := len(listCodes(t, "/shorturls?limit=5000")); got != maxListPage {
+		t.Errorf("listed %d URLs, want the %d cap", got, maxListPage)
+	}
+}
+
+func TestSearchShortURLs(t *testing.T) {
+	resetStore(t)
+	mustCreate(t, ShortURLRequest{URL: "https://shop.example.com/Spring-Sale", Shortcode: "a"})
+	mustCreate(t, ShortURLRequest{URL: "https://blog.example.com/spring", Shortcode: "b"})
+	mustCreate(t, ShortURLRequest{URL: "https://example.org/autumn", Shortcode: "c"})
+
+	tests := map[string]string{
+		"/shorturls/search?q=spring":                                     "a,b",
+		"/shorturls/search?q=SALE":                                       "a",
+		"/shorturls/search?q=example":                                    "a,b,c",
+		"/shorturls/search?q=winter":                                     "",
+		"/shorturls/search?q=example&limit=1&offset=1":                   "b",
+		"/shorturls/search?q=example&limit=9223372036854775807&offset=2": "c",
+	}
+	for target, want := range tests {
+		if got := strings.Join(listCodes(t, target), ","); got != want {
+			t.Errorf("%s finds %q, want %q", target, got, want)
+		}
+	}
+
+	var response ListResponse
+	decode(t, do("GET", "/shorturls/search?q=example&limit=1", ""), &response)
+	if response.Total != 3 || len(response.URLs) != 1 {
+		t.Errorf("paged search = %d of %d, want 1 of 3", len(response.URLs), response.Total)
+	}
+	wantStatus(t, do("GET", "/shorturls/search", ""), http.StatusBadRequest)
+	wantStatus(t, do("GET", "/shorturls/search?q=a&limit=x", ""), http.StatusBadRequest)
+}
+
+// editLink changes the stored link for code in place
+func editLink(t *testing.T, code string, edit func(*ShortURL)) {
+	t.Helper()
+	storeLock.Lock()
+	defer storeLock.Unlock()
+	url, ok := urlStore[code]
+	if !ok {
+		t.Fatalf("no link %q", code)
+	}
+	edit(&url)
+	urlStore[code] = url
+}
+
+func TestRecentShortURLs(t *testing.T) {
+	resetStore(t)
+	// Created an hour apart, oldest first, and then one deactivated and one
+	// left to expire
+	for i, code := range []string{"e", "d", "c", "b", "a"} {
+		mustCreate(t, ShortURLRequest{URL: "https://example.com/" + code, Shortcode: code})
+		editLink(t, code, func(url *ShortURL) {
+			url.CreatedAt = time.Now().Add(-time.Duration(5-i) * time.Hour)
+		})
+	}
+	editLink(t, "b", func(url *ShortURL) { url.IsActive = false })
+	expireLink(t, "d")
+
+	if got := strings.Join(listCodes(t, "/shorturls/recent"), ","); got != "a,c,e" {
+		t.Errorf("recent = %s, want a,c,e", got)
+	}
+	if got := strings.Join(listCodes(t, "/shorturls/recent?n=2"), ","); got != "a,c" {
+		t.Errorf("recent?n=2 = %s, want a,c", got)
+	}
+	if got := strings.Join(listCodes(t, "/shorturls/recent?n=4&includeExpired=true"), ","); got != "a,b,c,d" {
+		t.Errorf("recent with expired = %s, want a,b,c,d", got)
+	}
+
+	rec := do("GET", "/shorturls/recent?n=1", "")
+	var response ListResponse
+	decode(t, rec, &response)
+	if response.Total != 3 {
+		t.Errorf("total = %d, want all 3 active links", response.Total)
+	}
+
+	for _, n := range []string{"0", "-1", "101", "ten"} {
+		wantStatus(t, do("GET", "/shorturls/recent?n="+n, ""), http.StatusBadRequest)
+	}
+}
+
+func TestExpiringShortURLs(t *testing.T) {
+	resetStore(t)
+	for code, validity := range map[string]int{"soon": 10, "sooner": 5, "later": 60, "edge": 30, "off": 1} {
+		mustCreate(t, ShortURLRequest{URL: "https://example.com/" + code, Shortcode: code, Validity: validity})
+	}
+	mustCreate(t, ShortURLRequest{URL: "https://example.com/gone", Shortcode: "gone"})
+	expireLink(t, "gone")
+	editLink(t, "off", func(url *ShortURL) { url.IsActive = false })
+
+	if got := strings.Join(listCodes(t, "/shorturls/expiring?within=30m"), ","); got != "sooner,soon,edge" {
+		t.Errorf("expiring within 30m = %s, want sooner,soon,edge", got)
+	}
+	if got := strings.Join(listCodes(t, "/shorturls/expiring?within=1m"), ","); got != "" {
+		t.Errorf("expiring within 1m = %s, want none", got)
+	}
+	rec := do("GET", "/shorturls/expiring?within=2h", "")
+	var response ListResponse
+	decode(t, rec, &response)
+	if response.Total != 4 || len(response.URLs) != 4 {
+		t.Errorf("within 2h: total %d with %d links, want 4", response.Total, len(response.URLs))
+	}
+
+	for _, within := range []string{"", "30", "-5m", "0s", "soon"} {
+		wantStatus(t, do("GET", "/shorturls/expiring?within="+within, ""), http.StatusBadRequest)
+	}
+}
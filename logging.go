@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Logging settings, populated from the environment in main
+var (
+	logBodies    bool
+	logBodyLimit = 1024
+	logMinLevel  = levelDebug
+	logRoutes    []routeLevel
+)
+
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+func parseLogLevel(s string) (logLevel, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return levelDebug, nil
+	case "info":
+		return levelInfo, nil
+	case "warn", "warning":
+		return levelWarn, nil
+	case "error":
+		return levelError, nil
+	}
+	return levelDebug, fmt.Errorf("unknown log level %q", s)
+}
+
+// routeLevel assigns a log level to requests whose path starts with prefix
+type routeLevel struct {
+	prefix string
+	level  logLevel
+}
+
+// parseRouteLevels parses overrides of the form "/shorturls=debug,/admin=warn",
+// ordered longest prefix first so the most specific override wins
+func parseRouteLevels(s string) ([]routeLevel, error) {
+	var routes []routeLevel
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		prefix, name, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("route level %q must be prefix=level", item)
+		}
+		level, err := parseLogLevel(name)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, routeLevel{prefix: strings.TrimSpace(prefix), level: level})
+	}
+	sort.SliceStable(routes, func(i, j int) bool {
+		return len(routes[i].prefix) > len(routes[j].prefix)
+	})
+	return routes, nil
+}
+
+// maxLoggedBody caps how much of a body is held for logging. Bodies past it
+// are passed through untouched and only logged as too large.
+const maxLoggedBody = 64 << 10
+
+// sensitiveFields are JSON keys whose values are never written to the log
+var sensitiveFields = []string{"password", "secret", "token", "apikey", "api_key", "authorization"}
+
+// CustomLogger is the logging middleware from Pre-Test Setup
+type CustomLogger struct {
+	handler http.Handler
+	// logBodies enables debug logging of request and response bodies,
+	// truncated to bodyLimit bytes
+	logBodies bool
+	bodyLimit int
+	// Requests are logged at info level unless a route override applies, and
+	// only when that level reaches minLevel
+	minLevel logLevel
+	routes   []routeLevel
+}
+
+// levelFor returns the log level of requests to path
+func (l *CustomLogger) levelFor(path string) logLevel {
+	for _, route := range l.routes {
+		if strings.HasPrefix(path, route.prefix) {
+			return route.level
+		}
+	}
+	return levelInfo
+}
+
+func (l *CustomLogger) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if l.levelFor(r.URL.Path) < l.minLevel {
+		l.handler.ServeHTTP(w, r)
+		return
+	}
+
+	start := time.Now()
+	if !l.logBodies {
+		l.handler.ServeHTTP(w, r)
+		log.Printf("%s %s %v", r.Method, r.URL.Path, time.Since(start))
+		return
+	}
+
+	var reqBody []byte
+	if r.Body != nil {
+		// Read one byte past the cap to tell a body that fits from one that
+		// does not, then hand the handler what was read followed by the rest
+		reqBody, _ = io.ReadAll(io.LimitReader(r.Body, maxLoggedBody+1))
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(reqBody), r.Body), r.Body}
+	}
+	rec := &bodyRecorder{ResponseWriter: w}
+	l.handler.ServeHTTP(rec, r)
+	log.Printf("%s %s %v request=%q response=%q", r.Method, r.URL.Path, time.Since(start),
+		formatBody(reqBody, l.bodyLimit), formatBody(rec.buf.Bytes(), l.bodyLimit))
+}
+
+// bodyRecorder captures the response body as it is written. It keeps all of
+// it up to one byte past maxLoggedBody, since a JSON body cut short can no
+// longer be parsed and redacted.
+type bodyRecorder struct {
+	http.ResponseWriter
+	buf bytes.Buffer
+}
+
+func (rec *bodyRecorder) Write(p []byte) (int, error) {
+	if room := maxLoggedBody + 1 - rec.buf.Len(); room > 0 {
+		rec.buf.Write(p[:min(len(p), room)])
+	}
+	return rec.ResponseWriter.Write(p)
+}
+
+func (rec *bodyRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// formatBody redacts sensitive JSON fields and truncates the body to limit
+// bytes. Bodies that are not JSON cannot be redacted, and ones captured past
+// maxLoggedBody are not worth parsing, so only their size is logged.
+func formatBody(body []byte, limit int) string {
+	if len(body) == 0 {
+		return ""
+	}
+	if len(body) > maxLoggedBody {
+		return fmt.Sprintf("(over %d bytes, too large to log)", maxLoggedBody)
+	}
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return fmt.Sprintf("(%d bytes, not JSON)", len(body))
+	}
+	redacted, err := json.Marshal(redact(doc))
+	if err != nil {
+		return fmt.Sprintf("(%d bytes, not JSON)", len(body))
+	}
+	body = redacted
+	if len(body) > limit {
+		return string(body[:limit]) + "...(truncated)"
+	}
+	return string(body)
+}
+
+// redact replaces the values of sensitive keys anywhere in a decoded JSON document
+func redact(v interface{}) interface{} {
+	switch doc := v.(type) {
+	case map[string]interface{}:
+		for key, value := range doc {
+			if isSensitiveField(key) {
+				doc[key] = "[REDACTED]"
+			} else {
+				doc[key] = redact(value)
+			}
+		}
+	case []interface{}:
+		for i, value := range doc {
+			doc[i] = redact(value)
+		}
+	}
+	return v
+}
+
+func isSensitiveField(key string) bool {
+	key = strings.ToLower(key)
+	for _, field := range sensitiveFields {
+		if strings.Contains(key, field) {
+			return true
+		}
+	}
+	return false
+}
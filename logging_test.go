@@ -0,0 +1,130 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFormatBodyRedactsBeforeTruncating(t *testing.T) {
+	// The secret sits past the limit in a body too long to log whole, so
+	// cutting first would leave JSON that can no longer be redacted
+	body := `{"padding": "` + strings.Repeat("x", 60) + `", "password": "hunter2"}`
+	got := formatBody([]byte(body), 40)
+	if strings.Contains(got, "hunter2") {
+		t.Errorf("formatBody leaked the password: %q", got)
+	}
+	if !strings.HasSuffix(got, "...(truncated)") || len(got) != 40+len("...(truncated)") {
+		t.Errorf("formatBody = %q, want 40 bytes and a truncation marker", got)
+	}
+
+	got = formatBody([]byte(`{"user": {"apiKey": "k", "name": "n"}}`), 1024)
+	if got != `{"user":{"apiKey":"[REDACTED]","name":"n"}}` {
+		t.Errorf("nested redaction = %q", got)
+	}
+}
+
+func TestFormatBodyNotJSON(t *testing.T) {
+	if got := formatBody([]byte("token=abc"), 1024); got != "(9 bytes, not JSON)" {
+		t.Errorf("formatBody = %q", got)
+	}
+	if got := formatBody(nil, 1024); got != "" {
+		t.Errorf("formatBody(nil) = %q, want empty", got)
+	}
+}
+
+func TestLoggedBodies(t *testing.T) {
+	resetStore(t)
+	set(t, &logBodies, true)
+	logged := captureLog(t)
+
+	do("POST", "/shorturls", `{"url": "https://example.com", "secret": "s3cret"}`)
+	line := logged.String()
+	if !strings.Contains(line, "POST /shorturls") || !strings.Contains(line, "shortLink") {
+		t.Errorf("log line %q is missing the request or response", line)
+	}
+	if strings.Contains(line, "s3cret") {
+		t.Errorf("log line %q leaked the secret", line)
+	}
+}
+
+func TestLoggedBodiesTooLarge(t *testing.T) {
+	resetStore(t)
+	set(t, &logBodies, true)
+	logged := captureLog(t)
+
+	// The handler still gets the whole body, while the log only notes its size
+	padding := strings.Repeat("x", 2*maxLoggedBody)
+	body := `{"url": "https://example.com/` + padding + `", "password": "hunter2"}`
+	rec := do("POST", "/shorturls", body)
+	wantStatus(t, rec, http.StatusCreated)
+	line := logged.String()
+	if strings.Contains(line, "hunter2") || strings.Contains(line, padding[:100]) {
+		t.Errorf("log line of %d bytes holds the oversized body", len(line))
+	}
+	if !strings.Contains(line, "request=\"(over 65536 bytes, too large to log)\"") {
+		t.Errorf("log line %q does not mark the request as too large", line[:min(len(line), 300)])
+	}
+}
+
+func TestBodyRecorderCapsBuffer(t *testing.T) {
+	rec := &bodyRecorder{ResponseWriter: httptest.NewRecorder()}
+	chunk := []byte(strings.Repeat("x", 1000))
+	for written := 0; written < 3*maxLoggedBody; written += len(chunk) {
+		if n, err := rec.Write(chunk); n != len(chunk) || err != nil {
+			t.Fatalf("Write = %d, %v", n, err)
+		}
+	}
+	if rec.buf.Len() != maxLoggedBody+1 {
+		t.Errorf("recorder buffered %d bytes, want %d", rec.buf.Len(), maxLoggedBody+1)
+	}
+	if rec.ResponseWriter.(*httptest.ResponseRecorder).Body.Len() < 3*maxLoggedBody {
+		t.Error("recorder did not pass the whole body through")
+	}
+	if got := formatBody(rec.buf.Bytes(), 1024); got != "(over 65536 bytes, too large to log)" {
+		t.Errorf("formatBody = %q", got)
+	}
+}
+
+func TestParseRouteLevels(t *testing.T) {
+	routes, err := parseRouteLevels(" /shorturls=warn, /shorturls/recent=debug,,/admin=ERROR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &CustomLogger{routes: routes}
+	tests := map[string]logLevel{
+		"/shorturls/abc":    levelWarn,
+		"/shorturls/recent": levelDebug,
+		"/admin/flush":      levelError,
+		"/abc":              levelInfo,
+	}
+	for path, want := range tests {
+		if got := l.levelFor(path); got != want {
+			t.Errorf("levelFor(%q) = %v, want %v", path, got, want)
+		}
+	}
+
+	for _, bad := range []string{"/admin", "/admin=loud"} {
+		if _, err := parseRouteLevels(bad); err == nil {
+			t.Errorf("parseRouteLevels(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestRouteLevelsFilterLogging(t *testing.T) {
+	resetStore(t)
+	routes, _ := parseRouteLevels("/healthz=debug")
+	set(t, &logRoutes, routes)
+	set(t, &logMinLevel, levelInfo)
+	logged := captureLog(t)
+
+	do("GET", "/healthz", "")
+	if logged.Len() != 0 {
+		t.Errorf("debug route logged at info level: %q", logged.String())
+	}
+	do("GET", "/readyz", "")
+	if !strings.Contains(logged.String(), "GET /readyz") {
+		t.Errorf("info route not logged: %q", logged.String())
+	}
+}
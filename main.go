@@ -4,32 +4,37 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"math/rand"
 	"net/http"
 	"os"
+	"os/signal"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
-	"github.com/speps/go-hashids"
 )
 
-// CustomLogger is the logging middleware from Pre-Test Setup
-type CustomLogger struct {
-	handler http.Handler
-}
-
-func (l *CustomLogger) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
-	l.handler.ServeHTTP(w, r)
-	log.Printf("%s %s %v", r.Method, r.URL.Path, time.Since(start))
-}
-
 // In-memory storage
 var (
 	urlStore  = make(map[string]ShortURL)
-	analytics = make(map[string][]Click)
-	storeLock sync.RWMutex
+	analytics = make(map[string]*clickLog)
+	// clickCounts holds the total redirects through each code, kept apart
+	// from the click details so it survives sampling and retention pruning
+	clickCounts = make(map[string]*atomic.Int64)
+	// botClickCounts holds how many of those redirects came from bots, so
+	// bots are told apart even for clicks sampled out or pruned
+	botClickCounts = make(map[string]*atomic.Int64)
+	// tombstones map rotated-out codes to the code that replaced them
+	tombstones = make(map[string]string)
+	// retiredCodes are codes rotated out without a tombstone. They are never
+	// generated again, so the deterministic generator cannot revive them.
+	retiredCodes = make(map[string]bool)
+	storeLock    sync.RWMutex
 )
 
 // Models
@@ -39,181 +44,884 @@ type ShortURL struct {
 	CreatedAt   time.Time `json:"createdAt"`
 	ExpiresAt   time.Time `json:"expiresAt"`
 	IsActive    bool      `json:"isActive"`
+	// Destinations holds the targets of a link group; each redirect picks one
+	// at random in proportion to its weight
+	Destinations []Destination `json:"destinations,omitempty"`
+	// TrackAnalytics is false for privacy links, whose clicks are only counted
+	TrackAnalytics bool `json:"trackAnalytics"`
+	// RedirectStatus is the HTTP status used for redirects: 301, 302, 307 or 308
+	RedirectStatus int `json:"redirectStatus"`
+	// Tags group links into campaigns for aggregate stats
+	Tags []string `json:"tags,omitempty"`
+	// FaviconURL is resolved from the destination at creation when FETCH_FAVICON is set
+	FaviconURL string `json:"faviconUrl,omitempty"`
+	// LastAccessedAt is the time of the most recent redirect
+	LastAccessedAt time.Time `json:"lastAccessedAt,omitzero"`
+	// FirstClickAt is the time of the first redirect, kept even after the
+	// click details are pruned
+	FirstClickAt time.Time `json:"firstClickAt,omitzero"`
+	// ClickSampleRate is the fraction of clicks stored with details; 0 means
+	// the global CLICK_SAMPLE_RATE applies
+	ClickSampleRate float64 `json:"clickSampleRate,omitempty"`
+	// RedirectMode is "http" or "html"; empty means the global REDIRECT_MODE
+	RedirectMode string `json:"redirectMode,omitempty"`
+	// AutoDeactivateAfter deactivates the link once it has served this many
+	// redirects since it was last activated; 0 disables it
+	AutoDeactivateAfter   int `json:"autoDeactivateAfter,omitempty"`
+	ClicksSinceActivation int `json:"clicksSinceActivation,omitempty"`
+	// Metadata holds opaque caller-supplied key-value pairs
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// UserAgentRules override the destination for matching user agents
+	UserAgentRules []UserAgentRule `json:"userAgentRules,omitempty"`
+	// CountryRules maps ISO country codes to destination overrides
+	CountryRules map[string]string `json:"countryRules,omitempty"`
+	// UTM holds the utm_* parameters of the original URL, parsed at creation
+	UTM map[string]string `json:"utm,omitempty"`
+	// Tenant is the prefix of the API key that created the link
+	Tenant string `json:"tenant,omitempty"`
+	// LegalBlocked links answer 451 with LegalNotice, or LEGAL_BLOCK_NOTICE
+	// when it is empty
+	LegalBlocked bool   `json:"legalBlocked,omitempty"`
+	LegalNotice  string `json:"legalNotice,omitempty"`
+	// InactivityExpiry removes the link once it has gone this many seconds
+	// without a redirect, regardless of ExpiresAt; 0 disables it
+	InactivityExpiry int `json:"inactivityExpiry,omitempty"`
+	// RedirectRateLimit caps redirects per second through this link,
+	// overriding REDIRECT_RATE_LIMIT; 0 uses the default
+	RedirectRateLimit float64 `json:"redirectRateLimit,omitempty"`
+	// TrackFirstClickOnly keeps the details of the first click alone; later
+	// clicks are only counted
+	TrackFirstClickOnly bool `json:"trackFirstClickOnly,omitempty"`
+	// Audited sends every access to the audit sink as well as analytics
+	Audited bool `json:"audited,omitempty"`
 }
 
 type ShortURLRequest struct {
-	URL       string `json:"url"`
-	Validity  int    `json:"validity"`
-	Shortcode string `json:"shortcode"`
+	URL      string `json:"url"`
+	Validity int    `json:"validity"`
+	// ValidityUnit is seconds, minutes, hours or days; defaults to minutes
+	ValidityUnit string `json:"validityUnit"`
+	Shortcode    string `json:"shortcode"`
+	// URLs creates a link group that redirects randomly among several destinations
+	URLs []string `json:"urls"`
+	// Destinations creates a link group with weighted traffic, e.g. 80/20
+	Destinations []Destination `json:"destinations"`
+	// Signed issues a self-contained /s/ link instead of storing the URL
+	Signed bool `json:"signed"`
+	// TrackAnalytics defaults to true; false records no per-click details
+	TrackAnalytics *bool `json:"trackAnalytics"`
+	// RedirectStatus selects 301, 302, 307 or 308; defaults to 302
+	RedirectStatus int      `json:"redirectStatus"`
+	Tags           []string `json:"tags"`
+	// ClickSampleRate overrides CLICK_SAMPLE_RATE for this link (0.0–1.0)
+	ClickSampleRate float64 `json:"clickSampleRate"`
+	// RedirectMode selects "http" redirects or an "html" meta-refresh page
+	RedirectMode string `json:"redirectMode"`
+	// AutoDeactivateAfter deactivates the link after this many redirects
+	AutoDeactivateAfter int `json:"autoDeactivateAfter"`
+	// Metadata is stored as-is, within the limits of validMetadata
+	Metadata map[string]string `json:"metadata"`
+	// UserAgentRules redirect matching user agents elsewhere, first match wins
+	UserAgentRules []UserAgentRule `json:"userAgentRules"`
+	// CountryRules sends visitors from a country (ISO code) to its own URL
+	CountryRules map[string]string `json:"countryRules"`
+	// InactivityExpiry expires the link after this many idle seconds
+	InactivityExpiry int `json:"inactivityExpiry"`
+	// RedirectRateLimit caps redirects per second through the link
+	RedirectRateLimit float64 `json:"redirectRateLimit"`
+	// TrackFirstClickOnly records the details of the first click only
+	TrackFirstClickOnly bool `json:"trackFirstClickOnly"`
+	// Audited logs every access to the link to the audit sink
+	Audited bool `json:"audited"`
+	// Tenant comes from the X-API-Key header, never from the body
+	Tenant string `json:"-"`
+	// Upsert returns a live link to the same URL instead of creating one; it
+	// is set by the upsert endpoint
+	Upsert bool `json:"-"`
+}
+
+type Destination struct {
+	URL    string `json:"url"`
+	Weight int    `json:"weight"`
 }
 
 type ShortURLResponse struct {
 	ShortLink string `json:"shortLink"`
 	Expiry    string `json:"expiry"`
+	// QRCode is a base64 PNG QR code of ShortLink, included for ?qr=true
+	QRCode string `json:"qrCode,omitempty"`
 }
 
 type URLStats struct {
-	OriginalURL  string    `json:"originalUrl"`
-	CreatedAt    time.Time `json:"createdAt"`
-	ExpiresAt    time.Time `json:"expiresAt"`
-	TotalClicks  int       `json:"totalClicks"`
-	ClickDetails []Click   `json:"clickDetails"`
+	OriginalURL string    `json:"originalUrl"`
+	CreatedAt   time.Time `json:"createdAt"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+	// TotalClicks leaves out bot clicks unless COUNT_BOT_CLICKS is set
+	TotalClicks  int     `json:"totalClicks"`
+	HumanClicks  int     `json:"humanClicks"`
+	BotClicks    int     `json:"botClicks"`
+	ClickDetails []Click `json:"clickDetails"`
+	// RemainingSeconds is the time left before expiry, 0 once expired and
+	// -1 for links that never expire
+	RemainingSeconds int64 `json:"remainingSeconds"`
+	// ClicksByDestination breaks clicks down per target for link groups
+	ClicksByDestination map[string]int `json:"clicksByDestination,omitempty"`
+	// DestinationBreakdown compares each target's weight with its actual share
+	DestinationBreakdown []DestinationStats `json:"destinationBreakdown,omitempty"`
+	// ClicksByReferrerDomain groups clicks by referring host, with "direct"
+	// for clicks that sent no referrer
+	ClicksByReferrerDomain map[string]int    `json:"clicksByReferrerDomain"`
+	FaviconURL             string            `json:"faviconUrl,omitempty"`
+	Metadata               map[string]string `json:"metadata,omitempty"`
+	// Locations clusters clicks with GeoIP coordinates for heat-mapping
+	Locations []GeoCluster `json:"locations"`
+	// UTM attributes clicks to the campaign parameters of their destination
+	UTM UTMBreakdown `json:"utm"`
+	// ClicksByLanguage groups clicks by visitor language, with "unknown" for
+	// clicks without a usable Accept-Language
+	ClicksByLanguage map[string]int `json:"clicksByLanguage"`
+	// ClicksByOS groups clicks by operating system family, with "Other" for
+	// user agents that name none of the common ones
+	ClicksByOS map[string]int `json:"clicksByOS"`
+	// ClicksByFraudBucket counts clicks as low, medium or high fraud risk
+	ClicksByFraudBucket map[string]int `json:"clicksByFraudBucket"`
+	// ValidClicks is TotalClicks less high-risk human clicks when
+	// EXCLUDE_FRAUD_CLICKS is set, and equal to it otherwise
+	ValidClicks int `json:"validClicks"`
+	// TimeToFirstClick is the number of seconds between creation and the
+	// first click, null until the link is clicked
+	TimeToFirstClick *float64 `json:"timeToFirstClick"`
+}
+
+type DestinationStats struct {
+	URL           string  `json:"url"`
+	Weight        int     `json:"weight"`
+	ExpectedShare float64 `json:"expectedShare"`
+	Clicks        int     `json:"clicks"`
+	Share         float64 `json:"share"`
 }
 
 type Click struct {
-	Timestamp time.Time `json:"timestamp"`
-	Referrer  string    `json:"referrer"`
-	UserAgent string    `json:"userAgent"`
-	IPAddress string    `json:"ipAddress"`
+	// SchemaVersion is the click format version, always clickSchemaVersion
+	// once decoded
+	SchemaVersion int       `json:"schemaVersion"`
+	Timestamp     time.Time `json:"timestamp"`
+	Referrer      string    `json:"referrer"`
+	UserAgent     string    `json:"userAgent"`
+	IPAddress     string    `json:"ipAddress"`
+	// Destination records which target of a link group was served
+	Destination string `json:"destination,omitempty"`
+	// Country and coordinates are filled from GEOIP_DB when configured
+	Country   string   `json:"country,omitempty"`
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+	// MatchedRule is the pattern of the user agent rule that chose the destination
+	MatchedRule string `json:"matchedRule,omitempty"`
+	// MatchedCountry is set when a country rule chose the destination
+	MatchedCountry string `json:"matchedCountry,omitempty"`
+	// Language is the visitor's first Accept-Language locale
+	Language string `json:"language,omitempty"`
+	// FraudScore rates how likely the click is to be fake, from 0 to 100
+	FraudScore int `json:"fraudScore"`
+	// IsBot marks clicks whose user agent matches the bot patterns
+	IsBot bool `json:"isBot"`
+}
+
+// validityUnits maps the accepted validityUnit values to durations
+var validityUnits = map[string]time.Duration{
+	"":        time.Minute,
+	"seconds": time.Second,
+	"minutes": time.Minute,
+	"hours":   time.Hour,
+	"days":    24 * time.Hour,
 }
 
+// serverTiming adds a Server-Timing header to redirects, breaking down the
+// store lookup and analytics recording for debugging lock contention
+var serverTiming bool
+
+// prettyJSON indents every JSON response, for debugging; ?pretty=true does
+// the same for a single request
+var prettyJSON bool
+
+// clickSampleRate is the default fraction of clicks stored with details
+var clickSampleRate = 1.0
+
 // Handlers
 func createShortURL(w http.ResponseWriter, r *http.Request) {
 	var req ShortURLRequest
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		jsonError(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
 		return
 	}
 
-	// Validate URL
-	if !strings.HasPrefix(req.URL, "http://") && !strings.HasPrefix(req.URL, "https://") {
-		http.Error(w, `{"error": "URL must start with http:// or https://"}`, http.StatusBadRequest)
+	createFromRequest(w, r, req)
+}
+
+// upsertShortURL returns the live link the caller already has for the URL,
+// creating one only if there is none
+func upsertShortURL(w http.ResponseWriter, r *http.Request) {
+	var req ShortURLRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
 		return
 	}
-
-	// Set default validity if not provided
-	if req.Validity == 0 {
-		req.Validity = 30
+	if req.Signed {
+		jsonError(w, `{"error": "Signed links cannot be upserted"}`, http.StatusBadRequest)
+		return
 	}
+	req.Upsert = true
 
-	expiresAt := time.Now().Add(time.Duration(req.Validity) * time.Minute)
-
-	var shortCode string
-	if req.Shortcode != "" {
-		// Check if custom shortcode is available
-		storeLock.RLock()
-		_, exists := urlStore[req.Shortcode]
-		storeLock.RUnlock()
+	createFromRequest(w, r, req)
+}
 
-		if exists {
-			http.Error(w, `{"error": "Shortcode already in use"}`, http.StatusConflict)
+// createShortURLFromQuery creates a short URL from ?url=, ?validity= and
+// ?shortcode= for clients that can only issue GET requests. It is only
+// registered when ALLOW_GET_CREATE is set.
+func createShortURLFromQuery(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	req := ShortURLRequest{
+		URL:          query.Get("url"),
+		Shortcode:    query.Get("shortcode"),
+		ValidityUnit: query.Get("validityUnit"),
+	}
+	if v := query.Get("validity"); v != "" {
+		validity, err := strconv.Atoi(v)
+		if err != nil {
+			jsonError(w, `{"error": "validity must be an integer"}`, http.StatusBadRequest)
 			return
 		}
-		shortCode = req.Shortcode
-	} else {
-		// Generate unique shortcode
-		hd := hashids.NewData()
-		hd.Salt = "url-shortener-salt"
-		hd.MinLength = 5
-		h, _ := hashids.NewWithData(hd)
-		shortCode, _ = h.Encode([]int{int(time.Now().Unix())})
+		req.Validity = validity
 	}
 
-	// Store in memory
-	newURL := ShortURL{
-		ShortCode:   shortCode,
-		OriginalURL: req.URL,
-		CreatedAt:   time.Now(),
-		ExpiresAt:   expiresAt,
-		IsActive:    true,
+	createFromRequest(w, r, req)
+}
+
+// createFromRequest validates req and stores the new short URL
+func createFromRequest(w http.ResponseWriter, r *http.Request, req ShortURLRequest) {
+	tenant, ok := requestTenant(r)
+	if !ok {
+		jsonError(w, `{"error": "Invalid API key"}`, http.StatusUnauthorized)
+		return
 	}
+	req.Tenant = tenant
 
-	storeLock.Lock()
-	urlStore[shortCode] = newURL
-	analytics[shortCode] = []Click{}
-	storeLock.Unlock()
+	if req.Signed {
+		url, err := prepareURL(req, r.Host)
+		if err != nil {
+			writeServiceError(w, r, err)
+			return
+		}
+		issueSignedLink(w, r, url.OriginalURL, url.ExpiresAt)
+		return
+	}
 
-	host := r.Host
-	if host == "" {
-		host = "localhost:8080"
+	url, created, err := CreateURL(req, r.Host)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
 	}
 
 	response := ShortURLResponse{
-		ShortLink: fmt.Sprintf("http://%s/%s", host, shortCode),
-		Expiry:    expiresAt.Format(time.RFC3339),
+		ShortLink: fmt.Sprintf("%s/%s", baseURL(r), url.ShortCode),
+		Expiry:    url.ExpiresAt.Format(time.RFC3339),
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(response)
+	if !created {
+		// An upsert or the deterministic generator found an existing code
+		writeShortLink(w, r, response, http.StatusOK)
+		return
+	}
+	writeCreated(w, r, response)
 }
 
 func redirectShortURL(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	shortCode := vars["shortcode"]
 
-	storeLock.RLock()
-	url, exists := urlStore[shortCode]
-	storeLock.RUnlock()
-
-	if !exists || !url.IsActive {
-		http.Error(w, `{"error": "Short URL not found"}`, http.StatusNotFound)
+	lookupStart := time.Now()
+	url, err := Resolve(shortCode)
+	lookupTime := time.Since(lookupStart)
+	if err != nil {
+		auditFailure(r, shortCode, err)
+		writeServiceError(w, r, err)
 		return
 	}
 
-	if time.Now().After(url.ExpiresAt) {
-		http.Error(w, `{"error": "Short URL has expired"}`, http.StatusGone)
+	// Throttled attempts still show up in the redirect rate
+	redirectRates.hit(shortCode, time.Now())
+	if retry, throttled := redirectThrottled(url, time.Now()); throttled {
+		if url.Audited {
+			auditRedirect(r, shortCode, "throttled", "")
+		}
+		w.Header().Set("Retry-After", retry)
+		jsonError(w, `{"error": "Too many redirects for this link", "code": "throttled"}`, http.StatusTooManyRequests)
 		return
 	}
+	redirectsTotal.Add(1)
+
+	destination := url.OriginalURL
+	if len(url.Destinations) > 0 {
+		destination = pickDestination(url.Destinations)
+	}
+	// Country rules need the lookup up front; otherwise it waits for the click
+	ip := clientIP(r)
+	var geo geoInfo
+	if len(url.CountryRules) > 0 {
+		geo = lookupGeo(ip)
+	}
+	matchedCountry := ""
+	if dest, ok := url.CountryRules[geo.Country]; ok && geo.Country != "" {
+		destination = dest
+		matchedCountry = geo.Country
+	}
+	// A user agent rule is the most specific match and wins over the country
+	rule, ruleMatched := matchUserAgentRule(url.UserAgentRules, r.UserAgent())
+	if ruleMatched {
+		destination = rule.URL
+		matchedCountry = ""
+	}
 
-	// Record analytics
-	click := Click{
-		Timestamp: time.Now(),
-		Referrer:  r.Referer(),
-		UserAgent: r.UserAgent(),
-		IPAddress: strings.Split(r.RemoteAddr, ":")[0],
+	// Record analytics; privacy links and sampled-out clicks are only counted
+	now := time.Now()
+	bot := isBotUserAgent(r.UserAgent())
+	var click *Click
+	// Sampling would risk missing the one click a first-click link keeps
+	if url.TrackAnalytics && (url.TrackFirstClickOnly || sampleClick(url)) {
+		click = &Click{
+			SchemaVersion: clickSchemaVersion,
+			Timestamp:     now,
+			Referrer:      r.Referer(),
+			UserAgent:     r.UserAgent(),
+			IPAddress:     anonymizeIP(ip),
+			Language:      clickLanguage(r.Header.Get("Accept-Language")),
+		}
+		click.IsBot = bot
+		click.FraudScore = fraudScore(ip, click.IsBot, click.Referrer)
+		if len(url.CountryRules) == 0 {
+			geo = lookupGeo(ip)
+		}
+		applyGeo(click, geo)
+		if len(url.Destinations) > 0 || ruleMatched || matchedCountry != "" {
+			click.Destination = destination
+		}
+		if ruleMatched {
+			click.MatchedRule = rule.Pattern
+		}
+		click.MatchedCountry = matchedCountry
 	}
 
-	storeLock.Lock()
-	analytics[shortCode] = append(analytics[shortCode], click)
-	storeLock.Unlock()
+	if err := recordRedirect(shortCode, click, bot, now); err != nil {
+		if url.Audited {
+			_, code := errorStatus(err)
+			auditRedirect(r, shortCode, code, "")
+		}
+		writeServiceError(w, r, err)
+		return
+	}
+	if url.Audited {
+		auditRedirect(r, shortCode, "redirected", destination)
+	}
 
-	http.Redirect(w, r, url.OriginalURL, http.StatusFound)
+	if serverTiming {
+		w.Header().Set("Server-Timing", fmt.Sprintf("lookup;dur=%.3f, analytics;dur=%.3f",
+			durationMillis(lookupTime), durationMillis(time.Since(now))))
+	}
+	sendRedirect(w, r, destination, url)
 }
 
 func getURLStats(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	shortCode := vars["shortcode"]
 
+	page, err := parseClickPage(r)
+	if err != nil {
+		jsonError(w, fmt.Sprintf(`{"error": "%s"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	stats, err := GetStats(shortCode, page)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	newJSONEncoder(w, r).Encode(stats)
+}
+
+// buildURLStats computes the stats of url from its clicks, with click details
+// limited to page
+func buildURLStats(url ShortURL, clicks []Click, total, bots int, page clickPage) URLStats {
+	stats := URLStats{
+		OriginalURL:            url.OriginalURL,
+		CreatedAt:              url.CreatedAt,
+		ExpiresAt:              url.ExpiresAt,
+		TotalClicks:            total,
+		ClickDetails:           page.apply(clicks),
+		RemainingSeconds:       remainingSeconds(url.ExpiresAt, time.Now()),
+		ClicksByReferrerDomain: clicksByReferrerDomain(clicks),
+		ClicksByLanguage:       clicksByLanguage(clicks),
+		ClicksByOS:             clicksByOS(clicks),
+		FaviconURL:             url.FaviconURL,
+		Metadata:               url.Metadata,
+		Locations:              clickClusters(clicks),
+		UTM:                    newUTMBreakdown(),
+	}
+	stats.UTM.add(url, clicks, total)
+	var highRisk int
+	stats.ClicksByFraudBucket, highRisk = clicksByFraudBucket(clicks)
+	// Bots come from their own counter, since sampling and retention leave
+	// the click details short
+	riskyHumans := riskyHumanClicks(clicks)
+	stats.BotClicks = min(bots, total)
+	stats.HumanClicks = total - stats.BotClicks
+	if !countBotClicks {
+		stats.TotalClicks = stats.HumanClicks
+		highRisk = riskyHumans
+	}
+	stats.ValidClicks = stats.TotalClicks
+	if excludeFraudClicks {
+		stats.ValidClicks = max(stats.TotalClicks-highRisk, 0)
+	}
+	// Imported clicks may predate the first redirect through this server
+	first := url.FirstClickAt
+	if len(clicks) > 0 && (first.IsZero() || clicks[0].Timestamp.Before(first)) {
+		first = clicks[0].Timestamp
+	}
+	if !first.IsZero() {
+		seconds := max(first.Sub(url.CreatedAt).Seconds(), 0)
+		stats.TimeToFirstClick = &seconds
+	}
+	if len(url.Destinations) > 0 {
+		stats.ClicksByDestination = make(map[string]int, len(url.Destinations))
+		totalWeight := 0
+		for _, dest := range url.Destinations {
+			stats.ClicksByDestination[dest.URL] = 0
+			totalWeight += dest.Weight
+		}
+		for _, click := range clicks {
+			stats.ClicksByDestination[click.Destination]++
+		}
+		for _, dest := range url.Destinations {
+			breakdown := DestinationStats{
+				URL:           dest.URL,
+				Weight:        dest.Weight,
+				ExpectedShare: float64(dest.Weight) / float64(totalWeight),
+				Clicks:        stats.ClicksByDestination[dest.URL],
+			}
+			if len(clicks) > 0 {
+				breakdown.Share = float64(breakdown.Clicks) / float64(len(clicks))
+			}
+			stats.DestinationBreakdown = append(stats.DestinationBreakdown, breakdown)
+		}
+	}
+	return stats
+}
+
+// pickDestination chooses one of dests at random in proportion to its weight
+func pickDestination(dests []Destination) string {
+	total := 0
+	for _, dest := range dests {
+		total += dest.Weight
+	}
+	n := rand.Intn(total)
+	for _, dest := range dests {
+		if n < dest.Weight {
+			return dest.URL
+		}
+		n -= dest.Weight
+	}
+	return dests[len(dests)-1].URL
+}
+
+// sampleClick decides whether a click on url is stored with its details
+func sampleClick(url ShortURL) bool {
+	rate := url.ClickSampleRate
+	if rate == 0 {
+		rate = clickSampleRate
+	}
+	return rate >= 1 || rand.Float64() < rate
+}
+
+// storeFull reports whether the MAX_URLS limit has been reached. Expired
+// entries do not count towards the limit: once it is reached they are dropped,
+// so they cannot keep holding memory. The caller must hold storeLock.
+func storeFull(now time.Time) bool {
+	if maxURLs <= 0 || len(urlStore) < maxURLs {
+		return false
+	}
+	dropExpiredLinks(now)
+	return len(urlStore) >= maxURLs
+}
+
+// getURLInfo returns the stored record for a shortcode without any analytics
+func getURLInfo(w http.ResponseWriter, r *http.Request) {
+	shortCode := mux.Vars(r)["shortcode"]
+
 	storeLock.RLock()
 	url, exists := urlStore[shortCode]
-	clicks := analytics[shortCode]
 	storeLock.RUnlock()
 
 	if !exists {
-		http.Error(w, `{"error": "Short URL not found"}`, http.StatusNotFound)
+		jsonError(w, `{"error": "Short URL not found"}`, http.StatusNotFound)
 		return
 	}
 
-	stats := URLStats{
-		OriginalURL:  url.OriginalURL,
-		CreatedAt:    url.CreatedAt,
-		ExpiresAt:    url.ExpiresAt,
-		TotalClicks:  len(clicks),
-		ClickDetails: clicks,
+	w.Header().Set("Content-Type", "application/json")
+	newJSONEncoder(w, r).Encode(url)
+}
+
+type ByURLResponse struct {
+	URL        string   `json:"url"`
+	ShortCodes []string `json:"shortCodes"`
+}
+
+// findByURL lists every shortcode whose destination matches ?url= after
+// normalization
+func findByURL(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.Query().Get("url")
+	if target == "" {
+		jsonError(w, `{"error": "url is required"}`, http.StatusBadRequest)
+		return
+	}
+	normalized := normalizeURL(target)
+
+	response := ByURLResponse{URL: target, ShortCodes: []string{}}
+	storeLock.RLock()
+	for code, url := range urlStore {
+		if normalizeURL(url.OriginalURL) == normalized {
+			response.ShortCodes = append(response.ShortCodes, code)
+		}
 	}
+	storeLock.RUnlock()
+	sort.Strings(response.ShortCodes)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(stats)
+	newJSONEncoder(w, r).Encode(response)
 }
 
-func main() {
-	r := mux.NewRouter()
+// setURLActive returns a handler that activates or deactivates a short URL
+func setURLActive(active bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		shortCode := mux.Vars(r)["shortcode"]
+
+		storeLock.Lock()
+		url, exists := urlStore[shortCode]
+		if exists {
+			url.IsActive = active
+			if active {
+				url.ClicksSinceActivation = 0
+			}
+			urlStore[shortCode] = url
+		}
+		storeLock.Unlock()
+		redirectCache.Remove(shortCode)
+
+		if !exists {
+			jsonError(w, `{"error": "Short URL not found"}`, http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		newJSONEncoder(w, r).Encode(url)
+	}
+}
+
+// sendRedirect sends the client on to destination the way url asks: an HTTP
+// redirect with its status (302 when zero) or, in "html" mode, a page that
+// redirects via meta refresh and JavaScript. Destinations outside
+// REDIRECT_ALLOWLIST get the preview page instead.
+func sendRedirect(w http.ResponseWriter, r *http.Request, destination string, url ShortURL) {
+	if !redirectAllowed(destination) {
+		renderPreview(w, destination)
+		return
+	}
+	mode := url.RedirectMode
+	if mode == "" {
+		mode = redirectMode
+	}
+	if mode == "html" {
+		renderHTMLRedirect(w, destination)
+		return
+	}
+	status := url.RedirectStatus
+	if status == 0 {
+		status = http.StatusFound
+	}
+	http.Redirect(w, r, destination, status)
+}
+
+// validRedirectStatus reports whether status is a supported redirect code
+func validRedirectStatus(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// jsonError is http.Error for the JSON error bodies used throughout the API,
+// replying with body and status under an application/json content type.
+// Requests that opted into problem+json get the body as problem details.
+func jsonError(w http.ResponseWriter, body string, status int) {
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Type", "application/json")
+	h.Set("X-Content-Type-Options", "nosniff")
+	if wantsProblemJSON(w) {
+		h.Set("Content-Type", "application/problem+json")
+		body = string(problemBody(body, status))
+	}
+	w.WriteHeader(status)
+	fmt.Fprintln(w, body)
+}
+
+// newJSONEncoder returns an encoder for a JSON response body, indented when
+// PRETTY_JSON is set or the request asks for ?pretty=true
+func newJSONEncoder(w http.ResponseWriter, r *http.Request) *json.Encoder {
+	enc := json.NewEncoder(w)
+	if prettyJSON || r.URL.Query().Get("pretty") == "true" {
+		enc.SetIndent("", "  ")
+	}
+	return enc
+}
+
+// writeCreated writes a 201 creation response, as a bare link for clients
+// that prefer text/plain and as JSON otherwise. JSON responses embed a QR code
+// of the link when ?qr=true is given.
+func writeCreated(w http.ResponseWriter, r *http.Request, response ShortURLResponse) {
+	writeShortLink(w, r, response, http.StatusCreated)
+}
+
+// writeShortLink sends response with status, as plain text or JSON
+// depending on the Accept header
+func writeShortLink(w http.ResponseWriter, r *http.Request, response ShortURLResponse, status int) {
+	if prefersPlainText(r) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(status)
+		fmt.Fprintln(w, response.ShortLink)
+		return
+	}
+
+	if r.URL.Query().Get("qr") == "true" {
+		qr, err := qrCodeBase64(response.ShortLink)
+		if err != nil {
+			log.Printf("Generating QR code: %v", err)
+		}
+		response.QRCode = qr
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	newJSONEncoder(w, r).Encode(response)
+}
+
+// prefersPlainText reports whether the Accept header lists text/plain ahead of
+// any JSON media type
+func prefersPlainText(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, _ := strings.Cut(strings.TrimSpace(part), ";")
+		switch strings.TrimSpace(mediaType) {
+		case "text/plain":
+			return true
+		case "application/json", "*/*":
+			return false
+		}
+	}
+	return false
+}
+
+// baseURL returns the scheme and host that generated short links are served from
+func baseURL(r *http.Request) string {
+	if configuredBaseURL != "" {
+		return configuredBaseURL + routePrefix
+	}
+	host := r.Host
+	if host == "" {
+		host = "localhost:8080"
+	}
+	if isSecure(r) {
+		return "https://" + host + routePrefix
+	}
+	return "http://" + host + routePrefix
+}
+
+// durationMillis converts d to fractional milliseconds
+func durationMillis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// remainingSeconds returns the whole seconds left until expiresAt, clamped at 0.
+// A zero expiresAt means the link never expires and yields -1.
+func remainingSeconds(expiresAt, now time.Time) int64 {
+	if expiresAt.IsZero() {
+		return -1
+	}
+	remaining := expiresAt.Sub(now)
+	if remaining < 0 {
+		return 0
+	}
+	return int64(remaining / time.Second)
+}
+
+// newRouter registers every route on a fresh router
+func newRouter() *mux.Router {
+	root := mux.NewRouter()
+
+	// Health routes and robots.txt stay at the root whatever ROUTE_PREFIX
+	// is, and are registered ahead of the shortcode catch-all
+	root.HandleFunc("/healthz", healthz).Methods("GET")
+	root.HandleFunc("/readyz", readyz).Methods("GET")
+	root.HandleFunc("/metrics", metrics).Methods("GET")
+	root.HandleFunc("/robots.txt", serveRobotsTxt).Methods("GET")
+
+	r := root
+	if routePrefix != "" {
+		r = root.PathPrefix(routePrefix).Subrouter()
+	}
 
 	// API routes
-	r.HandleFunc("/shorturls", createShortURL).Methods("POST")
+	r.HandleFunc("/shorturls", rateLimit(creationLimiter, createShortURL)).Methods("POST")
+	r.HandleFunc("/shorturls", listShortURLs).Methods("GET")
+	if allowGetCreate {
+		r.HandleFunc("/shorturls/create", rateLimit(creationLimiter, createShortURLFromQuery)).Methods("GET")
+	}
+	r.HandleFunc("/shorturls/by-url", findByURL).Methods("GET")
+	r.HandleFunc("/shorturls/search", searchShortURLs).Methods("GET")
+	r.HandleFunc("/shorturls/recent", recentShortURLs).Methods("GET")
+	r.HandleFunc("/shorturls/expiring", expiringShortURLs).Methods("GET")
+	r.HandleFunc("/shorturls/upsert", rateLimit(creationLimiter, upsertShortURL)).Methods("POST")
 	r.HandleFunc("/{shortcode}", redirectShortURL).Methods("GET")
+	r.HandleFunc("/s/{token}", redirectSignedLink).Methods("GET")
 	r.HandleFunc("/shorturls/{shortcode}", getURLStats).Methods("GET")
+	r.HandleFunc("/shorturls/{shortcode}/info", getURLInfo).Methods("GET")
+	r.HandleFunc("/shorturls/{shortcode}/available", checkAvailability).Methods("GET")
+	r.HandleFunc("/shorturls/{shortcode}/heatmap", getClickHeatmap).Methods("GET")
+	r.HandleFunc("/shorturls/{shortcode}/clicks.jsonl", exportClicksJSONL).Methods("GET")
+	r.HandleFunc("/shorturls/{shortcode}/count", getClickCount).Methods("GET")
+	r.HandleFunc("/shorturls/{shortcode}/qr", getQRCode).Methods("GET")
+	r.HandleFunc("/shorturls/{shortcode}/rollups", getRollups).Methods("GET")
+	r.HandleFunc("/shorturls/{shortcode}/rotate", rotateShortCode).Methods("POST")
+	r.HandleFunc("/shorturls/{shortcode}/extend", extendExpiry).Methods("POST")
+	r.HandleFunc("/shorturls/{shortcode}/activate", setURLActive(true)).Methods("POST")
+	r.HandleFunc("/shorturls/{shortcode}/deactivate", setURLActive(false)).Methods("POST")
+	r.HandleFunc("/stats/tag/{tag}", getTagStats).Methods("GET")
+	r.HandleFunc("/stats/batch", getBatchStats).Methods("POST")
+	r.HandleFunc("/stats/summary", getSummaryStats).Methods("GET")
+
+	// Admin routes, disabled unless ADMIN_ENABLED is set
+	r.HandleFunc("/admin/flush", adminOnly(flushStore)).Methods("POST")
+	r.HandleFunc("/admin/maintenance", adminOnly(setMaintenance)).Methods("POST")
+	r.HandleFunc("/admin/analytics", adminOnly(setAnalyticsPaused)).Methods("POST")
+	r.HandleFunc("/admin/export", adminOnly(exportStore)).Methods("GET")
+	r.HandleFunc("/admin/import", adminOnly(importStore)).Methods("POST")
+	r.HandleFunc("/admin/dump", adminOnly(dumpStore)).Methods("GET")
+	r.HandleFunc("/shorturls/{shortcode}/clicks/import", adminOnly(importClicks)).Methods("POST")
+	r.HandleFunc("/shorturls/{shortcode}/legal-block", adminOnly(setLegalBlock)).Methods("POST")
+	return root
+}
 
-	// Wrap with logging middleware
-	loggedRouter := &CustomLogger{handler: r}
+// newHandler wraps root in the configured middleware, logging outermost
+func newHandler(root http.Handler) http.Handler {
+	handler := root
+	if stripTrailingSlash {
+		handler = withStripTrailingSlash(handler)
+	}
+	handler = withMaintenance(handler)
+	if forceHTTPS {
+		handler = withForceHTTPS(handler)
+	}
+	if canonicalHost != "" {
+		handler = withCanonicalHost(handler)
+	}
+	handler = withProblemJSON(handler)
+	handler = withServedBy(handler)
+	return &CustomLogger{
+		handler:   handler,
+		logBodies: logBodies,
+		bodyLimit: logBodyLimit,
+		minLevel:  logMinLevel,
+		routes:    logRoutes,
+	}
+}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+// newServer returns the HTTP server for handler with the configured port and
+// timeouts
+func newServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:         ":" + port,
+		Handler:      handler,
+		ReadTimeout:  readTimeout,
+		WriteTimeout: writeTimeout,
+		IdleTimeout:  idleTimeout,
 	}
+}
+
+func main() {
+	loadConfig()
 
-	log.Printf("Server starting on port %s", port)
-	log.Fatal(http.ListenAndServe(":"+port, loggedRouter))
+	// Background maintenance
+	stop := make(chan struct{})
+	if compactionInterval > 0 {
+		go runCompaction(stop)
+	}
+	if creationLimiter != nil {
+		go creationLimiter.runSweeper(stop)
+	}
+	if clickRetention > 0 {
+		go runRetention(stop)
+	}
+	go redirectLimits.runSweeper(stop)
+	if inactivityReapInterval > 0 {
+		go runInactivityReaper(stop)
+	}
+	if rollupInterval > 0 {
+		go runRollups(stop)
+	}
+	startAuditSink()
+	startCodePool(stop)
+	if clickBatchSize > 0 {
+		clickBatch = newClickBatcher(clickBatchSize)
+		go clickBatch.run(clickBatchInterval, stop)
+	}
+
+	srv := newServer(newHandler(newRouter()))
+	go func() {
+		var err error
+		if tlsCertFile != "" {
+			log.Printf("Server starting on port %s with TLS", port)
+			err = srv.ListenAndServeTLS(tlsCertFile, tlsKeyFile)
+		} else {
+			log.Printf("Server starting on port %s", port)
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := reloadConfig(); err != nil {
+				log.Printf("Reload failed, keeping current settings: %v", err)
+				continue
+			}
+			log.Printf("Reloaded settings")
+		}
+	}()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	<-sig
+
+	drainAndShutdown(srv, drainDelay)
+	close(stop)
+	if flushed := clickBatch.flush(); flushed > 0 {
+		log.Printf("Flushed %d buffered clicks", flushed)
+	}
+	stopAuditSink()
+	log.Printf("Server stopped")
 }
@@ -0,0 +1,662 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRemainingSeconds(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		expiresAt time.Time
+		want      int64
+	}{
+		{now.Add(90 * time.Second), 90},
+		{now.Add(1500 * time.Millisecond), 1},
+		{now.Add(-time.Minute), 0},
+		{time.Time{}, -1},
+	}
+	for _, tt := range tests {
+		if got := remainingSeconds(tt.expiresAt, now); got != tt.want {
+			t.Errorf("remainingSeconds(%v) = %d, want %d", tt.expiresAt, got, tt.want)
+		}
+	}
+}
+
+func TestStatsRemainingSeconds(t *testing.T) {
+	resetStore(t)
+	url := mustCreate(t, ShortURLRequest{URL: "https://example.com", Validity: 10})
+
+	rec := do("GET", "/shorturls/"+url.ShortCode, "")
+	wantStatus(t, rec, http.StatusOK)
+	var stats URLStats
+	decode(t, rec, &stats)
+	if stats.RemainingSeconds < 595 || stats.RemainingSeconds > 600 {
+		t.Errorf("remainingSeconds = %d, want about 600", stats.RemainingSeconds)
+	}
+}
+
+func TestLinkGroupRedirects(t *testing.T) {
+	resetStore(t)
+	urls := []string{"https://a.example.com", "https://b.example.com"}
+	rec := do("POST", "/shorturls", `{"urls": ["https://a.example.com", "https://b.example.com"], "shortcode": "grp"}`)
+	wantStatus(t, rec, http.StatusCreated)
+
+	seen := make(map[string]int)
+	for i := 0; i < 40; i++ {
+		rec := do("GET", "/grp", "")
+		wantStatus(t, rec, http.StatusFound)
+		seen[rec.Header().Get("Location")]++
+	}
+	for _, url := range urls {
+		if seen[url] == 0 {
+			t.Errorf("no redirect to %s in 40 tries: %v", url, seen)
+		}
+	}
+	if len(seen) != len(urls) {
+		t.Errorf("redirected to %v, want only %v", seen, urls)
+	}
+
+	stats := getStats(t, "grp")
+	if got := stats.ClicksByDestination[urls[0]] + stats.ClicksByDestination[urls[1]]; got != 40 {
+		t.Errorf("clicksByDestination = %v, want 40 in total", stats.ClicksByDestination)
+	}
+}
+
+func TestAnalyticsOptOut(t *testing.T) {
+	resetStore(t)
+	wantStatus(t, do("POST", "/shorturls", `{"url": "https://example.com", "shortcode": "priv", "trackAnalytics": false}`), http.StatusCreated)
+	wantStatus(t, do("POST", "/shorturls", `{"url": "https://example.com", "shortcode": "pub"}`), http.StatusCreated)
+	for _, code := range []string{"priv", "pub"} {
+		wantStatus(t, do("GET", "/"+code, ""), http.StatusFound)
+	}
+
+	for code, details := range map[string]int{"priv": 0, "pub": 1} {
+		stats := getStats(t, code)
+		if stats.TotalClicks != 1 || len(stats.ClickDetails) != details {
+			t.Errorf("%s: %d clicks with %d details, want 1 with %d", code, stats.TotalClicks, len(stats.ClickDetails), details)
+		}
+	}
+}
+
+func TestPrefersPlainText(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{"", false},
+		{"text/plain", true},
+		{"text/plain;q=0.9, application/json", true},
+		{"application/json, text/plain", false},
+		{"*/*", false},
+		{"text/html, text/plain", true},
+	}
+	for _, tt := range tests {
+		r := request("POST", "/shorturls", "")
+		r.Header.Set("Accept", tt.accept)
+		if got := prefersPlainText(r); got != tt.want {
+			t.Errorf("prefersPlainText(%q) = %v, want %v", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestCreatePlainText(t *testing.T) {
+	resetStore(t)
+	r := request("POST", "/shorturls", `{"url": "https://example.com", "shortcode": "txt"}`)
+	r.Header.Set("Accept", "text/plain")
+	rec := serve(r)
+	wantStatus(t, rec, http.StatusCreated)
+	if got := rec.Header().Get("Content-Type"); got != "text/plain; charset=utf-8" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if got := rec.Body.String(); got != "http://"+testHost+"/txt\n" {
+		t.Errorf("body = %q", got)
+	}
+}
+
+func TestMaxURLs(t *testing.T) {
+	resetStore(t)
+	set(t, &maxURLs, 2)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com/1"})
+	mustCreate(t, ShortURLRequest{URL: "https://example.com/2", Shortcode: "two"})
+
+	wantStatus(t, do("POST", "/shorturls", `{"url": "https://example.com/3"}`), http.StatusInsufficientStorage)
+
+	// Expired links no longer count towards the limit, and are dropped to
+	// make room rather than left holding memory
+	storeLock.Lock()
+	url := urlStore["two"]
+	url.ExpiresAt = time.Now().Add(-time.Second)
+	urlStore["two"] = url
+	storeLock.Unlock()
+	wantStatus(t, do("POST", "/shorturls", `{"url": "https://example.com/3"}`), http.StatusCreated)
+
+	storeLock.RLock()
+	_, kept := urlStore["two"]
+	_, keptClicks := analytics["two"]
+	stored := len(urlStore)
+	storeLock.RUnlock()
+	if kept || keptClicks || stored != 2 {
+		t.Errorf("expired link kept = %v, its clicks kept = %v, %d links stored, want 2", kept, keptClicks, stored)
+	}
+}
+
+func TestRedirectStatus(t *testing.T) {
+	resetStore(t)
+	for _, status := range []int{0, 301, 302, 307, 308} {
+		code := fmt.Sprintf("s%d", status)
+		body := fmt.Sprintf(`{"url": "https://example.com", "shortcode": %q, "redirectStatus": %d}`, code, status)
+		wantStatus(t, do("POST", "/shorturls", body), http.StatusCreated)
+
+		want := status
+		if want == 0 {
+			want = http.StatusFound
+		}
+		rec := do("GET", "/"+code, "")
+		wantStatus(t, rec, want)
+		if got := rec.Header().Get("Location"); got != "https://example.com" {
+			t.Errorf("%d: Location = %q", status, got)
+		}
+	}
+	wantStatus(t, do("POST", "/shorturls", `{"url": "https://example.com", "redirectStatus": 303}`), http.StatusBadRequest)
+}
+
+func TestValidityUnits(t *testing.T) {
+	resetStore(t)
+	tests := []struct {
+		validity int
+		unit     string
+		want     time.Duration
+	}{
+		{45, "seconds", 45 * time.Second},
+		{5, "", 5 * time.Minute},
+		{5, "minutes", 5 * time.Minute},
+		{2, "hours", 2 * time.Hour},
+		{3, "days", 72 * time.Hour},
+		{0, "days", 30 * time.Minute},
+	}
+	for _, tt := range tests {
+		url := mustCreate(t, ShortURLRequest{URL: "https://example.com", Validity: tt.validity, ValidityUnit: tt.unit})
+		if got := url.ExpiresAt.Sub(url.CreatedAt).Round(time.Second); got != tt.want {
+			t.Errorf("%d %q: validity %v, want %v", tt.validity, tt.unit, got, tt.want)
+		}
+	}
+
+	wantStatus(t, do("POST", "/shorturls", `{"url": "https://example.com", "validity": 1, "validityUnit": "weeks"}`), http.StatusBadRequest)
+	// Validities that would overflow a Duration, or run backwards, are refused
+	for _, body := range []string{
+		`{"url": "https://example.com", "validity": -5}`,
+		`{"url": "https://example.com", "validity": 9223372036854775807, "validityUnit": "days"}`,
+		`{"url": "https://example.com", "validity": 106752, "validityUnit": "days"}`,
+	} {
+		wantStatus(t, do("POST", "/shorturls", body), http.StatusBadRequest)
+	}
+}
+
+// writeSelfSignedCert writes a certificate for 127.0.0.1 and its key to dir
+func writeSelfSignedCert(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+	return certFile, keyFile
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServeTLS(t *testing.T) {
+	resetStore(t)
+	certFile, keyFile := writeSelfSignedCert(t, t.TempDir())
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "tls"})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newServer(newHandler(newRouter()))
+	go srv.ServeTLS(ln, certFile, keyFile)
+	defer srv.Close()
+
+	pool := x509.NewCertPool()
+	certPEM, _ := os.ReadFile(certFile)
+	pool.AppendCertsFromPEM(certPEM)
+	client := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	base := "https://" + ln.Addr().String()
+
+	resp, err := client.Get(base + "/tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound || resp.TLS == nil {
+		t.Errorf("status %d over TLS %v, want a 302 over TLS", resp.StatusCode, resp.TLS != nil)
+	}
+
+	// Links created over TLS are https links
+	resp, err = client.Post(base+"/shorturls", "application/json", strings.NewReader(`{"url": "https://example.com"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated || !strings.Contains(string(body), `"shortLink":"`+base+"/") {
+		t.Errorf("create over TLS: %d %s", resp.StatusCode, body)
+	}
+
+	// Plain HTTP to the TLS port is refused
+	plain, err := http.Get("http://" + ln.Addr().String() + "/tls")
+	if err == nil {
+		plain.Body.Close()
+		if plain.StatusCode != http.StatusBadRequest {
+			t.Errorf("plain HTTP got %d", plain.StatusCode)
+		}
+	}
+}
+
+func TestGetURLInfo(t *testing.T) {
+	resetStore(t)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "rec", Tags: []string{"x"}, Metadata: map[string]string{"owner": "ops"}})
+	wantStatus(t, do("GET", "/rec", ""), http.StatusFound)
+
+	rec := do("GET", "/shorturls/rec/info", "")
+	wantStatus(t, rec, http.StatusOK)
+	var url ShortURL
+	decode(t, rec, &url)
+	if url.ShortCode != "rec" || url.OriginalURL != "https://example.com" || url.Metadata["owner"] != "ops" || len(url.Tags) != 1 {
+		t.Errorf("info = %+v", url)
+	}
+	// The record carries no analytics
+	if strings.Contains(rec.Body.String(), "clickDetails") {
+		t.Errorf("info includes click details: %s", rec.Body.String())
+	}
+	wantStatus(t, do("GET", "/shorturls/missing/info", ""), http.StatusNotFound)
+}
+
+func TestRedirectErrorCodes(t *testing.T) {
+	resetStore(t)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "off"})
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "old", Validity: 1, ValidityUnit: "seconds"})
+	wantStatus(t, do("POST", "/shorturls/off/deactivate", ""), http.StatusOK)
+	storeLock.Lock()
+	old := urlStore["old"]
+	old.ExpiresAt = time.Now().Add(-time.Second)
+	urlStore["old"] = old
+	storeLock.Unlock()
+
+	tests := []struct {
+		code   string
+		status int
+		want   string
+	}{
+		{"missing", http.StatusNotFound, "not_found"},
+		{"off", http.StatusForbidden, "deactivated"},
+		{"old", http.StatusGone, "expired"},
+	}
+	for _, tt := range tests {
+		rec := do("GET", "/"+tt.code, "")
+		wantStatus(t, rec, tt.status)
+		var body struct {
+			Code string `json:"code"`
+		}
+		decode(t, rec, &body)
+		if body.Code != tt.want {
+			t.Errorf("%s: code = %q, want %q", tt.code, body.Code, tt.want)
+		}
+	}
+
+	// Reactivating restores the redirect
+	wantStatus(t, do("POST", "/shorturls/off/activate", ""), http.StatusOK)
+	wantStatus(t, do("GET", "/off", ""), http.StatusFound)
+	wantStatus(t, do("POST", "/shorturls/missing/activate", ""), http.StatusNotFound)
+}
+
+func TestCreateViaGet(t *testing.T) {
+	resetStore(t)
+	set(t, &allowGetCreate, false)
+	// Without the setting the path is taken for a shortcode lookup
+	wantStatus(t, do("GET", "/shorturls/create?url=https://example.com", ""), http.StatusNotFound)
+
+	set(t, &allowGetCreate, true)
+	rec := do("GET", "/shorturls/create?url=https%3A%2F%2Fexample.com%2Fq&shortcode=viaget&validity=2&validityUnit=hours", "")
+	wantStatus(t, rec, http.StatusCreated)
+	rec = do("GET", "/shorturls/viaget/info", "")
+	wantStatus(t, rec, http.StatusOK)
+	var url ShortURL
+	decode(t, rec, &url)
+	if url.OriginalURL != "https://example.com/q" || url.ExpiresAt.Sub(url.CreatedAt).Round(time.Second) != 2*time.Hour {
+		t.Errorf("created %+v", url)
+	}
+	wantStatus(t, do("GET", "/shorturls/create?url=https://example.com&validity=soon", ""), http.StatusBadRequest)
+}
+
+func TestRoutePrefix(t *testing.T) {
+	resetStore(t)
+	set(t, &routePrefix, "/go")
+
+	rec := do("POST", "/go/shorturls", `{"url": "https://example.com", "shortcode": "pre"}`)
+	wantStatus(t, rec, http.StatusCreated)
+	var response ShortURLResponse
+	decode(t, rec, &response)
+	if response.ShortLink != "http://"+testHost+"/go/pre" {
+		t.Errorf("shortLink = %q", response.ShortLink)
+	}
+
+	wantStatus(t, do("GET", "/go/pre", ""), http.StatusFound)
+	wantStatus(t, do("GET", "/pre", ""), http.StatusNotFound)
+	wantStatus(t, do("GET", "/go/shorturls/pre", ""), http.StatusOK)
+	// Health probes stay at the root
+	wantStatus(t, do("GET", "/healthz", ""), http.StatusOK)
+}
+
+func TestClickSampling(t *testing.T) {
+	resetStore(t)
+	set(t, &clickSampleRate, 0.0)
+	if sampleClick(ShortURL{ClickSampleRate: 0}) {
+		t.Error("click sampled at a global rate of 0")
+	}
+	if !sampleClick(ShortURL{ClickSampleRate: 1}) {
+		t.Error("click not sampled at a link rate of 1")
+	}
+
+	set(t, &clickSampleRate, 1.0)
+	wantStatus(t, do("POST", "/shorturls", `{"url": "https://example.com", "shortcode": "half", "clickSampleRate": 0.5}`), http.StatusCreated)
+	for i := 0; i < 200; i++ {
+		do("GET", "/half", "")
+	}
+	stats := getStats(t, "half?limit=1000")
+	if stats.TotalClicks != 200 {
+		t.Errorf("totalClicks = %d, want every click counted", stats.TotalClicks)
+	}
+	if n := len(stats.ClickDetails); n < 50 || n > 150 {
+		t.Errorf("%d of 200 clicks kept at a rate of 0.5", n)
+	}
+
+	for _, rate := range []string{"-0.1", "1.5"} {
+		wantStatus(t, do("POST", "/shorturls", `{"url": "https://example.com", "clickSampleRate": `+rate+`}`), http.StatusBadRequest)
+	}
+}
+
+func TestServerTiming(t *testing.T) {
+	resetStore(t)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "timed"})
+
+	rec := do("GET", "/timed", "")
+	if got := rec.Header().Get("Server-Timing"); got != "" {
+		t.Errorf("Server-Timing sent while disabled: %q", got)
+	}
+
+	set(t, &serverTiming, true)
+	rec = do("GET", "/timed", "")
+	wantStatus(t, rec, http.StatusFound)
+	format := regexp.MustCompile(`^lookup;dur=\d+\.\d{3}, analytics;dur=\d+\.\d{3}$`)
+	if got := rec.Header().Get("Server-Timing"); !format.MatchString(got) {
+		t.Errorf("Server-Timing = %q", got)
+	}
+}
+
+func TestFindByURL(t *testing.T) {
+	resetStore(t)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com/page", Shortcode: "one"})
+	mustCreate(t, ShortURLRequest{URL: "https://Example.com:443/page#top", Shortcode: "two"})
+	mustCreate(t, ShortURLRequest{URL: "https://example.com/other", Shortcode: "three"})
+
+	rec := do("GET", "/shorturls/by-url?url=https://example.com/page", "")
+	wantStatus(t, rec, http.StatusOK)
+	var response ByURLResponse
+	decode(t, rec, &response)
+	if strings.Join(response.ShortCodes, ",") != "one,two" {
+		t.Errorf("shortCodes = %v, want [one two]", response.ShortCodes)
+	}
+
+	rec = do("GET", "/shorturls/by-url?url=https://nowhere.example", "")
+	wantStatus(t, rec, http.StatusOK)
+	if body := strings.TrimSpace(rec.Body.String()); !strings.Contains(body, `"shortCodes":[]`) {
+		t.Errorf("no matches gives %s, want an empty array", body)
+	}
+	wantStatus(t, do("GET", "/shorturls/by-url", ""), http.StatusBadRequest)
+}
+
+func TestErrorContentType(t *testing.T) {
+	resetStore(t)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "old"})
+	storeLock.Lock()
+	old := urlStore["old"]
+	old.ExpiresAt = time.Now().Add(-time.Second)
+	urlStore["old"] = old
+	storeLock.Unlock()
+
+	for _, rec := range []*httptest.ResponseRecorder{
+		do("GET", "/missing", ""),
+		do("GET", "/old", ""),
+		do("GET", "/shorturls/missing", ""),
+		do("POST", "/shorturls", `{"url": "ftp://example.com"}`),
+		do("POST", "/shorturls/old/extend", `{"additionalMinutes": 0}`),
+	} {
+		if rec.Code < 400 {
+			t.Errorf("status %d, want an error", rec.Code)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%d response has Content-Type %q, want application/json", rec.Code, ct)
+		}
+		if !json.Valid(rec.Body.Bytes()) {
+			t.Errorf("%d response is not JSON: %s", rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestPickDestinationWeights(t *testing.T) {
+	dests := []Destination{{URL: "a", Weight: 80}, {URL: "b", Weight: 20}}
+	const n = 10000
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		counts[pickDestination(dests)]++
+	}
+	if share := float64(counts["a"]) / n; share < 0.77 || share > 0.83 {
+		t.Errorf("a got %.3f of the traffic, want about 0.8 (%v)", share, counts)
+	}
+	if counts["a"]+counts["b"] != n {
+		t.Errorf("picked outside the destinations: %v", counts)
+	}
+}
+
+func TestWeightedDestinations(t *testing.T) {
+	resetStore(t)
+	wantStatus(t, do("POST", "/shorturls", `{"shortcode": "ab", "destinations": [
+		{"url": "https://a.example.com", "weight": 3}, {"url": "https://b.example.com", "weight": 1}]}`), http.StatusCreated)
+	for i := 0; i < 400; i++ {
+		wantStatus(t, do("GET", "/ab", ""), http.StatusFound)
+	}
+
+	stats := getStats(t, "ab?limit=1000")
+	if len(stats.DestinationBreakdown) != 2 {
+		t.Fatalf("breakdown = %+v", stats.DestinationBreakdown)
+	}
+	a, b := stats.DestinationBreakdown[0], stats.DestinationBreakdown[1]
+	if a.URL != "https://a.example.com" || a.Weight != 3 || a.ExpectedShare != 0.75 || b.ExpectedShare != 0.25 {
+		t.Errorf("breakdown = %+v", stats.DestinationBreakdown)
+	}
+	if a.Clicks+b.Clicks != 400 || a.Share < 0.65 || a.Share > 0.85 {
+		t.Errorf("a served %d of %d clicks (%.2f), want about 0.75", a.Clicks, a.Clicks+b.Clicks, a.Share)
+	}
+	for _, click := range stats.ClickDetails {
+		if click.Destination == "" {
+			t.Fatal("click does not record its destination")
+		}
+	}
+
+	for _, body := range []string{
+		`{"destinations": [{"url": "https://a.example.com", "weight": 0}]}`,
+		`{"urls": ["https://a.example.com"], "destinations": [{"url": "https://b.example.com", "weight": 1}]}`,
+	} {
+		wantStatus(t, do("POST", "/shorturls", body), http.StatusBadRequest)
+	}
+}
+
+func TestAutoDeactivateAfter(t *testing.T) {
+	resetStore(t)
+	redirectCache = newLRUCache(10)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "few", AutoDeactivateAfter: 3})
+
+	for round := 0; round < 2; round++ {
+		for i := 0; i < 3; i++ {
+			wantStatus(t, do("GET", "/few", ""), http.StatusFound)
+		}
+		wantStatus(t, do("GET", "/few", ""), http.StatusForbidden)
+		// Reactivating starts the count again
+		wantStatus(t, do("POST", "/shorturls/few/activate", ""), http.StatusOK)
+	}
+	if stats := getStats(t, "few"); stats.TotalClicks != 6 {
+		t.Errorf("TotalClicks = %d, want 6", stats.TotalClicks)
+	}
+	wantStatus(t, do("POST", "/shorturls", `{"url": "https://example.com", "autoDeactivateAfter": -1}`), http.StatusBadRequest)
+}
+
+func TestAutoDeactivateAfterConcurrent(t *testing.T) {
+	resetStore(t)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "race", AutoDeactivateAfter: 5})
+
+	var wg sync.WaitGroup
+	var served atomic.Int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if do("GET", "/race", "").Code == http.StatusFound {
+				served.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if served.Load() != 5 {
+		t.Errorf("%d redirects served, want exactly 5", served.Load())
+	}
+}
+
+func TestNewServerTimeouts(t *testing.T) {
+	set(t, &readTimeout, 3*time.Second)
+	set(t, &writeTimeout, 4*time.Second)
+	set(t, &idleTimeout, 5*time.Second)
+	srv := newServer(http.NotFoundHandler())
+	if srv.ReadTimeout != 3*time.Second || srv.WriteTimeout != 4*time.Second || srv.IdleTimeout != 5*time.Second {
+		t.Errorf("timeouts = %v, %v, %v", srv.ReadTimeout, srv.WriteTimeout, srv.IdleTimeout)
+	}
+}
+
+func TestSlowClientCutOff(t *testing.T) {
+	resetStore(t)
+	set(t, &readTimeout, 200*time.Millisecond)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "slow"})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newServer(newHandler(newRouter()))
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	// A slowloris client sends part of its headers and then stalls
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, "GET /slow HTTP/1.1\r\nHost: %s\r\nX-Slow: ", testHost)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	start := time.Now()
+	n, err := conn.Read(make([]byte, 1))
+	if err != io.EOF || n != 0 {
+		t.Fatalf("stalled request read %d bytes, err %v; want the connection closed", n, err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("stalled client cut off after %v, want about %v", elapsed, readTimeout)
+	}
+
+	// A prompt client on the same server is served normally
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get("http://" + ln.Addr().String() + "/slow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Errorf("prompt client got %d, want 302", resp.StatusCode)
+	}
+}
+
+func TestPrettyJSON(t *testing.T) {
+	resetStore(t)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "pp"})
+
+	compact := do("GET", "/shorturls/pp", "").Body.String()
+	if strings.Count(compact, "\n") != 1 {
+		t.Errorf("default output is not compact:\n%s", compact)
+	}
+
+	pretty := do("GET", "/shorturls/pp?pretty=true", "").Body.String()
+	if !strings.Contains(pretty, "{\n  \"originalUrl\": \"https://example.com\",\n") {
+		t.Errorf("?pretty=true output is not indented:\n%s", pretty)
+	}
+	var a, b URLStats
+	if json.Unmarshal([]byte(compact), &a) != nil || json.Unmarshal([]byte(pretty), &b) != nil || a.OriginalURL != b.OriginalURL {
+		t.Error("pretty and compact output differ")
+	}
+
+	set(t, &prettyJSON, true)
+	if body := do("GET", "/shorturls/pp/info", "").Body.String(); !strings.Contains(body, "\n  \"") {
+		t.Errorf("PRETTY_JSON output is not indented:\n%s", body)
+	}
+}
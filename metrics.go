@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// metricsTopCodes is how many of the hottest shortcodes get their own labeled
+// redirect-rate gauge. Only these are labeled to bound metric cardinality.
+var metricsTopCodes = 10
+
+// redirectsTotal counts every successful redirect
+var redirectsTotal atomic.Int64
+
+// redirectRates tracks a decaying redirect rate per shortcode
+var redirectRates = newRateTracker(time.Minute, 1000)
+
+// rateTracker keeps an exponentially decaying hit count per key. A key's
+// score divided by the decay constant approximates its recent hits per second.
+type rateTracker struct {
+	mu         sync.Mutex
+	tau        time.Duration
+	maxTracked int
+	scores     map[string]*decayingScore
+}
+
+type decayingScore struct {
+	value   float64
+	updated time.Time
+}
+
+func newRateTracker(tau time.Duration, maxTracked int) *rateTracker {
+	return &rateTracker{tau: tau, maxTracked: maxTracked, scores: make(map[string]*decayingScore)}
+}
+
+func (t *rateTracker) decayed(s *decayingScore, now time.Time) float64 {
+	return s.value * math.Exp(-float64(now.Sub(s.updated))/float64(t.tau))
+}
+
+// hit records one event for key
+func (t *rateTracker) hit(key string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, ok := t.scores[key]
+	if !ok {
+		if len(t.scores) >= t.maxTracked {
+			t.pruneLocked(now, t.maxTracked/2)
+		}
+		s = &decayingScore{updated: now}
+		t.scores[key] = s
+	}
+	s.value = t.decayed(s, now) + 1
+	s.updated = now
+}
+
+type keyRate struct {
+	key  string
+	rate float64
+}
+
+// top returns the n keys with the highest current rate in events per second,
+// pruning keys that have gone cold
+func (t *rateTracker) top(n int, now time.Time) []keyRate {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	rates := t.pruneLocked(now, t.maxTracked)
+	if len(rates) > n {
+		rates = rates[:n]
+	}
+	return rates
+}
+
+// pruneLocked drops keys whose decayed score has fallen below one hit, then
+// keeps at most keep of the hottest. It returns the survivors hottest first.
+func (t *rateTracker) pruneLocked(now time.Time, keep int) []keyRate {
+	rates := make([]keyRate, 0, len(t.scores))
+	for key, s := range t.scores {
+		score := t.decayed(s, now)
+		if score < 1 {
+			delete(t.scores, key)
+			continue
+		}
+		rates = append(rates, keyRate{key: key, rate: score / t.tau.Seconds()})
+	}
+	sort.Slice(rates, func(i, j int) bool { return rates[i].rate > rates[j].rate })
+	for _, cold := range rates[min(keep, len(rates)):] {
+		delete(t.scores, cold.key)
+	}
+	return rates[:min(keep, len(rates))]
+}
+
+// metrics serves counters and gauges in the Prometheus text format
+func metrics(w http.ResponseWriter, r *http.Request) {
+	storeLock.RLock()
+	stored := len(urlStore)
+	storeLock.RUnlock()
+
+	var b strings.Builder
+	fmt.Fprintln(&b, "# HELP shortener_urls Number of stored short URLs.")
+	fmt.Fprintln(&b, "# TYPE shortener_urls gauge")
+	fmt.Fprintf(&b, "shortener_urls %d\n", stored)
+	fmt.Fprintln(&b, "# HELP shortener_redirects_total Total successful redirects.")
+	fmt.Fprintln(&b, "# TYPE shortener_redirects_total counter")
+	fmt.Fprintf(&b, "shortener_redirects_total %d\n", redirectsTotal.Load())
+	fmt.Fprintln(&b, "# HELP shortener_redirects_throttled_total Redirects refused by the per-link rate limit.")
+	fmt.Fprintln(&b, "# TYPE shortener_redirects_throttled_total counter")
+	fmt.Fprintf(&b, "shortener_redirects_throttled_total %d\n", redirectsThrottled.Load())
+	fmt.Fprintln(&b, "# HELP shortener_audits_dropped_total Audit entries dropped because the queue was full or closed.")
+	fmt.Fprintln(&b, "# TYPE shortener_audits_dropped_total counter")
+	fmt.Fprintf(&b, "shortener_audits_dropped_total %d\n", auditsDropped.Load())
+	fmt.Fprintln(&b, "# HELP shortener_redirect_rate Recent redirects per second for the hottest shortcodes.")
+	fmt.Fprintln(&b, "# TYPE shortener_redirect_rate gauge")
+	for _, kr := range redirectRates.top(metricsTopCodes, time.Now()) {
+		fmt.Fprintf(&b, "shortener_redirect_rate{shortcode=%q} %g\n", kr.key, kr.rate)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write([]byte(b.String()))
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateTrackerTop(t *testing.T) {
+	tracker := newRateTracker(time.Minute, 100)
+	now := time.Now()
+	for i := 0; i < 30; i++ {
+		tracker.hit("hot", now)
+	}
+	for i := 0; i < 3; i++ {
+		tracker.hit("warm", now)
+	}
+	tracker.hit("once", now)
+
+	top := tracker.top(2, now)
+	if len(top) != 2 || top[0].key != "hot" || top[1].key != "warm" {
+		t.Fatalf("top = %v, want hot then warm", top)
+	}
+	if want := 30 / 60.0; math.Abs(top[0].rate-want) > 1e-9 {
+		t.Errorf("hot rate = %g, want %g", top[0].rate, want)
+	}
+
+	// An hour later every score has decayed below one hit and is pruned
+	if top := tracker.top(10, now.Add(time.Hour)); len(top) != 0 {
+		t.Errorf("top after decay = %v", top)
+	}
+	if len(tracker.scores) != 0 {
+		t.Errorf("%d cold keys kept", len(tracker.scores))
+	}
+}
+
+func TestRateTrackerBoundsKeys(t *testing.T) {
+	tracker := newRateTracker(time.Minute, 10)
+	now := time.Now()
+	for i := 0; i < 100; i++ {
+		tracker.hit(string(rune('A'+i)), now)
+		tracker.hit(string(rune('A'+i)), now)
+	}
+	if n := len(tracker.scores); n > 10 {
+		t.Errorf("tracking %d keys, want at most 10", n)
+	}
+}
+
+func TestMetricsRedirectRates(t *testing.T) {
+	resetStore(t)
+	set(t, &metricsTopCodes, 1)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "hot"})
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "cold"})
+	for i := 0; i < 5; i++ {
+		do("GET", "/hot", "")
+	}
+	do("GET", "/cold", "")
+	do("GET", "/cold", "")
+
+	rec := do("GET", "/metrics", "")
+	wantStatus(t, rec, http.StatusOK)
+	body := rec.Body.String()
+	if !strings.Contains(body, "shortener_urls 2\n") {
+		t.Errorf("metrics missing the URL gauge:\n%s", body)
+	}
+	if !strings.Contains(body, `shortener_redirect_rate{shortcode="hot"}`) {
+		t.Errorf("metrics missing the hot code:\n%s", body)
+	}
+	if strings.Contains(body, `shortcode="cold"`) {
+		t.Errorf("metrics label more than METRICS_TOP_CODES codes:\n%s", body)
+	}
+}
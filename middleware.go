@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// instanceID identifies this server in the X-Served-By response header
+var instanceID string
+
+// defaultInstanceID falls back to the hostname when INSTANCE_ID is unset
+func defaultInstanceID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	return host
+}
+
+// withServedBy tags every response with the instance that served it
+func withServedBy(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Served-By", instanceID)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// maintenanceMode makes every route other than health and admin return 503.
+// It starts from MAINTENANCE and can be toggled at runtime by an admin.
+var maintenanceMode atomic.Bool
+
+// withMaintenance short-circuits requests while maintenance mode is on. Health
+// probes keep working, and admin routes stay reachable so it can be turned off.
+func withMaintenance(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if maintenanceMode.Load() && !maintenanceExempt(r.URL.Path) {
+			w.Header().Set("Retry-After", "60")
+			jsonError(w, `{"error": "Service is under maintenance"}`, http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func maintenanceExempt(path string) bool {
+	return path == "/healthz" || path == "/readyz" || path == "/metrics" ||
+		strings.HasPrefix(path, routePrefix+"/admin/")
+}
+
+// HTTPS enforcement settings, populated from the environment in main
+var (
+	forceHTTPS bool
+	hstsMaxAge = 365 * 24 * 60 * 60
+)
+
+// isSecure reports whether r reached us over HTTPS, either directly or via a
+// proxy that terminated TLS and set X-Forwarded-Proto
+func isSecure(r *http.Request) bool {
+	return r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+// withForceHTTPS upgrades plain HTTP requests to HTTPS with a 301 and sets
+// Strict-Transport-Security on secure responses. Health probes are left alone
+// since load balancers usually check them over plain HTTP.
+func withForceHTTPS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isSecure(r) {
+			w.Header().Set("Strict-Transport-Security", fmt.Sprintf("max-age=%d", hstsMaxAge))
+		} else if r.URL.Path != "/healthz" && r.URL.Path != "/readyz" {
+			target := "https://" + r.Host + r.URL.RequestURI()
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// canonicalHost is the host (and port, if any) links should be served from.
+// When set, requests for any other host are redirected to it.
+var canonicalHost string
+
+// withCanonicalHost 301s requests that arrive on another host, such as an old
+// domain, to the same path and query on canonicalHost. It runs ahead of
+// withForceHTTPS so an old plain-HTTP link takes a single hop. Health probes
+// are left alone.
+func withCanonicalHost(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.EqualFold(r.Host, canonicalHost) && r.URL.Path != "/healthz" && r.URL.Path != "/readyz" {
+			scheme := "http"
+			if forceHTTPS || isSecure(r) {
+				scheme = "https"
+			}
+			http.Redirect(w, r, scheme+"://"+canonicalHost+r.URL.RequestURI(), http.StatusMovedPermanently)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// stripTrailingSlash makes /abc/ route like /abc when STRIP_TRAILING_SLASH is set
+var stripTrailingSlash bool
+
+// withStripTrailingSlash removes a single trailing slash from the path before
+// routing, so pasted links such as /abc/ still resolve
+func withStripTrailingSlash(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.URL.Path) > 1 && strings.HasSuffix(r.URL.Path, "/") {
+			u := *r.URL
+			u.Path = strings.TrimSuffix(u.Path, "/")
+			u.RawPath = strings.TrimSuffix(u.RawPath, "/")
+			r2 := *r
+			r2.URL = &u
+			r = &r2
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestServedByHeader(t *testing.T) {
+	resetStore(t)
+	set(t, &instanceID, "node-7")
+	// Error responses carry the header too
+	for target, status := range map[string]int{"/healthz": http.StatusOK, "/missing": http.StatusNotFound} {
+		rec := do("GET", target, "")
+		wantStatus(t, rec, status)
+		if got := rec.Header().Get("X-Served-By"); got != "node-7" {
+			t.Errorf("%s: X-Served-By = %q", target, got)
+		}
+	}
+}
+
+func TestMaintenanceMode(t *testing.T) {
+	resetStore(t)
+	set(t, &adminEnabled, true)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "m"})
+
+	wantStatus(t, do("POST", "/admin/maintenance", `{"enabled": true}`), http.StatusOK)
+	rec := do("GET", "/m", "")
+	wantStatus(t, rec, http.StatusServiceUnavailable)
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("no Retry-After during maintenance")
+	}
+	wantStatus(t, do("POST", "/shorturls", `{"url": "https://example.com"}`), http.StatusServiceUnavailable)
+	// Probes and the admin API keep working
+	wantStatus(t, do("GET", "/healthz", ""), http.StatusOK)
+	wantStatus(t, do("GET", "/admin/dump", ""), http.StatusOK)
+	wantStatus(t, do("POST", "/admin/maintenance", `{"enabled": false}`), http.StatusOK)
+	wantStatus(t, do("GET", "/m", ""), http.StatusFound)
+}
+
+func TestMaintenanceUnderRoutePrefix(t *testing.T) {
+	resetStore(t)
+	set(t, &adminEnabled, true)
+	set(t, &routePrefix, "/go")
+	maintenanceMode.Store(true)
+
+	wantStatus(t, do("GET", "/go/stats/summary", ""), http.StatusServiceUnavailable)
+	wantStatus(t, do("POST", "/go/admin/maintenance", `{"enabled": false}`), http.StatusOK)
+	wantStatus(t, do("GET", "/go/stats/summary", ""), http.StatusOK)
+}
+
+func TestForceHTTPS(t *testing.T) {
+	resetStore(t)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "sec"})
+	set(t, &forceHTTPS, true)
+	set(t, &hstsMaxAge, 600)
+
+	rec := do("GET", "/sec?x=1", "")
+	wantStatus(t, rec, http.StatusMovedPermanently)
+	if got := rec.Header().Get("Location"); got != "https://"+testHost+"/sec?x=1" {
+		t.Errorf("Location = %q", got)
+	}
+	wantStatus(t, do("GET", "/healthz", ""), http.StatusOK)
+
+	r := request("GET", "/sec", "")
+	r.Header.Set("X-Forwarded-Proto", "https")
+	rec = serve(r)
+	wantStatus(t, rec, http.StatusFound)
+	if got := rec.Header().Get("Strict-Transport-Security"); got != "max-age=600" {
+		t.Errorf("Strict-Transport-Security = %q", got)
+	}
+}
+
+func TestStripTrailingSlash(t *testing.T) {
+	resetStore(t)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "abc"})
+
+	wantStatus(t, do("GET", "/abc/", ""), http.StatusNotFound)
+
+	set(t, &stripTrailingSlash, true)
+	rec := do("GET", "/abc/", "")
+	wantStatus(t, rec, http.StatusFound)
+	if got := rec.Header().Get("Location"); got != "https://example.com" {
+		t.Errorf("Location = %q", got)
+	}
+	wantStatus(t, do("GET", "/abc", ""), http.StatusFound)
+	wantStatus(t, do("GET", "/shorturls/abc/", ""), http.StatusOK)
+	// Only a single slash is stripped
+	wantStatus(t, do("GET", "/abc//", ""), http.StatusNotFound)
+}
+
+func TestCanonicalHost(t *testing.T) {
+	resetStore(t)
+	set(t, &canonicalHost, "sho.rt")
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "abc"})
+
+	r := request("GET", "/abc?x=1", "")
+	r.Host = "old.example.com"
+	rec := serve(r)
+	wantStatus(t, rec, http.StatusMovedPermanently)
+	if got := rec.Header().Get("Location"); got != "http://sho.rt/abc?x=1" {
+		t.Errorf("Location = %q, want the same path on the canonical host", got)
+	}
+
+	r = request("GET", "/abc", "")
+	r.Host = "SHO.RT"
+	wantStatus(t, serve(r), http.StatusFound)
+
+	r = request("GET", "/healthz", "")
+	r.Host = "10.0.0.7:8080"
+	wantStatus(t, serve(r), http.StatusOK)
+}
+
+func TestCanonicalHostWithForceHTTPS(t *testing.T) {
+	resetStore(t)
+	set(t, &canonicalHost, "sho.rt")
+	set(t, &forceHTTPS, true)
+
+	// An old plain-HTTP link reaches the canonical HTTPS URL in one hop
+	r := request("GET", "/abc", "")
+	r.Host = "old.example.com"
+	rec := serve(r)
+	wantStatus(t, rec, http.StatusMovedPermanently)
+	if got := rec.Header().Get("Location"); got != "https://sho.rt/abc" {
+		t.Errorf("Location = %q", got)
+	}
+}
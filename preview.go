@@ -0,0 +1,84 @@
+package main
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// redirectAllowlist restricts automatic redirects to these domains and their
+// subdomains. When it is set, every other destination gets the preview page.
+var redirectAllowlist []string
+
+var previewTemplate = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Leaving this site</title></head>
+<body>
+<p>This link leads to an external site:</p>
+<p><code>{{.}}</code></p>
+<p><a href="{{.}}" rel="noopener noreferrer">Continue to destination</a></p>
+</body>
+</html>
+`))
+
+// redirectMode is the default redirect mode for links that don't choose one:
+// "http" for a status-code redirect or "html" for a meta-refresh page, which
+// suits embedded webviews that mishandle 302s
+var redirectMode = "http"
+
+var htmlRedirectTemplate = template.Must(template.New("redirect").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="0;url={{.}}">
+<title>Redirecting</title>
+<script>window.location.replace({{.}});</script>
+</head>
+<body>
+<p>Redirecting to <a href="{{.}}">{{.}}</a></p>
+</body>
+</html>
+`))
+
+func validRedirectMode(mode string) bool {
+	return mode == "http" || mode == "html"
+}
+
+// renderHTMLRedirect serves a 200 page that sends the browser on to
+// destination. html/template escapes it for each context it appears in.
+func renderHTMLRedirect(w http.ResponseWriter, destination string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := htmlRedirectTemplate.Execute(w, destination); err != nil {
+		log.Printf("Rendering redirect page: %v", err)
+	}
+}
+
+// redirectAllowed reports whether destination may be redirected to directly
+func redirectAllowed(destination string) bool {
+	if len(redirectAllowlist) == 0 {
+		return true
+	}
+	u, err := url.Parse(destination)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, domain := range redirectAllowlist {
+		domain = strings.ToLower(domain)
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// renderPreview shows an interstitial page linking to destination instead of
+// redirecting to it
+func renderPreview(w http.ResponseWriter, destination string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := previewTemplate.Execute(w, destination); err != nil {
+		log.Printf("Rendering preview: %v", err)
+	}
+}
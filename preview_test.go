@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRedirectAllowed(t *testing.T) {
+	set(t, &redirectAllowlist, nil)
+	if !redirectAllowed("https://anything.example") {
+		t.Error("destination refused without an allowlist")
+	}
+
+	set(t, &redirectAllowlist, []string{"Example.com"})
+	tests := map[string]bool{
+		"https://example.com/a":     true,
+		"https://docs.example.com":  true,
+		"https://notexample.com":    false,
+		"https://example.com.evil":  false,
+		"https://other.example.org": false,
+	}
+	for dest, want := range tests {
+		if got := redirectAllowed(dest); got != want {
+			t.Errorf("redirectAllowed(%q) = %v, want %v", dest, got, want)
+		}
+	}
+}
+
+func TestRedirectOutsideAllowlistShowsPreview(t *testing.T) {
+	resetStore(t)
+	set(t, &redirectAllowlist, []string{"example.com"})
+	mustCreate(t, ShortURLRequest{URL: "https://example.com/ok", Shortcode: "in"})
+	mustCreate(t, ShortURLRequest{URL: "https://elsewhere.test/?q=<b>", Shortcode: "out"})
+
+	wantStatus(t, do("GET", "/in", ""), http.StatusFound)
+
+	rec := do("GET", "/out", "")
+	wantStatus(t, rec, http.StatusOK)
+	if !strings.Contains(rec.Body.String(), "Continue to destination") {
+		t.Errorf("no preview page: %q", rec.Body.String())
+	}
+	if strings.Contains(rec.Body.String(), "<b>") {
+		t.Error("destination was not escaped on the preview page")
+	}
+}
+
+func TestHTMLRedirectMode(t *testing.T) {
+	resetStore(t)
+	destination := `https://example.com/a?x=1&y="</script><b>'`
+	mustCreate(t, ShortURLRequest{URL: destination, Shortcode: "page", RedirectMode: "html"})
+
+	rec := do("GET", "/page", "")
+	wantStatus(t, rec, http.StatusOK)
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	body := rec.Body.String()
+	if strings.Contains(body, `"</script><b>`) || strings.Contains(body, "<b>") {
+		t.Errorf("destination not escaped:\n%s", body)
+	}
+	for _, want := range []string{
+		`<meta http-equiv="refresh" content="0;url=https://example.com/a?x=1&amp;y=`,
+		`window.location.replace("https://example.com/a?x=1\u0026y=\"\u003c/script\u003e\u003cb\u003e'")`,
+		`<a href="https://example.com/a?x=1&amp;y=%22%3c/script%3e%3cb%3e%27">`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page is missing %s:\n%s", want, body)
+		}
+	}
+	if stats := getStats(t, "page"); stats.TotalClicks != 1 {
+		t.Errorf("TotalClicks = %d, want the page view counted", stats.TotalClicks)
+	}
+}
+
+func TestGlobalRedirectMode(t *testing.T) {
+	resetStore(t)
+	set(t, &redirectMode, "html")
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "global"})
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "plain", RedirectMode: "http"})
+
+	wantStatus(t, do("GET", "/global", ""), http.StatusOK)
+	wantStatus(t, do("GET", "/plain", ""), http.StatusFound)
+	wantStatus(t, do("POST", "/shorturls", `{"url": "https://example.com", "redirectMode": "js"}`), http.StatusBadRequest)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// problemJSON sends every error as application/problem+json (RFC 7807),
+// from PROBLEM_JSON. Without it only clients that ask for that media type
+// in Accept get it.
+var problemJSON bool
+
+// ProblemDetails is an RFC 7807 error body. Fields of the plain error body
+// other than "error" are kept as extension members.
+type ProblemDetails struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// problemWriter marks a response whose errors jsonError writes as
+// problem+json
+type problemWriter struct {
+	http.ResponseWriter
+}
+
+func (pw *problemWriter) Unwrap() http.ResponseWriter {
+	return pw.ResponseWriter
+}
+
+// withProblemJSON opts requests into problem+json errors when PROBLEM_JSON
+// is set or they accept application/problem+json
+func withProblemJSON(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if problemJSON || acceptsProblemJSON(r) {
+			w = &problemWriter{ResponseWriter: w}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// acceptsProblemJSON reports whether the Accept header lists
+// application/problem+json
+func acceptsProblemJSON(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.TrimSpace(mediaType) == "application/problem+json" {
+			return true
+		}
+	}
+	return false
+}
+
+// wantsProblemJSON reports whether w belongs to a request that opted into
+// problem+json errors
+func wantsProblemJSON(w http.ResponseWriter) bool {
+	for {
+		if _, ok := w.(*problemWriter); ok {
+			return true
+		}
+		unwrapper, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return false
+		}
+		w = unwrapper.Unwrap()
+	}
+}
+
+// problemBody converts a plain {"error": ...} body into problem details. The
+// error text becomes the detail, and a body that is not a JSON object is
+// used as the detail as it is.
+func problemBody(body string, status int) []byte {
+	problem := ProblemDetails{Type: "about:blank", Title: http.StatusText(status), Status: status}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(body), &fields); err != nil {
+		problem.Detail = strings.TrimSpace(body)
+		encoded, _ := json.Marshal(problem)
+		return encoded
+	}
+	if raw, ok := fields["error"]; ok {
+		json.Unmarshal(raw, &problem.Detail)
+		delete(fields, "error")
+	}
+	for _, member := range []string{"type", "title", "status", "detail"} {
+		delete(fields, member)
+	}
+
+	encoded, _ := json.Marshal(problem)
+	if len(fields) == 0 {
+		return encoded
+	}
+	extensions, _ := json.Marshal(fields)
+	return append(append(bytes.TrimSuffix(encoded, []byte("}")), ','), extensions[1:]...)
+}
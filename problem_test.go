@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestProblemBody(t *testing.T) {
+	tests := []struct {
+		body   string
+		status int
+		want   string
+	}{
+		{`{"error": "Short URL not found"}`, http.StatusNotFound,
+			`{"type":"about:blank","title":"Not Found","status":404,"detail":"Short URL not found"}`},
+		// Other fields are kept as extension members, except those that
+		// would clash with the standard ones
+		{`{"error": "Too many redirects", "code": "throttled", "status": "x"}`, http.StatusTooManyRequests,
+			`{"type":"about:blank","title":"Too Many Requests","status":429,"detail":"Too many redirects","code":"throttled"}`},
+		{"Service draining\n", http.StatusServiceUnavailable,
+			`{"type":"about:blank","title":"Service Unavailable","status":503,"detail":"Service draining"}`},
+		{`{}`, http.StatusBadRequest, `{"type":"about:blank","title":"Bad Request","status":400}`},
+	}
+	for _, tt := range tests {
+		if got := string(problemBody(tt.body, tt.status)); got != tt.want {
+			t.Errorf("problemBody(%q) =\n%s\nwant\n%s", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestProblemJSONOnRequest(t *testing.T) {
+	resetStore(t)
+	r := request("GET", "/shorturls/missing", "")
+	r.Header.Set("Accept", "application/json;q=0.9, application/problem+json")
+	rec := serve(r)
+	wantStatus(t, rec, http.StatusNotFound)
+	if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("Content-Type = %q, want application/problem+json", ct)
+	}
+	var problem ProblemDetails
+	decode(t, rec, &problem)
+	if problem != (ProblemDetails{Type: "about:blank", Title: "Not Found", Status: 404, Detail: "Short URL not found"}) {
+		t.Errorf("problem = %+v", problem)
+	}
+
+	// Without asking, errors keep the plain format
+	rec = do("GET", "/shorturls/missing", "")
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("default Content-Type = %q", ct)
+	}
+	var plain map[string]interface{}
+	decode(t, rec, &plain)
+	if _, ok := plain["error"]; !ok || plain["status"] != nil {
+		t.Errorf("default error body = %v", plain)
+	}
+}
+
+func TestProblemJSONSetting(t *testing.T) {
+	resetStore(t)
+	set(t, &problemJSON, true)
+	rec := do("POST", "/shorturls", `{"url": "ftp://example.com"}`)
+	wantStatus(t, rec, http.StatusBadRequest)
+	if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	var fields map[string]json.RawMessage
+	decode(t, rec, &fields)
+	for _, member := range []string{"type", "title", "status", "detail"} {
+		if _, ok := fields[member]; !ok {
+			t.Errorf("problem has no %s: %s", member, rec.Body)
+		}
+	}
+
+	// Successful responses are untouched
+	rec = do("POST", "/shorturls", `{"url": "https://example.com"}`)
+	wantStatus(t, rec, http.StatusCreated)
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("success Content-Type = %q", ct)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/skip2/go-qrcode"
+)
+
+// qrSize is the width and height in pixels of generated QR codes
+const qrSize = 256
+
+// qrCodeBase64 renders link as a PNG QR code encoded in base64
+func qrCodeBase64(link string) (string, error) {
+	png, err := qrcode.Encode(link, qrcode.Medium, qrSize)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(png), nil
+}
+
+// qrLevels maps ?ecLevel= values to error correction levels
+var qrLevels = map[string]qrcode.RecoveryLevel{
+	"L": qrcode.Low,
+	"M": qrcode.Medium,
+	"Q": qrcode.High,
+	"H": qrcode.Highest,
+}
+
+// Bounds on ?size= for PNG QR codes, in pixels
+const (
+	minQRSize = 64
+	maxQRSize = 2048
+)
+
+// getQRCode renders the short link of a code as a QR code: a PNG of ?size=
+// pixels (default qrSize) or, with ?format=svg, a scalable SVG for print.
+// ?ecLevel= picks the error correction level, L, M (the default), Q or H.
+func getQRCode(w http.ResponseWriter, r *http.Request) {
+	shortCode := mux.Vars(r)["shortcode"]
+	query := r.URL.Query()
+
+	levelName := strings.ToUpper(query.Get("ecLevel"))
+	if levelName == "" {
+		levelName = "M"
+	}
+	level, ok := qrLevels[levelName]
+	if !ok {
+		jsonError(w, `{"error": "ecLevel must be one of L, M, Q or H"}`, http.StatusBadRequest)
+		return
+	}
+	format := query.Get("format")
+	if format == "" {
+		format = "png"
+	}
+	if format != "png" && format != "svg" {
+		jsonError(w, `{"error": "format must be png or svg"}`, http.StatusBadRequest)
+		return
+	}
+	size := qrSize
+	if v := query.Get("size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < minQRSize || n > maxQRSize {
+			jsonError(w, fmt.Sprintf(`{"error": "size must be between %d and %d"}`, minQRSize, maxQRSize), http.StatusBadRequest)
+			return
+		}
+		size = n
+	}
+
+	storeLock.RLock()
+	_, exists := urlStore[shortCode]
+	storeLock.RUnlock()
+	if !exists {
+		jsonError(w, `{"error": "Short URL not found"}`, http.StatusNotFound)
+		return
+	}
+
+	qr, err := qrcode.New(baseURL(r)+"/"+shortCode, level)
+	if err != nil {
+		log.Printf("Generating QR code: %v", err)
+		jsonError(w, `{"error": "Could not generate QR code"}`, http.StatusInternalServerError)
+		return
+	}
+
+	if format == "svg" {
+		w.Header().Set("Content-Type", "image/svg+xml")
+		writeQRSVG(w, qr.Bitmap())
+		return
+	}
+	png, err := qr.PNG(size)
+	if err != nil {
+		log.Printf("Generating QR code: %v", err)
+		jsonError(w, `{"error": "Could not generate QR code"}`, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(png)
+}
+
+// writeQRSVG draws bitmap, quiet zone included, as an SVG with one unit per
+// module. Each row's dark runs become a single path segment to keep it small.
+func writeQRSVG(w io.Writer, bitmap [][]bool) {
+	n := len(bitmap)
+	fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, n, n)
+	fmt.Fprintf(w, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, n, n)
+	for y, row := range bitmap {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+			start := x
+			for x < len(row) && row[x] {
+				x++
+			}
+			fmt.Fprintf(w, "M%d %dh%dv1h-%dz", start, y, x-start, x-start)
+		}
+	}
+	fmt.Fprint(w, `"/></svg>`)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"image/png"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/skip2/go-qrcode"
+)
+
+func TestCreateWithQRCode(t *testing.T) {
+	resetStore(t)
+	rec := do("POST", "/shorturls?qr=true", `{"url": "https://example.com", "shortcode": "qr"}`)
+	wantStatus(t, rec, http.StatusCreated)
+	var response ShortURLResponse
+	decode(t, rec, &response)
+
+	data, err := base64.StdEncoding.DecodeString(response.QRCode)
+	if err != nil {
+		t.Fatalf("qrCode is not base64: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("qrCode is not a PNG: %v", err)
+	}
+	if size := img.Bounds().Dx(); size != qrSize {
+		t.Errorf("QR code is %dpx wide, want %d", size, qrSize)
+	}
+
+	rec = do("POST", "/shorturls", `{"url": "https://example.com"}`)
+	var plain ShortURLResponse
+	decode(t, rec, &plain)
+	if plain.QRCode != "" {
+		t.Error("QR code included without ?qr=true")
+	}
+}
+
+func TestQRCodePNG(t *testing.T) {
+	resetStore(t)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "qr"})
+
+	for target, want := range map[string]int{"/shorturls/qr/qr": qrSize, "/shorturls/qr/qr?size=512&ecLevel=h": 512} {
+		rec := do("GET", target, "")
+		wantStatus(t, rec, http.StatusOK)
+		if ct := rec.Header().Get("Content-Type"); ct != "image/png" {
+			t.Errorf("%s: Content-Type = %q", target, ct)
+		}
+		img, err := png.Decode(rec.Body)
+		if err != nil {
+			t.Fatalf("%s: not a PNG: %v", target, err)
+		}
+		if size := img.Bounds().Dx(); size != want {
+			t.Errorf("%s: %dpx wide, want %d", target, size, want)
+		}
+	}
+	wantStatus(t, do("GET", "/shorturls/missing/qr", ""), http.StatusNotFound)
+}
+
+func TestQRCodeSVG(t *testing.T) {
+	resetStore(t)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "qr"})
+
+	rec := do("GET", "/shorturls/qr/qr?format=svg&ecLevel=Q", "")
+	wantStatus(t, rec, http.StatusOK)
+	if ct := rec.Header().Get("Content-Type"); ct != "image/svg+xml" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	var svg struct {
+		XMLName xml.Name `xml:"http://www.w3.org/2000/svg svg"`
+		ViewBox string   `xml:"viewBox,attr"`
+		Path    struct {
+			D string `xml:"d,attr"`
+		} `xml:"path"`
+	}
+	if err := xml.Unmarshal(rec.Body.Bytes(), &svg); err != nil {
+		t.Fatalf("not an SVG: %v\n%s", err, rec.Body)
+	}
+
+	// One unit per module, drawn from the same code a PNG would show
+	qr, err := qrcode.New("http://"+testHost+"/qr", qrcode.High)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bitmap := qr.Bitmap()
+	if want := fmt.Sprintf("0 0 %d %d", len(bitmap), len(bitmap)); svg.ViewBox != want {
+		t.Errorf("viewBox = %q, want %q", svg.ViewBox, want)
+	}
+	var b strings.Builder
+	writeQRSVG(&b, bitmap)
+	if b.String() != rec.Body.String() {
+		t.Error("SVG does not match the ecLevel=Q code")
+	}
+	if !strings.HasPrefix(svg.Path.D, "M") {
+		t.Errorf("path = %.40q", svg.Path.D)
+	}
+}
+
+func TestWriteQRSVG(t *testing.T) {
+	var b strings.Builder
+	writeQRSVG(&b, [][]bool{{true, true, false}, {false, false, false}, {true, false, true}})
+	want := `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 3 3" shape-rendering="crispEdges">` +
+		`<rect width="3" height="3" fill="#fff"/><path fill="#000" d="M0 0h2v1h-2zM0 2h1v1h-1zM2 2h1v1h-1z"/></svg>`
+	if b.String() != want {
+		t.Errorf("writeQRSVG =\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestQRCodeInvalidParameters(t *testing.T) {
+	resetStore(t)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "qr"})
+
+	for _, query := range []string{"ecLevel=X", "ecLevel=medium", "format=jpeg", "size=32", "size=4096", "size=big"} {
+		wantStatus(t, do("GET", "/shorturls/qr/qr?"+query, ""), http.StatusBadRequest)
+	}
+}
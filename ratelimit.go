@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const defaultRateLimitWindow = time.Minute
+
+// Rate limit settings, populated from the environment in main. Creation is
+// unlimited unless RATE_LIMIT is set. SIGHUP updates the limiter itself.
+var (
+	rateLimitRequests int
+	rateLimitWindow   = defaultRateLimitWindow
+	// rateLimitJitter spreads Retry-After values by up to this much either side
+	// of the true reset time so limited clients don't all retry at once
+	rateLimitJitter time.Duration
+)
+
+// creationLimiter limits URL creation per client IP
+var creationLimiter *rateLimiter
+
+// rateLimiter is a fixed-window request counter keyed by client
+type rateLimiter struct {
+	mu      sync.Mutex
+	limit   int
+	window  time.Duration
+	clients map[string]*rateWindow
+}
+
+type rateWindow struct {
+	count int
+	reset time.Time
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{limit: limit, window: window, clients: make(map[string]*rateWindow)}
+}
+
+// setLimits changes the limit and window. Windows already open keep their
+// reset time but are judged against the new limit.
+func (l *rateLimiter) setLimits(limit int, window time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit, l.window = limit, window
+}
+
+// allow records a request from key and reports whether it is within the limit,
+// along with the limit, the requests remaining and the time the current window
+// resets. A limit of 0 allows everything without tracking the client.
+func (l *rateLimiter) allow(key string, now time.Time) (bool, int, int, time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limit <= 0 {
+		return true, 0, 0, time.Time{}
+	}
+
+	win, ok := l.clients[key]
+	if !ok || !now.Before(win.reset) {
+		win = &rateWindow{reset: now.Add(l.window)}
+		l.clients[key] = win
+	}
+	win.count++
+	return win.count <= l.limit, l.limit, max(l.limit-win.count, 0), win.reset
+}
+
+// sweep removes clients whose window has already reset, returning how many
+// were dropped. Without it the map would keep one entry per client ever seen.
+func (l *rateLimiter) sweep(now time.Time) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	removed := 0
+	for key, win := range l.clients {
+		if !now.Before(win.reset) {
+			delete(l.clients, key)
+			removed++
+		}
+	}
+	return removed
+}
+
+// size returns the number of clients currently tracked
+func (l *rateLimiter) size() int {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.clients)
+}
+
+// runSweeper sweeps the limiter once per window, as configured at start, until
+// stop is closed
+func (l *rateLimiter) runSweeper(stop <-chan struct{}) {
+	l.mu.Lock()
+	interval := l.window
+	l.mu.Unlock()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			l.sweep(now)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// retryAfter returns the Retry-After seconds for a window resetting at reset,
+// randomized within rateLimitJitter and never below one second
+func retryAfter(reset, now time.Time) int {
+	wait := reset.Sub(now)
+	if rateLimitJitter > 0 {
+		wait += time.Duration(rand.Int63n(int64(2*rateLimitJitter)+1)) - rateLimitJitter
+	}
+	seconds := int((wait + time.Second - 1) / time.Second)
+	return max(seconds, 1)
+}
+
+// RateLimitError is the body of a 429, mirroring the X-RateLimit headers
+type RateLimitError struct {
+	Error     string `json:"error"`
+	Limit     int    `json:"limit"`
+	Remaining int    `json:"remaining"`
+	// Reset is when the window resets; RetryAfter is the Retry-After value
+	Reset      string `json:"reset"`
+	RetryAfter int    `json:"retryAfter"`
+}
+
+// rateLimit rejects requests over the per-client limit with 429. Every
+// response carries X-RateLimit-* headers so clients can back off early.
+func rateLimit(limiter *rateLimiter, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if limiter == nil {
+			next(w, r)
+			return
+		}
+		now := time.Now()
+		ok, limit, remaining, reset := limiter.allow(clientIP(r), now)
+		if limit <= 0 {
+			next(w, r)
+			return
+		}
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		if !ok {
+			wait := retryAfter(reset, now)
+			w.Header().Set("Retry-After", strconv.Itoa(wait))
+			body, _ := json.Marshal(RateLimitError{
+				Error:      "Too many requests",
+				Limit:      limit,
+				Remaining:  remaining,
+				Reset:      reset.UTC().Format(time.RFC3339),
+				RetryAfter: wait,
+			})
+			jsonError(w, string(body), http.StatusTooManyRequests)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// clientIP returns the IP address of the client that sent r
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRetryAfterJitter(t *testing.T) {
+	now := time.Now()
+	set(t, &rateLimitJitter, 0)
+	if got := retryAfter(now.Add(10*time.Second), now); got != 10 {
+		t.Errorf("retryAfter without jitter = %d, want 10", got)
+	}
+	if got := retryAfter(now.Add(1500*time.Millisecond), now); got != 2 {
+		t.Errorf("retryAfter rounds %d, want up to 2", got)
+	}
+	if got := retryAfter(now.Add(-time.Second), now); got != 1 {
+		t.Errorf("retryAfter after reset = %d, want 1", got)
+	}
+
+	set(t, &rateLimitJitter, 5*time.Second)
+	seen := make(map[int]bool)
+	for i := 0; i < 500; i++ {
+		got := retryAfter(now.Add(10*time.Second), now)
+		if got < 5 || got > 15 {
+			t.Fatalf("retryAfter with 5s jitter = %d, want 5-15", got)
+		}
+		seen[got] = true
+	}
+	if len(seen) < 3 {
+		t.Errorf("retryAfter took only %d values with jitter", len(seen))
+	}
+
+	// Jitter never brings the wait below a second
+	for i := 0; i < 100; i++ {
+		if got := retryAfter(now.Add(time.Second), now); got < 1 {
+			t.Fatalf("retryAfter = %d, want at least 1", got)
+		}
+	}
+}
+
+func TestRateLimiterWindows(t *testing.T) {
+	limiter := newRateLimiter(2, time.Minute)
+	now := time.Now()
+	for i, want := range []bool{true, true, false} {
+		if ok, _, _, _ := limiter.allow("192.0.2.1", now); ok != want {
+			t.Errorf("request %d allowed = %v, want %v", i+1, ok, want)
+		}
+	}
+	if ok, _, _, _ := limiter.allow("192.0.2.2", now); !ok {
+		t.Error("another client shares the first one's window")
+	}
+	if ok, _, remaining, _ := limiter.allow("192.0.2.1", now.Add(time.Minute)); !ok || remaining != 1 {
+		t.Errorf("after the window reset: allowed %v with %d remaining", ok, remaining)
+	}
+}
+
+func TestRateLimiterSweep(t *testing.T) {
+	limiter := newRateLimiter(5, time.Minute)
+	now := time.Now()
+	limiter.allow("old", now.Add(-2*time.Minute))
+	limiter.allow("current", now)
+
+	if removed := limiter.sweep(now); removed != 1 {
+		t.Errorf("sweep removed %d clients, want 1", removed)
+	}
+	if limiter.size() != 1 {
+		t.Errorf("%d clients tracked after sweep, want 1", limiter.size())
+	}
+	var unset *rateLimiter
+	if unset.size() != 0 {
+		t.Error("nil limiter reports clients")
+	}
+}
+
+func TestRateLimiterUnlimited(t *testing.T) {
+	limiter := newRateLimiter(0, time.Minute)
+	for i := 0; i < 10; i++ {
+		if ok, _, _, _ := limiter.allow("192.0.2.1", time.Now()); !ok {
+			t.Fatal("request refused without a limit")
+		}
+	}
+	if limiter.size() != 0 {
+		t.Error("unlimited limiter tracks clients")
+	}
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	resetStore(t)
+	set(t, &creationLimiter, newRateLimiter(3, time.Minute))
+	set(t, &rateLimitJitter, 0)
+
+	for i, want := range []string{"2", "1", "0"} {
+		rec := do("POST", "/shorturls", `{"url": "https://example.com"}`)
+		wantStatus(t, rec, http.StatusCreated)
+		if got := rec.Header().Get("X-RateLimit-Remaining"); got != want {
+			t.Errorf("request %d: X-RateLimit-Remaining = %q, want %s", i+1, got, want)
+		}
+		if got := rec.Header().Get("X-RateLimit-Limit"); got != "3" {
+			t.Errorf("request %d: X-RateLimit-Limit = %q, want 3", i+1, got)
+		}
+		reset, err := strconv.ParseInt(rec.Header().Get("X-RateLimit-Reset"), 10, 64)
+		if err != nil || reset < time.Now().Unix() || reset > time.Now().Add(time.Minute).Unix() {
+			t.Errorf("request %d: X-RateLimit-Reset = %q", i+1, rec.Header().Get("X-RateLimit-Reset"))
+		}
+	}
+	wantStatus(t, do("POST", "/shorturls", `{"url": "https://example.com"}`), http.StatusTooManyRequests)
+}
+
+func TestRateLimitErrorBody(t *testing.T) {
+	resetStore(t)
+	set(t, &creationLimiter, newRateLimiter(1, time.Minute))
+	set(t, &rateLimitJitter, 0)
+	wantStatus(t, do("POST", "/shorturls", `{"url": "https://example.com"}`), http.StatusCreated)
+
+	rec := do("POST", "/shorturls", `{"url": "https://example.com"}`)
+	wantStatus(t, rec, http.StatusTooManyRequests)
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	var body RateLimitError
+	decode(t, rec, &body)
+	if body.Error != "Too many requests" || body.Limit != 1 || body.Remaining != 0 {
+		t.Errorf("429 body = %+v", body)
+	}
+	reset, err := time.Parse(time.RFC3339, body.Reset)
+	if err != nil || strconv.FormatInt(reset.Unix(), 10) != rec.Header().Get("X-RateLimit-Reset") {
+		t.Errorf("reset = %q, header %q", body.Reset, rec.Header().Get("X-RateLimit-Reset"))
+	}
+	if body.RetryAfter < 1 || body.RetryAfter > 60 || strconv.Itoa(body.RetryAfter) != rec.Header().Get("Retry-After") {
+		t.Errorf("retryAfter = %d, Retry-After %q", body.RetryAfter, rec.Header().Get("Retry-After"))
+	}
+}
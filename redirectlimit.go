@@ -0,0 +1,98 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// redirectRateLimit is the default cap on redirects per second through any
+// one shortcode; 0 leaves codes unlimited unless they set their own
+var redirectRateLimit float64
+
+// redirectsThrottled counts redirects refused by the per-code limit
+var redirectsThrottled atomic.Int64
+
+// redirectLimits holds the per-code token buckets
+var redirectLimits = newRedirectLimiter()
+
+// redirectLimiter is a token bucket per shortcode. Each bucket holds up to
+// one second's worth of tokens, so a code may burst to its rate.
+type redirectLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens  float64
+	rate    float64
+	updated time.Time
+}
+
+func newRedirectLimiter() *redirectLimiter {
+	return &redirectLimiter{buckets: make(map[string]*tokenBucket)}
+}
+
+// allow takes a token from code's bucket, refilled at rate per second since
+// it was last used, and reports whether one was available
+func (l *redirectLimiter) allow(code string, rate float64, now time.Time) bool {
+	burst := max(rate, 1)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[code]
+	if !ok {
+		b = &tokenBucket{tokens: burst, updated: now}
+		l.buckets[code] = b
+	}
+	b.tokens = min(burst, b.tokens+now.Sub(b.updated).Seconds()*rate)
+	b.rate, b.updated = rate, now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// sweep drops buckets that have refilled completely, since a missing bucket
+// behaves the same as a full one
+func (l *redirectLimiter) sweep(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for code, b := range l.buckets {
+		if b.tokens+now.Sub(b.updated).Seconds()*b.rate >= max(b.rate, 1) {
+			delete(l.buckets, code)
+		}
+	}
+}
+
+// runSweeper sweeps the buckets once a minute until stop is closed
+func (l *redirectLimiter) runSweeper(stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			l.sweep(now)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// redirectThrottled applies the per-code limit to a redirect through url:
+// its own RedirectRateLimit, or else REDIRECT_RATE_LIMIT. When the redirect
+// must be refused it reports true with the Retry-After value.
+func redirectThrottled(url ShortURL, now time.Time) (string, bool) {
+	rate := url.RedirectRateLimit
+	if rate == 0 {
+		rate = redirectRateLimit
+	}
+	if rate <= 0 || redirectLimits.allow(url.ShortCode, rate, now) {
+		return "", false
+	}
+	redirectsThrottled.Add(1)
+	return strconv.Itoa(max(int(math.Ceil(1/rate)), 1)), true
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRedirectLimiterRefill(t *testing.T) {
+	limiter := newRedirectLimiter()
+	now := time.Now()
+	for i, want := range []bool{true, true, false} {
+		if got := limiter.allow("hot", 2, now); got != want {
+			t.Errorf("redirect %d allowed = %v, want %v", i+1, got, want)
+		}
+	}
+	if !limiter.allow("cold", 2, now) {
+		t.Error("another code shares the first one's bucket")
+	}
+	// Half a second at 2/s buys one more token
+	if !limiter.allow("hot", 2, now.Add(500*time.Millisecond)) {
+		t.Error("bucket did not refill")
+	}
+	if limiter.allow("hot", 2, now.Add(500*time.Millisecond)) {
+		t.Error("bucket refilled past its rate")
+	}
+
+	// A rate below one per second still lets a single redirect through
+	if !limiter.allow("slow", 0.1, now) || limiter.allow("slow", 0.1, now.Add(5*time.Second)) {
+		t.Error("0.1/s bucket does not hold one token")
+	}
+}
+
+func TestRedirectLimiterSweep(t *testing.T) {
+	limiter := newRedirectLimiter()
+	now := time.Now()
+	limiter.allow("idle", 1, now.Add(-time.Minute))
+	limiter.allow("busy", 1, now)
+
+	limiter.sweep(now)
+	if _, ok := limiter.buckets["idle"]; ok {
+		t.Error("full bucket kept")
+	}
+	if _, ok := limiter.buckets["busy"]; !ok {
+		t.Error("drained bucket swept")
+	}
+}
+
+func TestPerCodeRedirectLimit(t *testing.T) {
+	resetStore(t)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "hot", RedirectRateLimit: 2})
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "other"})
+	throttled := redirectsThrottled.Load()
+
+	wantStatus(t, do("GET", "/hot", ""), http.StatusFound)
+	wantStatus(t, do("GET", "/hot", ""), http.StatusFound)
+	rec := do("GET", "/hot", "")
+	wantStatus(t, rec, http.StatusTooManyRequests)
+	if got := rec.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %q, want 1", got)
+	}
+	var body map[string]string
+	decode(t, rec, &body)
+	if body["code"] != "throttled" {
+		t.Errorf("429 body = %v", body)
+	}
+	for i := 0; i < 5; i++ {
+		wantStatus(t, do("GET", "/other", ""), http.StatusFound)
+	}
+
+	if n := redirectsThrottled.Load() - throttled; n != 1 {
+		t.Errorf("%d redirects counted as throttled, want 1", n)
+	}
+	// The refused attempt still counts towards the link's redirect rate
+	rates := redirectRates.top(10, time.Now())
+	for _, kr := range rates {
+		if kr.key == "hot" && kr.rate*redirectRates.tau.Seconds() < 2.9 {
+			t.Errorf("hot scored %.2f hits, want 3", kr.rate*redirectRates.tau.Seconds())
+		}
+	}
+	if len(rates) != 2 {
+		t.Errorf("rates = %+v", rates)
+	}
+	if stats, _ := GetStats("hot", clickPage{}); stats.TotalClicks != 2 {
+		t.Errorf("%d clicks recorded, want only the 2 redirects served", stats.TotalClicks)
+	}
+}
+
+func TestDefaultRedirectLimit(t *testing.T) {
+	resetStore(t)
+	set(t, &redirectRateLimit, 1)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "capped"})
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "fast", RedirectRateLimit: 5})
+
+	wantStatus(t, do("GET", "/capped", ""), http.StatusFound)
+	wantStatus(t, do("GET", "/capped", ""), http.StatusTooManyRequests)
+	// A link's own limit overrides the default
+	for i := 0; i < 5; i++ {
+		wantStatus(t, do("GET", "/fast", ""), http.StatusFound)
+	}
+	wantStatus(t, do("GET", "/fast", ""), http.StatusTooManyRequests)
+
+	wantStatus(t, do("POST", "/shorturls", `{"url": "https://example.com", "redirectRateLimit": -1}`), http.StatusBadRequest)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// reloadConfig re-reads the settings that may change while serving (RATE_LIMIT,
+// RATE_LIMIT_WINDOW, MAX_VALIDITY and BLOCKED_SHORTENER_DOMAINS) from the
+// environment and CONFIG_FILE. Every value is parsed before any is applied,
+// so a bad value leaves all of the current ones in place. Other settings
+// still need a restart.
+func reloadConfig() error {
+	previous := fileSettings
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		settings, err := readConfigFile(path)
+		if err != nil {
+			return fmt.Errorf("CONFIG_FILE: %v", err)
+		}
+		for name := range settings {
+			if !knownSettings[name] {
+				return fmt.Errorf("CONFIG_FILE: unknown setting %q", strings.ToLower(name))
+			}
+		}
+		fileSettings = settings
+	}
+
+	limit, window, validity, err := reloadedLimits()
+	if err != nil {
+		fileSettings = previous
+		return err
+	}
+	domains := blockedShortenerList(envList("BLOCKED_SHORTENER_DOMAINS"))
+	creationLimiter.setLimits(limit, window)
+	maxValidity.Store(int64(validity))
+	blockedShortenerDomains.Store(&domains)
+	return nil
+}
+
+// reloadedLimits parses the reloadable limits from the current settings
+func reloadedLimits() (limit int, window, validity time.Duration, err error) {
+	if limit, err = reloadInt("RATE_LIMIT", 0); err != nil {
+		return
+	}
+	if window, err = reloadDuration("RATE_LIMIT_WINDOW", defaultRateLimitWindow); err != nil {
+		return
+	}
+	if window == 0 {
+		window = defaultRateLimitWindow
+	}
+	validity, err = reloadDuration("MAX_VALIDITY", 0)
+	return
+}
+
+// reloadInt parses the named setting as a non-negative integer, returning
+// def when it is unset. Unlike envInt it rejects malformed values.
+func reloadInt(name string, def int) (int, error) {
+	v := setting(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s %q", name, v)
+	}
+	return n, nil
+}
+
+// reloadDuration parses the named setting as a non-negative duration,
+// returning def when it is unset. Unlike envDuration it rejects malformed
+// values.
+func reloadDuration(name string, def time.Duration) (time.Duration, error) {
+	v := setting(name)
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid %s %q", name, v)
+	}
+	return d, nil
+}
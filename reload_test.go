@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// reloadable saves the settings reloadConfig replaces and restores them
+// after the test
+func reloadable(t *testing.T) {
+	t.Helper()
+	set(t, &creationLimiter, newRateLimiter(0, defaultRateLimitWindow))
+	set(t, &fileSettings, nil)
+	set(t, &knownSettings, map[string]bool{
+		"RATE_LIMIT": true, "RATE_LIMIT_WINDOW": true, "MAX_VALIDITY": true, "BLOCKED_SHORTENER_DOMAINS": true,
+	})
+	domains := blockedShortenerDomains.Load()
+	t.Cleanup(func() { blockedShortenerDomains.Store(domains) })
+}
+
+func TestReloadConfig(t *testing.T) {
+	resetStore(t)
+	reloadable(t)
+	wantStatus(t, do("POST", "/shorturls", `{"url": "https://sho.rt/x"}`), http.StatusCreated)
+
+	t.Setenv("RATE_LIMIT", "2")
+	t.Setenv("MAX_VALIDITY", "1h")
+	t.Setenv("BLOCKED_SHORTENER_DOMAINS", "sho.rt")
+	if err := reloadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if maxValidity.Load() != int64(time.Hour) {
+		t.Errorf("maxValidity = %v, want 1h", time.Duration(maxValidity.Load()))
+	}
+	wantStatus(t, do("POST", "/shorturls", `{"url": "https://sho.rt/x"}`), http.StatusBadRequest)
+	wantStatus(t, do("POST", "/shorturls", `{"url": "https://bit.ly/x"}`), http.StatusCreated)
+	rec := do("POST", "/shorturls", `{"url": "https://example.com"}`)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("third request got %d, want the new limit of 2 enforced", rec.Code)
+	}
+	if got := rec.Header().Get("X-RateLimit-Limit"); got != "2" {
+		t.Errorf("X-RateLimit-Limit = %q, want 2", got)
+	}
+}
+
+func TestReloadConfigKeepsValuesOnError(t *testing.T) {
+	resetStore(t)
+	reloadable(t)
+	t.Setenv("RATE_LIMIT", "5")
+	t.Setenv("MAX_VALIDITY", "2h")
+	if err := reloadConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	// One bad value leaves every setting as it was
+	t.Setenv("RATE_LIMIT", "7")
+	t.Setenv("MAX_VALIDITY", "soon")
+	err := reloadConfig()
+	if err == nil || !strings.Contains(err.Error(), "MAX_VALIDITY") {
+		t.Fatalf("reloadConfig = %v, want a MAX_VALIDITY error", err)
+	}
+	if creationLimiter.limit != 5 || maxValidity.Load() != int64(2*time.Hour) {
+		t.Errorf("limit %d and max validity %v after a failed reload", creationLimiter.limit, time.Duration(maxValidity.Load()))
+	}
+	t.Setenv("MAX_VALIDITY", "2h")
+	t.Setenv("RATE_LIMIT", "-1")
+	if reloadConfig() == nil {
+		t.Error("negative RATE_LIMIT accepted")
+	}
+}
+
+func TestReloadConfigFile(t *testing.T) {
+	resetStore(t)
+	reloadable(t)
+	t.Setenv("CONFIG_FILE", writeConfigFile(t, `{"rate_limit": 3, "rate_limit_window": "30s"}`))
+	if err := reloadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if creationLimiter.limit != 3 || creationLimiter.window != 30*time.Second {
+		t.Errorf("limiter = %d per %v, want 3 per 30s", creationLimiter.limit, creationLimiter.window)
+	}
+
+	// A broken or unknown file keeps the settings read before
+	for _, content := range []string{`{"rate_limit": `, `{"rate_limit": 4, "port": 9000}`} {
+		t.Setenv("CONFIG_FILE", writeConfigFile(t, content))
+		if reloadConfig() == nil {
+			t.Errorf("reloading %s succeeded", content)
+		}
+		if fileSettings["RATE_LIMIT"] != "3" || creationLimiter.limit != 3 {
+			t.Errorf("after reloading %s: file settings %v, limit %d", content, fileSettings, creationLimiter.limit)
+		}
+	}
+}
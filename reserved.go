@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// routeCodes are path segments used by the API itself, either at the root or
+// under /shorturls/, so they can never be handed out as shortcodes
+var routeCodes = []string{
+	"shorturls", "admin", "s", "healthz", "readyz", "stats", "metrics",
+	"create", "by-url", "search", "recent", "expiring", "upsert", "robots.txt",
+}
+
+// reservedCodes holds the extra codes configured through RESERVED_CODES
+var reservedCodes []string
+
+// isReservedCode reports whether code collides with an API route or a
+// configured reserved word. The comparison is case-insensitive.
+func isReservedCode(code string) bool {
+	for _, list := range [][]string{routeCodes, reservedCodes} {
+		for _, reserved := range list {
+			if strings.EqualFold(code, reserved) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type AvailabilityResponse struct {
+	Shortcode string `json:"shortcode"`
+	Available bool   `json:"available"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// checkAvailability reports whether a custom shortcode can still be claimed
+func checkAvailability(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := requestTenant(r)
+	if !ok {
+		jsonError(w, `{"error": "Invalid API key"}`, http.StatusUnauthorized)
+		return
+	}
+	// Answer for the code the caller would actually get
+	requested := mux.Vars(r)["shortcode"]
+	shortCode := codePrefix(tenant) + requested
+	response := AvailabilityResponse{Shortcode: shortCode, Available: true}
+
+	switch {
+	case isReservedCode(requested):
+		response.Available = false
+		response.Reason = "reserved"
+	case inOtherNamespace(shortCode, tenant):
+		response.Available = false
+		response.Reason = "other tenant"
+	default:
+		storeLock.RLock()
+		claimed := codeClaimed(shortCode)
+		storeLock.RUnlock()
+		if claimed {
+			response.Available = false
+			response.Reason = "in use"
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	newJSONEncoder(w, r).Encode(response)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestIsReservedCode(t *testing.T) {
+	set(t, &reservedCodes, []string{"help", "About"})
+	for _, code := range []string{"help", "HELP", "about", "admin", "Shorturls"} {
+		if !isReservedCode(code) {
+			t.Errorf("isReservedCode(%q) = false", code)
+		}
+	}
+	for _, code := range []string{"helper", "abc"} {
+		if isReservedCode(code) {
+			t.Errorf("isReservedCode(%q) = true", code)
+		}
+	}
+}
+
+func TestCreateReservedCode(t *testing.T) {
+	resetStore(t)
+	set(t, &reservedCodes, []string{"help"})
+	wantStatus(t, do("POST", "/shorturls", `{"url": "https://example.com", "shortcode": "Help"}`), http.StatusBadRequest)
+}
+
+func TestCheckAvailability(t *testing.T) {
+	resetStore(t)
+	set(t, &reservedCodes, []string{"help"})
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "used"})
+
+	tests := []struct {
+		code       string
+		available  bool
+		wantReason string
+	}{
+		{"free", true, ""},
+		{"used", false, "in use"},
+		{"help", false, "reserved"},
+	}
+	for _, tt := range tests {
+		rec := do("GET", "/shorturls/"+tt.code+"/available", "")
+		wantStatus(t, rec, http.StatusOK)
+		var response AvailabilityResponse
+		decode(t, rec, &response)
+		if response.Available != tt.available || response.Reason != tt.wantReason {
+			t.Errorf("%s: response = %+v", tt.code, response)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"time"
+)
+
+// Retention settings, populated from the environment in main. Click details
+// are kept forever unless CLICK_RETENTION is set.
+var (
+	clickRetention         time.Duration
+	clickRetentionInterval = time.Minute
+)
+
+// runRetention prunes old click details periodically until stop is closed
+func runRetention(stop <-chan struct{}) {
+	ticker := time.NewTicker(clickRetentionInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			if removed := pruneClicksBefore(now.Add(-clickRetention)); removed > 0 {
+				log.Printf("Retention dropped %d click details", removed)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// pruneClicksBefore drops click details older than cutoff. Totals come from
+// clickCounts and are unaffected. Click logs are kept in timestamp order,
+// so the old clicks are always a prefix. It returns the number of details
+// dropped.
+func pruneClicksBefore(cutoff time.Time) int {
+	storeLock.Lock()
+	defer storeLock.Unlock()
+
+	removed := 0
+	for code, clicks := range analytics {
+		// Roll up whole days first so their totals outlive the clicks
+		if rollupInterval > 0 {
+			rollupLinkClicks(code, clicks, cutoff)
+		}
+		drop := sort.Search(clicks.Len(), func(i int) bool {
+			return !clicks.At(i).Timestamp.Before(cutoff)
+		})
+		clicks.DropOldest(drop)
+		removed += drop
+	}
+	return removed
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPruneClicksBefore(t *testing.T) {
+	resetStore(t)
+	set(t, &rollupInterval, 0)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "old"})
+	now := time.Now()
+	var clicks []Click
+	for _, age := range []time.Duration{3 * time.Hour, 2 * time.Hour, time.Minute} {
+		clicks = append(clicks, Click{Timestamp: now.Add(-age)})
+	}
+	addClicks(t, "old", clicks...)
+
+	if removed := pruneClicksBefore(now.Add(-time.Hour)); removed != 2 {
+		t.Errorf("pruned %d clicks, want 2", removed)
+	}
+	stats := getStats(t, "old")
+	if len(stats.ClickDetails) != 1 || !stats.ClickDetails[0].Timestamp.Equal(now.Add(-time.Minute)) {
+		t.Errorf("kept %+v, want only the recent click", stats.ClickDetails)
+	}
+	if stats.TotalClicks != 3 {
+		t.Errorf("TotalClicks = %d after pruning, want 3", stats.TotalClicks)
+	}
+	if removed := pruneClicksBefore(now.Add(-time.Hour)); removed != 0 {
+		t.Errorf("second prune removed %d clicks", removed)
+	}
+}
+
+func TestRunRetention(t *testing.T) {
+	resetStore(t)
+	set(t, &rollupInterval, 0)
+	set(t, &clickRetention, time.Hour)
+	set(t, &clickRetentionInterval, 5*time.Millisecond)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "old"})
+	addClicks(t, "old", Click{Timestamp: time.Now().Add(-2 * time.Hour)})
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		runRetention(stop)
+		close(done)
+	}()
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if len(getStats(t, "old").ClickDetails) == 0 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Error("retention job never dropped the old click")
+}
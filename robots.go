@@ -0,0 +1,26 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+)
+
+// robotsTxt is served at /robots.txt. It defaults to keeping every crawler
+// away from short links and can be replaced with ROBOTS_TXT_FILE.
+var robotsTxt = []byte("User-agent: *\nDisallow: /\n")
+
+// loadRobotsTxt replaces the robots.txt policy with the file at path
+func loadRobotsTxt(path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("Invalid ROBOTS_TXT_FILE: %v", err)
+	}
+	robotsTxt = data
+}
+
+// serveRobotsTxt serves the crawler policy
+func serveRobotsTxt(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(robotsTxt)
+}
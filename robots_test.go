@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRobotsTxt(t *testing.T) {
+	resetStore(t)
+	rec := do("GET", "/robots.txt", "")
+	wantStatus(t, rec, http.StatusOK)
+	if ct := rec.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if body := rec.Body.String(); body != "User-agent: *\nDisallow: /\n" {
+		t.Errorf("body = %q, want every crawler disallowed", body)
+	}
+	// The redirect handler never saw the request
+	if rates := redirectRates.top(10, time.Now()); len(rates) != 0 {
+		t.Errorf("robots.txt looked up as a shortcode: %+v", rates)
+	}
+	wantStatus(t, do("POST", "/shorturls", `{"url": "https://example.com", "shortcode": "robots.txt"}`), http.StatusBadRequest)
+}
+
+func TestRobotsTxtFile(t *testing.T) {
+	resetStore(t)
+	set(t, &robotsTxt, robotsTxt)
+	path := filepath.Join(t.TempDir(), "robots.txt")
+	policy := "User-agent: *\nAllow: /\n"
+	if err := os.WriteFile(path, []byte(policy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	loadRobotsTxt(path)
+
+	if body := do("GET", "/robots.txt", "").Body.String(); body != policy {
+		t.Errorf("body = %q, want %q", body, policy)
+	}
+}
+
+func TestRobotsTxtIgnoresRoutePrefix(t *testing.T) {
+	resetStore(t)
+	set(t, &routePrefix, "/s")
+	wantStatus(t, do("GET", "/robots.txt", ""), http.StatusOK)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// rollupInterval is how often completed days of clicks are rolled up, from
+// ROLLUP_INTERVAL; 0 turns rollups off
+var rollupInterval = time.Hour
+
+// rollupDateLayout formats DailyStat dates, which are UTC days
+const rollupDateLayout = "2006-01-02"
+
+// DailyStat summarizes one UTC day of a link's recorded clicks, so totals
+// survive after CLICK_RETENTION drops the clicks themselves. Days are only
+// rolled up once over, so a retention under a day loses some clicks.
+type DailyStat struct {
+	Date string `json:"date"`
+	// Count is the number of clicks; UniqueCount counts distinct addresses
+	Count       int `json:"count"`
+	UniqueCount int `json:"uniqueCount"`
+	// ByCountry counts clicks per GeoIP country, with "unknown" for clicks
+	// without one
+	ByCountry map[string]int `json:"byCountry"`
+}
+
+// rollups holds each link's daily stats in date order, guarded by storeLock
+var rollups = make(map[string][]DailyStat)
+
+// runRollups rolls up the previous days' clicks periodically until stop is
+// closed
+func runRollups(stop <-chan struct{}) {
+	ticker := time.NewTicker(rollupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			if days := rollupClicks(now); days > 0 {
+				log.Printf("Rolled up %d days of clicks", days)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// rollupClicks rolls up every link's clicks from the days before the UTC day
+// of now, returning the number of days added
+func rollupClicks(now time.Time) int {
+	storeLock.Lock()
+	defer storeLock.Unlock()
+	days := 0
+	for code, clicks := range analytics {
+		days += rollupLinkClicks(code, clicks, now)
+	}
+	return days
+}
+
+// rollupLinkClicks adds daily stats for the clicks of code from the days
+// after its last rollup and before the UTC day of before. Days with no
+// clicks get no entry. The caller must hold storeLock for writing.
+func rollupLinkClicks(code string, clicks *clickLog, before time.Time) int {
+	end := before.UTC().Format(rollupDateLayout)
+	last := ""
+	if existing := rollups[code]; len(existing) > 0 {
+		last = existing[len(existing)-1].Date
+	}
+
+	days := 0
+	var day *DailyStat
+	var seen map[string]bool
+	for i := 0; i < clicks.Len(); i++ {
+		click := clicks.At(i)
+		date := click.Timestamp.UTC().Format(rollupDateLayout)
+		if date <= last {
+			continue
+		}
+		if date >= end {
+			break
+		}
+		if day == nil || day.Date != date {
+			rollups[code] = append(rollups[code], DailyStat{Date: date, ByCountry: map[string]int{}})
+			day = &rollups[code][len(rollups[code])-1]
+			seen = make(map[string]bool)
+			days++
+		}
+		day.Count++
+		if !seen[click.IPAddress] {
+			seen[click.IPAddress] = true
+			day.UniqueCount++
+		}
+		country := click.Country
+		if country == "" {
+			country = "unknown"
+		}
+		day.ByCountry[country]++
+	}
+	return days
+}
+
+type RollupsResponse struct {
+	ShortCode string      `json:"shortCode"`
+	Total     int         `json:"total"`
+	Days      []DailyStat `json:"days"`
+}
+
+// getRollups returns the daily stats of a shortcode, oldest first
+func getRollups(w http.ResponseWriter, r *http.Request) {
+	shortCode := mux.Vars(r)["shortcode"]
+
+	storeLock.RLock()
+	_, exists := urlStore[shortCode]
+	response := RollupsResponse{ShortCode: shortCode, Days: append([]DailyStat{}, rollups[shortCode]...)}
+	storeLock.RUnlock()
+
+	if !exists {
+		jsonError(w, `{"error": "Short URL not found"}`, http.StatusNotFound)
+		return
+	}
+	for _, day := range response.Days {
+		response.Total += day.Count
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	newJSONEncoder(w, r).Encode(response)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRollupClicks(t *testing.T) {
+	resetStore(t)
+	set(t, &adminEnabled, true)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "daily"})
+	wantStatus(t, do("POST", "/shorturls/daily/clicks/import", `[
+		{"timestamp": "2024-01-01T08:00:00Z", "ipAddress": "192.0.2.1", "country": "GB"},
+		{"timestamp": "2024-01-01T09:00:00Z", "ipAddress": "192.0.2.1", "country": "GB"},
+		{"timestamp": "2024-01-01T23:59:59Z", "ipAddress": "192.0.2.2"},
+		{"timestamp": "2024-01-03T00:00:00Z", "ipAddress": "192.0.2.3", "country": "FR"},
+		{"timestamp": "2024-01-04T12:00:00Z", "ipAddress": "192.0.2.3", "country": "FR"}
+	]`), http.StatusOK)
+
+	// The day of the cutoff is still in progress and is left for later
+	cutoff := time.Date(2024, 1, 4, 18, 0, 0, 0, time.UTC)
+	if days := rollupClicks(cutoff); days != 2 {
+		t.Errorf("rolled up %d days, want 2", days)
+	}
+	want := []DailyStat{
+		{Date: "2024-01-01", Count: 3, UniqueCount: 2, ByCountry: map[string]int{"GB": 2, "unknown": 1}},
+		{Date: "2024-01-03", Count: 1, UniqueCount: 1, ByCountry: map[string]int{"FR": 1}},
+	}
+	if !reflect.DeepEqual(rollups["daily"], want) {
+		t.Errorf("rollups = %+v, want %+v", rollups["daily"], want)
+	}
+	if days := rollupClicks(cutoff); days != 0 {
+		t.Errorf("rolling up again added %d days", days)
+	}
+
+	// Later runs pick up where the last one stopped
+	if days := rollupClicks(cutoff.Add(24 * time.Hour)); days != 1 || len(rollups["daily"]) != 3 {
+		t.Errorf("next day rolled up %d days, %+v", days, rollups["daily"])
+	}
+}
+
+func TestRollupsOutliveRetention(t *testing.T) {
+	resetStore(t)
+	set(t, &adminEnabled, true)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "daily"})
+	wantStatus(t, do("POST", "/shorturls/daily/clicks/import", `[
+		{"timestamp": "2024-01-01T08:00:00Z", "ipAddress": "192.0.2.1"},
+		{"timestamp": "2024-01-02T08:00:00Z", "ipAddress": "192.0.2.1"},
+		{"timestamp": "2024-01-02T09:00:00Z", "ipAddress": "192.0.2.2"}
+	]`), http.StatusOK)
+	rollupClicks(time.Now())
+	pruneClicksBefore(time.Now())
+
+	rec := do("GET", "/shorturls/daily/rollups", "")
+	wantStatus(t, rec, http.StatusOK)
+	var response RollupsResponse
+	decode(t, rec, &response)
+	if response.ShortCode != "daily" || response.Total != 3 || len(response.Days) != 2 {
+		t.Errorf("rollups = %+v", response)
+	}
+	if stats, _ := GetStats("daily", clickPage{limit: 10}); len(stats.ClickDetails) != 0 {
+		t.Errorf("%d clicks left after pruning", len(stats.ClickDetails))
+	}
+
+	wantStatus(t, do("GET", "/shorturls/missing/rollups", ""), http.StatusNotFound)
+}
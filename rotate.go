@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+type RotateRequest struct {
+	// KeepTombstone makes the old code redirect to the new one instead of 404ing
+	KeepTombstone bool `json:"keepTombstone"`
+}
+
+type RotateResponse struct {
+	OldShortCode string `json:"oldShortCode"`
+	ShortCode    string `json:"shortCode"`
+	ShortLink    string `json:"shortLink"`
+}
+
+// codeClaimed reports whether code is taken for custom shortcodes: in use,
+// or rotated out and kept from coming back. The caller must hold storeLock.
+func codeClaimed(code string) bool {
+	_, exists := urlStore[code]
+	_, rotated := tombstones[code]
+	return exists || rotated || retiredCodes[code]
+}
+
+// rotateShortCode moves a link and its analytics to a freshly generated code.
+// A tenant's links may only be rotated with that tenant's API key.
+func rotateShortCode(w http.ResponseWriter, r *http.Request) {
+	oldCode := mux.Vars(r)["shortcode"]
+	tenant, ok := requestTenant(r)
+	if !ok {
+		jsonError(w, `{"error": "Invalid API key"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var req RotateRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+			return
+		}
+	}
+
+	storeLock.Lock()
+	url, exists := urlStore[oldCode]
+	if !exists {
+		storeLock.Unlock()
+		jsonError(w, `{"error": "Short URL not found"}`, http.StatusNotFound)
+		return
+	}
+	if url.Tenant != "" && url.Tenant != tenant {
+		storeLock.Unlock()
+		jsonError(w, `{"error": "Short URL belongs to another tenant"}`, http.StatusForbidden)
+		return
+	}
+	newCode := uniqueShortCode(codePrefix(url.Tenant), url.OriginalURL)
+	url.ShortCode = newCode
+	urlStore[newCode] = url
+	analytics[newCode] = analytics[oldCode]
+	if count, ok := clickCounts[oldCode]; ok {
+		clickCounts[newCode] = count
+	}
+	if count, ok := botClickCounts[oldCode]; ok {
+		botClickCounts[newCode] = count
+	}
+	if days, ok := rollups[oldCode]; ok {
+		rollups[newCode] = days
+	}
+	delete(urlStore, oldCode)
+	delete(analytics, oldCode)
+	delete(clickCounts, oldCode)
+	delete(botClickCounts, oldCode)
+	delete(rollups, oldCode)
+	// Tombstones pointing at the old code now point at its replacement
+	for code, target := range tombstones {
+		if target == oldCode {
+			tombstones[code] = newCode
+		}
+	}
+	if req.KeepTombstone {
+		tombstones[oldCode] = newCode
+	} else {
+		retiredCodes[oldCode] = true
+	}
+	storeLock.Unlock()
+	redirectCache.Remove(oldCode)
+
+	response := RotateResponse{
+		OldShortCode: oldCode,
+		ShortCode:    newCode,
+		ShortLink:    fmt.Sprintf("%s/%s", baseURL(r), newCode),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	newJSONEncoder(w, r).Encode(response)
+}
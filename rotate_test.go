@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+// rotate rotates code through the API and returns the response
+func rotate(t *testing.T, code, body string) RotateResponse {
+	t.Helper()
+	rec := do("POST", "/shorturls/"+code+"/rotate", body)
+	wantStatus(t, rec, http.StatusOK)
+	var response RotateResponse
+	decode(t, rec, &response)
+	return response
+}
+
+func TestRotateKeepsAnalytics(t *testing.T) {
+	resetStore(t)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "old"})
+	wantStatus(t, do("GET", "/old", ""), http.StatusFound)
+
+	response := rotate(t, "old", "")
+	if response.OldShortCode != "old" || response.ShortCode == "" || response.ShortCode == "old" {
+		t.Fatalf("response = %+v", response)
+	}
+	if response.ShortLink != "http://"+testHost+"/"+response.ShortCode {
+		t.Errorf("shortLink = %q", response.ShortLink)
+	}
+
+	stats := getStats(t, response.ShortCode)
+	if stats.TotalClicks != 1 || len(stats.ClickDetails) != 1 {
+		t.Errorf("rotated link has %d clicks, want the original 1", stats.TotalClicks)
+	}
+	wantStatus(t, do("GET", "/old", ""), http.StatusNotFound)
+}
+
+func TestRotateWithTombstone(t *testing.T) {
+	resetStore(t)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "old"})
+	first := rotate(t, "old", `{"keepTombstone": true}`)
+
+	rec := do("GET", "/old", "")
+	wantStatus(t, rec, http.StatusMovedPermanently)
+	if got := rec.Header().Get("Location"); got != "http://"+testHost+"/"+first.ShortCode {
+		t.Errorf("Location = %q", got)
+	}
+
+	// Rotating again repoints the first tombstone at the newest code
+	second := rotate(t, first.ShortCode, `{"keepTombstone": true}`)
+	rec = do("GET", "/old", "")
+	wantStatus(t, rec, http.StatusMovedPermanently)
+	if got := rec.Header().Get("Location"); got != "http://"+testHost+"/"+second.ShortCode {
+		t.Errorf("Location after second rotation = %q, want the newest code", got)
+	}
+}
+
+func TestRotateErrors(t *testing.T) {
+	resetStore(t)
+	wantStatus(t, do("POST", "/shorturls/missing/rotate", ""), http.StatusNotFound)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "old"})
+	wantStatus(t, do("POST", "/shorturls/old/rotate", "{"), http.StatusBadRequest)
+}
+
+func TestRotatedCodesStayClaimed(t *testing.T) {
+	resetStore(t)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "kept"})
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "gone"})
+	rotate(t, "kept", `{"keepTombstone": true}`)
+	rotate(t, "gone", "")
+
+	// A tombstoned code still redirects to its replacement, and a retired
+	// one must never point anywhere else
+	for _, code := range []string{"kept", "gone"} {
+		_, _, err := CreateURL(ShortURLRequest{URL: "https://example.org", Shortcode: code}, testHost)
+		if !errors.Is(err, ErrShortcodeTaken) {
+			t.Errorf("claiming rotated-out %q: err = %v, want ErrShortcodeTaken", code, err)
+		}
+		var availability AvailabilityResponse
+		decode(t, do("GET", "/shorturls/"+code+"/available", ""), &availability)
+		if availability.Available {
+			t.Errorf("rotated-out %q reported available", code)
+		}
+	}
+}
+
+func TestRotateOtherTenantsLink(t *testing.T) {
+	resetStore(t)
+	useTenants(t)
+	code := createdCode(t, createAs(t, "key-one", `{"url": "https://example.com"}`))
+
+	rotateAs := func(apiKey string) int {
+		r := request("POST", "/shorturls/"+code+"/rotate", "")
+		if apiKey != "" {
+			r.Header.Set("X-API-Key", apiKey)
+		}
+		return serve(r).Code
+	}
+	for apiKey, want := range map[string]int{
+		"":        http.StatusForbidden,
+		"key-two": http.StatusForbidden,
+		"bogus":   http.StatusUnauthorized,
+	} {
+		if got := rotateAs(apiKey); got != want {
+			t.Errorf("rotating with key %q: status %d, want %d", apiKey, got, want)
+		}
+	}
+	if got := rotateAs("key-one"); got != http.StatusOK {
+		t.Errorf("owner rotating: status %d", got)
+	}
+}
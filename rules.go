@@ -0,0 +1,38 @@
+package main
+
+import "strings"
+
+// UserAgentRule sends visitors whose User-Agent contains Pattern (ignoring
+// case) to URL, e.g. {"pattern": "Android", "url": "https://play.google.com/..."}
+type UserAgentRule struct {
+	Pattern string `json:"pattern"`
+	URL     string `json:"url"`
+}
+
+// matchUserAgentRule returns the first rule matching userAgent
+func matchUserAgentRule(rules []UserAgentRule, userAgent string) (UserAgentRule, bool) {
+	userAgent = strings.ToLower(userAgent)
+	for _, rule := range rules {
+		if strings.Contains(userAgent, strings.ToLower(rule.Pattern)) {
+			return rule, true
+		}
+	}
+	return UserAgentRule{}, false
+}
+
+// normalizeCountryRules upper-cases the country codes of rules, reporting
+// false if any key is not a two-letter ISO code
+func normalizeCountryRules(rules map[string]string) (map[string]string, bool) {
+	if len(rules) == 0 {
+		return nil, true
+	}
+	normalized := make(map[string]string, len(rules))
+	for country, dest := range rules {
+		country = strings.ToUpper(strings.TrimSpace(country))
+		if len(country) != 2 || country[0] < 'A' || country[0] > 'Z' || country[1] < 'A' || country[1] > 'Z' {
+			return nil, false
+		}
+		normalized[country] = dest
+	}
+	return normalized, true
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+const (
+	androidUserAgent = "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 Chrome/126.0 Mobile Safari/537.36"
+	iphoneUserAgent  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 Mobile/15E148"
+)
+
+func TestUserAgentRules(t *testing.T) {
+	resetStore(t)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com/web", Shortcode: "app", UserAgentRules: []UserAgentRule{
+		{Pattern: "android", URL: "https://play.example.com/app"},
+		{Pattern: "iPhone", URL: "https://apps.example.com/app"},
+	}})
+
+	tests := []struct {
+		userAgent string
+		want      string
+	}{
+		{androidUserAgent, "https://play.example.com/app"},
+		{iphoneUserAgent, "https://apps.example.com/app"},
+		{browserUserAgent, "https://example.com/web"},
+	}
+	for _, tt := range tests {
+		r := request("GET", "/app", "")
+		r.Header.Set("User-Agent", tt.userAgent)
+		rec := serve(r)
+		wantStatus(t, rec, http.StatusFound)
+		if got := rec.Header().Get("Location"); got != tt.want {
+			t.Errorf("%s redirected to %s, want %s", tt.userAgent, got, tt.want)
+		}
+	}
+
+	stats := getStats(t, "app?sort=asc")
+	var matched []string
+	for _, click := range stats.ClickDetails {
+		matched = append(matched, click.MatchedRule)
+	}
+	if len(matched) != 3 || matched[0] != "android" || matched[1] != "iPhone" || matched[2] != "" {
+		t.Errorf("matched rules = %q", matched)
+	}
+}
+
+func TestUserAgentRulesValidation(t *testing.T) {
+	resetStore(t)
+	for _, rules := range []string{
+		`[{"pattern": "", "url": "https://example.com"}]`,
+		`[{"pattern": "Android", "url": "ftp://example.com"}]`,
+		`[{"pattern": "Android", "url": "http://short.test/abc"}]`,
+	} {
+		wantStatus(t, do("POST", "/shorturls", `{"url": "https://example.com", "userAgentRules": `+rules+`}`), http.StatusBadRequest)
+	}
+}
+
+func TestCountryRules(t *testing.T) {
+	resetStore(t)
+	useGeoDB(t, "GeoIP2-City")
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "geo",
+		CountryRules: map[string]string{"gb": "https://example.co.uk", "FR": "https://example.fr"}})
+
+	tests := []struct {
+		addr    string
+		want    string
+		country string
+	}{
+		{"81.2.69.142:1000", "https://example.co.uk", "GB"},
+		{"203.0.113.7:1000", "https://example.com", ""},
+	}
+	for _, tt := range tests {
+		r := request("GET", "/geo", "")
+		r.RemoteAddr = tt.addr
+		rec := serve(r)
+		wantStatus(t, rec, http.StatusFound)
+		if got := rec.Header().Get("Location"); got != tt.want {
+			t.Errorf("%s redirected to %s, want %s", tt.addr, got, tt.want)
+		}
+	}
+
+	stats := getStats(t, "geo?sort=asc")
+	if len(stats.ClickDetails) != 2 {
+		t.Fatalf("%d clicks recorded, want 2", len(stats.ClickDetails))
+	}
+	for i, click := range stats.ClickDetails {
+		if click.MatchedCountry != tests[i].country {
+			t.Errorf("click %d matched country %q, want %q", i, click.MatchedCountry, tests[i].country)
+		}
+	}
+}
+
+func TestCountryRulesLoseToUserAgentRules(t *testing.T) {
+	resetStore(t)
+	useGeoDB(t, "GeoIP2-City")
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "both",
+		CountryRules:   map[string]string{"GB": "https://example.co.uk"},
+		UserAgentRules: []UserAgentRule{{Pattern: "Android", URL: "https://play.example.com/app"}}})
+
+	r := request("GET", "/both", "")
+	r.RemoteAddr = "81.2.69.142:1000"
+	r.Header.Set("User-Agent", androidUserAgent)
+	rec := serve(r)
+	if got := rec.Header().Get("Location"); got != "https://play.example.com/app" {
+		t.Errorf("redirected to %s, want the user agent rule", got)
+	}
+}
+
+func TestNormalizeCountryRules(t *testing.T) {
+	rules, ok := normalizeCountryRules(map[string]string{" gb ": "https://example.co.uk"})
+	if !ok || rules["GB"] != "https://example.co.uk" || len(rules) != 1 {
+		t.Errorf("normalized to %v, %v", rules, ok)
+	}
+	for _, country := range []string{"GBR", "G", "1A", ""} {
+		if _, ok := normalizeCountryRules(map[string]string{country: "https://example.com"}); ok {
+			t.Errorf("country %q accepted", country)
+		}
+	}
+	if rules, ok := normalizeCountryRules(nil); !ok || rules != nil {
+		t.Errorf("no rules gives %v, %v", rules, ok)
+	}
+}
@@ -0,0 +1,508 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Errors returned by the service layer. writeServiceError turns them into
+// HTTP responses, so the functions below never touch a ResponseWriter.
+var (
+	ErrNotFound       = errors.New("Short URL not found")
+	ErrDeactivated    = errors.New("Short URL has been deactivated")
+	ErrExpired        = errors.New("Short URL has expired")
+	ErrShortcodeTaken = errors.New("Shortcode already in use")
+	ErrStoreFull      = errors.New("URL store is full")
+)
+
+// ValidationError rejects a request as malformed
+type ValidationError struct {
+	Message string
+}
+
+func (e *ValidationError) Error() string { return e.Message }
+
+func invalid(message string) error { return &ValidationError{Message: message} }
+
+// RotatedError reports a code that was rotated out, leaving a tombstone
+// pointing at NewCode
+type RotatedError struct {
+	NewCode string
+}
+
+func (e *RotatedError) Error() string { return "Short URL moved to " + e.NewCode }
+
+// writeServiceError maps a service error to its HTTP response
+func writeServiceError(w http.ResponseWriter, r *http.Request, err error) {
+	var rotated *RotatedError
+	if errors.As(err, &rotated) {
+		http.Redirect(w, r, baseURL(r)+"/"+rotated.NewCode, http.StatusMovedPermanently)
+		return
+	}
+	if errors.Is(err, ErrExpired) {
+		writeExpired(w, r)
+		return
+	}
+
+	status, code := errorStatus(err)
+	encoded, _ := json.Marshal(struct {
+		Error string `json:"error"`
+		Code  string `json:"code,omitempty"`
+	}{err.Error(), code})
+	jsonError(w, string(encoded), status)
+}
+
+// errorStatus returns the HTTP status of a service error, along with the short
+// code for errors a client may want to tell apart
+func errorStatus(err error) (int, string) {
+	var rotated *RotatedError
+	var validation *ValidationError
+	var legal *LegalBlockError
+	switch {
+	case errors.As(err, &rotated):
+		return http.StatusMovedPermanently, "rotated"
+	case errors.Is(err, ErrExpired):
+		return http.StatusGone, "expired"
+	case errors.As(err, &validation):
+		return http.StatusBadRequest, ""
+	case errors.As(err, &legal):
+		return http.StatusUnavailableForLegalReasons, "legal_block"
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound, "not_found"
+	case errors.Is(err, ErrDeactivated):
+		return http.StatusForbidden, "deactivated"
+	case errors.Is(err, ErrShortcodeTaken):
+		return http.StatusConflict, ""
+	case errors.Is(err, ErrStoreFull):
+		return http.StatusInsufficientStorage, ""
+	}
+	return http.StatusInternalServerError, ""
+}
+
+// prepareURL validates req and builds the link it describes, without storing
+// it. host is the Host the request arrived on, used to spot links that point
+// back at this service.
+func prepareURL(req ShortURLRequest, host string) (ShortURL, error) {
+	// Weighted destinations go through the same link group validation as urls
+	var weights []int
+	if len(req.Destinations) > 0 {
+		if len(req.URLs) > 0 {
+			return ShortURL{}, invalid("Use either urls or destinations, not both")
+		}
+		for _, dest := range req.Destinations {
+			if dest.Weight <= 0 {
+				return ShortURL{}, invalid("Destination weights must be positive")
+			}
+			req.URLs = append(req.URLs, dest.URL)
+			weights = append(weights, dest.Weight)
+		}
+	}
+
+	// A link group is stored with its first destination as the original URL
+	req.URL = strings.TrimSpace(req.URL)
+	if req.URL == "" && len(req.URLs) > 0 {
+		req.URL = strings.TrimSpace(req.URLs[0])
+	}
+	if req.URL == "" {
+		return ShortURL{}, invalid("url is required")
+	}
+	req.URL = withDefaultScheme(req.URL)
+	for i, dest := range req.URLs {
+		req.URLs[i] = withDefaultScheme(strings.TrimSpace(dest))
+	}
+
+	// Validate URL
+	if err := checkScheme(req.URL); err != nil {
+		return ShortURL{}, err
+	}
+	for _, dest := range req.URLs {
+		if err := checkScheme(dest); err != nil {
+			return ShortURL{}, err
+		}
+	}
+	if resolveNestedLinks {
+		req.URL = resolveNested(req.URL, host)
+		for i, dest := range req.URLs {
+			req.URLs[i] = resolveNested(dest, host)
+		}
+	}
+	for _, rule := range req.UserAgentRules {
+		if rule.Pattern == "" {
+			return ShortURL{}, invalid("User agent rules need a pattern")
+		}
+		if err := checkScheme(rule.URL); err != nil {
+			return ShortURL{}, err
+		}
+		if isSelfReferencing(rule.URL, host) {
+			return ShortURL{}, invalid("URL must not point back at this service")
+		}
+		if isBlockedShortener(rule.URL) {
+			return ShortURL{}, invalid("URL must not point at another link shortener")
+		}
+	}
+	countryRules, ok := normalizeCountryRules(req.CountryRules)
+	if !ok {
+		return ShortURL{}, invalid("Country rules need two-letter ISO country codes")
+	}
+	for _, dest := range countryRules {
+		if err := checkScheme(dest); err != nil {
+			return ShortURL{}, err
+		}
+		if isSelfReferencing(dest, host) {
+			return ShortURL{}, invalid("URL must not point back at this service")
+		}
+		if isBlockedShortener(dest) {
+			return ShortURL{}, invalid("URL must not point at another link shortener")
+		}
+	}
+	for _, dest := range append([]string{req.URL}, req.URLs...) {
+		if isSelfReferencing(dest, host) {
+			return ShortURL{}, invalid("URL must not point back at this service")
+		}
+		if isBlockedShortener(dest) {
+			return ShortURL{}, invalid("URL must not point at another link shortener")
+		}
+	}
+
+	if req.RedirectStatus == 0 {
+		req.RedirectStatus = http.StatusFound
+	}
+	if !validRedirectStatus(req.RedirectStatus) {
+		return ShortURL{}, invalid("redirectStatus must be one of 301, 302, 307 or 308")
+	}
+
+	if req.RedirectMode != "" && !validRedirectMode(req.RedirectMode) {
+		return ShortURL{}, invalid("redirectMode must be http or html")
+	}
+
+	if !validMetadata(req.Metadata) {
+		return ShortURL{}, invalid("metadata exceeds the size limits")
+	}
+
+	if req.AutoDeactivateAfter < 0 {
+		return ShortURL{}, invalid("autoDeactivateAfter must not be negative")
+	}
+
+	if req.InactivityExpiry < 0 {
+		return ShortURL{}, invalid("inactivityExpiry must not be negative")
+	}
+
+	if req.RedirectRateLimit < 0 {
+		return ShortURL{}, invalid("redirectRateLimit must not be negative")
+	}
+
+	if req.ClickSampleRate < 0 || req.ClickSampleRate > 1 {
+		return ShortURL{}, invalid("clickSampleRate must be between 0 and 1")
+	}
+
+	unit, ok := validityUnits[req.ValidityUnit]
+	if !ok {
+		return ShortURL{}, invalid("validityUnit must be one of seconds, minutes, hours or days")
+	}
+
+	// Set default validity if not provided
+	if req.Validity == 0 {
+		req.Validity = 30
+		unit = time.Minute
+	}
+
+	// A validity too large for a Duration would wrap around to a negative
+	// or tiny one
+	if req.Validity < 0 || int64(req.Validity) > math.MaxInt64/int64(unit) {
+		return ShortURL{}, invalid("validity must not be negative or out of range")
+	}
+	validity := time.Duration(req.Validity) * unit
+	if limit := time.Duration(maxValidity.Load()); limit > 0 && validity > limit {
+		return ShortURL{}, invalid("validity exceeds the maximum allowed")
+	}
+
+	if req.Shortcode != "" && isReservedCode(req.Shortcode) {
+		return ShortURL{}, invalid("Shortcode is reserved")
+	}
+	// Custom codes are namespaced like generated ones
+	if req.Shortcode != "" {
+		req.Shortcode = codePrefix(req.Tenant) + req.Shortcode
+		if inOtherNamespace(req.Shortcode, req.Tenant) {
+			return ShortURL{}, invalid("Shortcode is in another tenant's namespace")
+		}
+	}
+
+	newURL := ShortURL{
+		ShortCode:           req.Shortcode,
+		OriginalURL:         req.URL,
+		CreatedAt:           time.Now(),
+		ExpiresAt:           time.Now().Add(validity),
+		IsActive:            true,
+		TrackAnalytics:      req.TrackAnalytics == nil || *req.TrackAnalytics,
+		RedirectStatus:      req.RedirectStatus,
+		Tags:                req.Tags,
+		ClickSampleRate:     req.ClickSampleRate,
+		RedirectMode:        req.RedirectMode,
+		AutoDeactivateAfter: req.AutoDeactivateAfter,
+		Metadata:            req.Metadata,
+		UserAgentRules:      req.UserAgentRules,
+		CountryRules:        countryRules,
+		UTM:                 parseUTM(req.URL),
+		Tenant:              req.Tenant,
+		InactivityExpiry:    req.InactivityExpiry,
+		RedirectRateLimit:   req.RedirectRateLimit,
+		TrackFirstClickOnly: req.TrackFirstClickOnly,
+		Audited:             req.Audited,
+	}
+	for i, dest := range req.URLs {
+		weight := 1
+		if weights != nil {
+			weight = weights[i]
+		}
+		newURL.Destinations = append(newURL.Destinations, Destination{URL: dest, Weight: weight})
+	}
+	return newURL, nil
+}
+
+// CreateURL validates req and stores the link it describes. created is
+// false when an existing live link for the same URL is returned instead:
+// for upserts, or when the deterministic generator already issued one.
+func CreateURL(req ShortURLRequest, host string) (url ShortURL, created bool, err error) {
+	newURL, err := prepareURL(req, host)
+	if err != nil {
+		return ShortURL{}, false, err
+	}
+	// Claim the shortcode and store in memory within a single critical section,
+	// so concurrent requests for the same custom code cannot both succeed
+	storeLock.Lock()
+	if req.Upsert {
+		if existing, ok := liveURLFor(newURL, time.Now()); ok {
+			storeLock.Unlock()
+			return existing, false, nil
+		}
+	}
+	if newURL.ShortCode != "" {
+		if codeClaimed(newURL.ShortCode) {
+			storeLock.Unlock()
+			return ShortURL{}, false, ErrShortcodeTaken
+		}
+	} else if existing, ok := deterministicMatch(codePrefix(newURL.Tenant), newURL.OriginalURL, time.Now()); ok {
+		storeLock.Unlock()
+		return existing, false, nil
+	} else if code, ok := takePooledCode(newURL.Tenant); ok {
+		newURL.ShortCode = code
+	} else {
+		newURL.ShortCode = uniqueShortCode(codePrefix(newURL.Tenant), newURL.OriginalURL)
+	}
+	if storeFull(time.Now()) && !makeRoom(time.Now()) {
+		storeLock.Unlock()
+		return ShortURL{}, false, ErrStoreFull
+	}
+	urlStore[newURL.ShortCode] = newURL
+	analytics[newURL.ShortCode] = &clickLog{}
+	clickCounts[newURL.ShortCode] = new(atomic.Int64)
+	botClickCounts[newURL.ShortCode] = new(atomic.Int64)
+	storeLock.Unlock()
+	redirectCache.Remove(newURL.ShortCode)
+	if fetchFavicon {
+		go storeFavicon(newURL)
+	}
+	return newURL, true, nil
+}
+
+// liveURLFor finds an active, unexpired link of the same tenant to the same
+// normalized URL as url, preferring url's custom code and otherwise the
+// lowest code. The caller must hold storeLock.
+func liveURLFor(url ShortURL, now time.Time) (ShortURL, bool) {
+	want := normalizeURL(url.OriginalURL)
+	live := func(stored ShortURL) bool {
+		return stored.Tenant == url.Tenant && stored.IsActive && now.Before(stored.ExpiresAt) &&
+			normalizeURL(stored.OriginalURL) == want
+	}
+	if stored, ok := urlStore[url.ShortCode]; ok && live(stored) {
+		return stored, true
+	}
+	var found ShortURL
+	ok := false
+	for code, stored := range urlStore {
+		if live(stored) && (!ok || code < found.ShortCode) {
+			found, ok = stored, true
+		}
+	}
+	return found, ok
+}
+
+// Resolve looks up a link that can currently be redirected to
+func Resolve(shortCode string) (ShortURL, error) {
+	url, exists := redirectCache.Get(shortCode)
+	if !exists {
+		// Fill the cache before releasing the lock: writers invalidate after
+		// their update, so they cannot slip in between and leave this copy
+		// cached once it is stale
+		storeLock.RLock()
+		url, exists = urlStore[shortCode]
+		if exists {
+			redirectCache.Add(shortCode, url)
+		}
+		storeLock.RUnlock()
+	}
+
+	if !exists {
+		// A rotated code may have left a tombstone pointing at its replacement
+		storeLock.RLock()
+		newCode, rotated := tombstones[shortCode]
+		storeLock.RUnlock()
+		if rotated {
+			return ShortURL{}, &RotatedError{NewCode: newCode}
+		}
+		return ShortURL{}, ErrNotFound
+	}
+
+	if url.LegalBlocked {
+		return ShortURL{}, &LegalBlockError{Notice: url.LegalNotice}
+	}
+
+	if !url.IsActive {
+		return ShortURL{}, ErrDeactivated
+	}
+
+	now := time.Now()
+	if now.After(url.ExpiresAt) {
+		return ShortURL{}, ErrExpired
+	}
+	// Idle links count as expired until the reaper gets to them. A cached
+	// copy does not see later redirects, so the store has the final say.
+	if idleExpired(url, now) {
+		storeLock.RLock()
+		stored, ok := urlStore[shortCode]
+		storeLock.RUnlock()
+		if !ok || idleExpired(stored, now) {
+			return ShortURL{}, ErrExpired
+		}
+	}
+	return url, nil
+}
+
+// recordRedirect counts a redirect through shortCode at now, storing click
+// if it is non-nil; bot marks redirects made by bots, whether or not their
+// click is kept. Nothing is counted while analytics are paused. It fails
+// with ErrDeactivated when a concurrent redirect used up the last click of an
+// auto-deactivating link.
+func recordRedirect(shortCode string, click *Click, bot bool, now time.Time) error {
+	if recordRedirectShared(shortCode, click, bot, now) {
+		return nil
+	}
+
+	storeLock.Lock()
+	defer storeLock.Unlock()
+	if stored, ok := urlStore[shortCode]; ok {
+		if stored.AutoDeactivateAfter > 0 {
+			// Another redirect may have used up the last click since our lookup
+			if !stored.IsActive {
+				return ErrDeactivated
+			}
+			stored.ClicksSinceActivation++
+			if stored.ClicksSinceActivation >= stored.AutoDeactivateAfter {
+				stored.IsActive = false
+				redirectCache.Remove(shortCode)
+			}
+		}
+		stored.LastAccessedAt = now
+		if stored.FirstClickAt.IsZero() && !analyticsPaused.Load() {
+			stored.FirstClickAt = now
+		}
+		urlStore[shortCode] = stored
+	}
+	if analyticsPaused.Load() {
+		return nil
+	}
+	if clickBatch != nil {
+		clickBatch.add(shortCode, click, bot)
+		return nil
+	}
+	storeClick(shortCode, click, bot)
+	return nil
+}
+
+// lastAccessResolution is how stale LastAccessedAt may get before a
+// redirect refreshes it. Refreshing rewrites the record under the write
+// lock, so hot links only pay for it once per interval.
+const lastAccessResolution = time.Second
+
+// recordRedirectShared records a redirect holding storeLock only for
+// reading, which is enough when the record itself needs no change: the
+// counters are atomic and the click log has its own lock. It reports false,
+// recording nothing, when recordRedirect must take the write lock instead.
+func recordRedirectShared(shortCode string, click *Click, bot bool, now time.Time) bool {
+	storeLock.RLock()
+	defer storeLock.RUnlock()
+	stored, ok := urlStore[shortCode]
+	if !ok || stored.AutoDeactivateAfter > 0 {
+		return false
+	}
+	if since := now.Sub(stored.LastAccessedAt); since < 0 || since >= lastAccessResolution {
+		return false
+	}
+	paused := analyticsPaused.Load()
+	if paused {
+		return true
+	}
+	if stored.FirstClickAt.IsZero() {
+		return false
+	}
+	if clickBatch != nil {
+		clickBatch.add(shortCode, click, bot)
+		return true
+	}
+	total, bots, clicks := clickCounts[shortCode], botClickCounts[shortCode], analytics[shortCode]
+	if total == nil || (bot && bots == nil) || (click != nil && clicks == nil) {
+		return false
+	}
+	total.Add(1)
+	if bot {
+		bots.Add(1)
+	}
+	if click != nil {
+		logClick(clicks, stored, *click)
+	}
+	return true
+}
+
+// storeClick counts a redirect through shortCode, as a bot's if bot is set,
+// and logs its click, if any. The caller must hold storeLock for writing.
+func storeClick(shortCode string, click *Click, bot bool) {
+	countClicks(shortCode, 1)
+	if bot {
+		countBots(shortCode, 1)
+	}
+	if click != nil {
+		if analytics[shortCode] == nil {
+			analytics[shortCode] = &clickLog{}
+		}
+		logClick(analytics[shortCode], urlStore[shortCode], *click)
+	}
+}
+
+// logClick adds click to the log of url, unless the link only keeps a
+// click it already has
+func logClick(clicks *clickLog, url ShortURL, click Click) {
+	if url.TrackFirstClickOnly {
+		clicks.PushIfEmpty(click)
+		return
+	}
+	clicks.Push(click)
+}
+
+// GetStats computes the stats of shortCode with click details limited to page
+func GetStats(shortCode string, page clickPage) (URLStats, error) {
+	storeLock.RLock()
+	url, exists := urlStore[shortCode]
+	clicks := analytics[shortCode].Slice()
+	total, bots := clickTotal(shortCode), botTotal(shortCode)
+	storeLock.RUnlock()
+
+	if !exists {
+		return URLStats{}, ErrNotFound
+	}
+	return buildURLStats(url, clicks, total, bots, page), nil
+}
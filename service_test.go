@@ -0,0 +1,279 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCreateURLThenResolve(t *testing.T) {
+	resetStore(t)
+	url := mustCreate(t, ShortURLRequest{URL: "https://example.com/page"})
+	if url.ShortCode == "" {
+		t.Fatal("no shortcode generated")
+	}
+	if !url.IsActive || !url.TrackAnalytics || url.RedirectStatus != http.StatusFound {
+		t.Errorf("unexpected defaults: %+v", url)
+	}
+	if got := url.ExpiresAt.Sub(url.CreatedAt).Round(time.Second); got != 30*time.Minute {
+		t.Errorf("default validity = %v, want 30m", got)
+	}
+
+	resolved, err := Resolve(url.ShortCode)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if resolved.OriginalURL != "https://example.com/page" {
+		t.Errorf("OriginalURL = %q", resolved.OriginalURL)
+	}
+}
+
+func TestCreateURLErrors(t *testing.T) {
+	resetStore(t)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "taken"})
+
+	tests := []struct {
+		name string
+		req  ShortURLRequest
+		want error
+	}{
+		{"missing url", ShortURLRequest{}, &ValidationError{}},
+		{"bad redirect status", ShortURLRequest{URL: "https://example.com", RedirectStatus: 303}, &ValidationError{}},
+		{"self link", ShortURLRequest{URL: "http://" + testHost + "/abc"}, &ValidationError{}},
+		{"taken code", ShortURLRequest{URL: "https://example.org", Shortcode: "taken"}, ErrShortcodeTaken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := CreateURL(tt.req, testHost)
+			var validation *ValidationError
+			if _, ok := tt.want.(*ValidationError); ok {
+				if !errors.As(err, &validation) {
+					t.Fatalf("err = %v, want a ValidationError", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateURLConcurrentCustomCode(t *testing.T) {
+	resetStore(t)
+	const workers = 50
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	created, taken := 0, 0
+	start := make(chan struct{})
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			_, _, err := CreateURL(ShortURLRequest{URL: fmt.Sprintf("https://example.com/%d", i), Shortcode: "race"}, testHost)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				created++
+			case errors.Is(err, ErrShortcodeTaken):
+				taken++
+			default:
+				t.Errorf("CreateURL: %v", err)
+			}
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	if created != 1 || taken != workers-1 {
+		t.Errorf("%d created and %d taken, want 1 and %d", created, taken, workers-1)
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	resetStore(t)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "off"})
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "old"})
+	storeLock.Lock()
+	off := urlStore["off"]
+	off.IsActive = false
+	urlStore["off"] = off
+	old := urlStore["old"]
+	old.ExpiresAt = time.Now().Add(-time.Second)
+	urlStore["old"] = old
+	tombstones["moved"] = "old"
+	storeLock.Unlock()
+
+	if _, err := Resolve("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing: err = %v, want ErrNotFound", err)
+	}
+	if _, err := Resolve("off"); !errors.Is(err, ErrDeactivated) {
+		t.Errorf("off: err = %v, want ErrDeactivated", err)
+	}
+	if _, err := Resolve("old"); !errors.Is(err, ErrExpired) {
+		t.Errorf("old: err = %v, want ErrExpired", err)
+	}
+	var rotated *RotatedError
+	if _, err := Resolve("moved"); !errors.As(err, &rotated) || rotated.NewCode != "old" {
+		t.Errorf("moved: err = %v, want a RotatedError to old", err)
+	}
+}
+
+func TestRecordRedirectConcurrent(t *testing.T) {
+	resetStore(t)
+	url := mustCreate(t, ShortURLRequest{URL: "https://example.com"})
+	once := mustCreate(t, ShortURLRequest{URL: "https://example.com/once", TrackFirstClickOnly: true})
+
+	// Most of these take the shared path; none may be lost or doubled
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(bot bool) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				recordRedirect(url.ShortCode, &Click{Timestamp: time.Now(), IsBot: bot}, bot, time.Now())
+				recordRedirect(once.ShortCode, &Click{Timestamp: time.Now()}, false, time.Now())
+			}
+		}(i%2 == 0)
+	}
+	wg.Wait()
+
+	stats, _ := GetStats(url.ShortCode, clickPage{limit: 2000})
+	if stats.HumanClicks != 500 || stats.BotClicks != 500 || len(stats.ClickDetails) != 1000 {
+		t.Errorf("human %d, bot %d, %d details; want 500, 500, 1000", stats.HumanClicks, stats.BotClicks, len(stats.ClickDetails))
+	}
+	stats, _ = GetStats(once.ShortCode, clickPage{limit: 2000})
+	if stats.TotalClicks != 1000 || len(stats.ClickDetails) != 1 {
+		t.Errorf("first click only: %d clicks with %d details, want 1000 with 1", stats.TotalClicks, len(stats.ClickDetails))
+	}
+}
+
+func TestRecordRedirectRefreshesLastAccess(t *testing.T) {
+	resetStore(t)
+	url := mustCreate(t, ShortURLRequest{URL: "https://example.com"})
+	lastAccess := func() time.Time {
+		storeLock.RLock()
+		defer storeLock.RUnlock()
+		return urlStore[url.ShortCode].LastAccessedAt
+	}
+
+	start := time.Now()
+	recordRedirect(url.ShortCode, nil, false, start)
+	if !lastAccess().Equal(start) {
+		t.Fatalf("lastAccessedAt = %v after the first redirect, want %v", lastAccess(), start)
+	}
+	// Within the resolution the record is left alone
+	recordRedirect(url.ShortCode, nil, false, start.Add(lastAccessResolution/2))
+	if !lastAccess().Equal(start) {
+		t.Errorf("lastAccessedAt moved to %v within the resolution", lastAccess())
+	}
+	later := start.Add(2 * lastAccessResolution)
+	recordRedirect(url.ShortCode, nil, false, later)
+	if !lastAccess().Equal(later) {
+		t.Errorf("lastAccessedAt = %v, want the stale value refreshed to %v", lastAccess(), later)
+	}
+	if stats, _ := GetStats(url.ShortCode, clickPage{}); stats.TotalClicks != 3 {
+		t.Errorf("TotalClicks = %d, want 3", stats.TotalClicks)
+	}
+}
+
+// BenchmarkRecordRedirectParallel records redirects through one hot code from
+// parallel clients, which mostly share storeLock for reading
+func BenchmarkRecordRedirectParallel(b *testing.B) {
+	resetStore(b)
+	url, _, err := CreateURL(ShortURLRequest{URL: "https://example.com"}, testHost)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			now := time.Now()
+			recordRedirect(url.ShortCode, &Click{Timestamp: now}, false, now)
+		}
+	})
+}
+
+func TestGetStats(t *testing.T) {
+	resetStore(t)
+	url := mustCreate(t, ShortURLRequest{URL: "https://example.com"})
+	for i := 0; i < 3; i++ {
+		click := &Click{Timestamp: time.Now(), UserAgent: "Mozilla/5.0"}
+		if err := recordRedirect(url.ShortCode, click, false, time.Now()); err != nil {
+			t.Fatalf("recordRedirect: %v", err)
+		}
+	}
+
+	stats, err := GetStats(url.ShortCode, clickPage{limit: 100})
+	if err != nil {
+		t.Fatalf("GetStats: %v", err)
+	}
+	if stats.TotalClicks != 3 || len(stats.ClickDetails) != 3 {
+		t.Errorf("TotalClicks = %d with %d details, want 3", stats.TotalClicks, len(stats.ClickDetails))
+	}
+	if _, err := GetStats("missing", clickPage{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{ErrNotFound, http.StatusNotFound, "not_found"},
+		{ErrDeactivated, http.StatusForbidden, "deactivated"},
+		{ErrExpired, http.StatusGone, "expired"},
+		{ErrShortcodeTaken, http.StatusConflict, ""},
+		{ErrStoreFull, http.StatusInsufficientStorage, ""},
+		{invalid("bad"), http.StatusBadRequest, ""},
+		{&RotatedError{NewCode: "new"}, http.StatusMovedPermanently, "rotated"},
+		{&LegalBlockError{}, http.StatusUnavailableForLegalReasons, "legal_block"},
+		{errors.New("boom"), http.StatusInternalServerError, ""},
+	}
+	for _, tt := range tests {
+		status, code := errorStatus(tt.err)
+		if status != tt.wantStatus || code != tt.wantCode {
+			t.Errorf("errorStatus(%v) = %d, %q, want %d, %q", tt.err, status, code, tt.wantStatus, tt.wantCode)
+		}
+	}
+}
+
+func TestServiceErrorResponses(t *testing.T) {
+	resetStore(t)
+	rec := do("GET", "/missing", "")
+	wantStatus(t, rec, http.StatusNotFound)
+	var body struct {
+		Error string `json:"error"`
+		Code  string `json:"code"`
+	}
+	decode(t, rec, &body)
+	if body.Error != ErrNotFound.Error() || body.Code != "not_found" {
+		t.Errorf("body = %+v", body)
+	}
+
+	rec = do("POST", "/shorturls", `{"url": ""}`)
+	wantStatus(t, rec, http.StatusBadRequest)
+}
+
+func TestCreateRequiresURL(t *testing.T) {
+	resetStore(t)
+	for _, body := range []string{`{}`, `{"url": ""}`, `{"url": "   "}`, `{"urls": []}`} {
+		rec := do("POST", "/shorturls", body)
+		wantStatus(t, rec, http.StatusBadRequest)
+		var response struct {
+			Error string `json:"error"`
+		}
+		decode(t, rec, &response)
+		if response.Error != "url is required" {
+			t.Errorf("%s: error = %q", body, response.Error)
+		}
+	}
+	wantStatus(t, do("POST", "/shorturls", `not json`), http.StatusBadRequest)
+}
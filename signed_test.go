@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignLinkRoundTrip(t *testing.T) {
+	set(t, &signingSecret, []byte("key"))
+	now := time.Now()
+	token := signLink("https://example.com", now.Add(time.Hour))
+
+	url, err := verifyLink(token, now)
+	if err != nil || url != "https://example.com" {
+		t.Fatalf("verifyLink = %q, %v", url, err)
+	}
+	if _, err := verifyLink(token, now.Add(2*time.Hour)); !errors.Is(err, errTokenExpired) {
+		t.Errorf("expired token: err = %v", err)
+	}
+
+	payload, sig, _ := strings.Cut(token, ".")
+	forged := signLink("https://evil.example", now.Add(time.Hour))
+	forgedPayload, _, _ := strings.Cut(forged, ".")
+	if _, err := verifyLink(forgedPayload+"."+sig, now); !errors.Is(err, errInvalidToken) {
+		t.Errorf("swapped payload: err = %v", err)
+	}
+	set(t, &signingSecret, []byte("other"))
+	if _, err := verifyLink(payload+"."+sig, now); !errors.Is(err, errInvalidToken) {
+		t.Errorf("other secret: err = %v", err)
+	}
+}
+
+func TestSignedLinkEndpoints(t *testing.T) {
+	resetStore(t)
+	set(t, &signingSecret, []byte("key"))
+
+	rec := do("POST", "/shorturls", `{"url": "https://example.com/x", "signed": true}`)
+	wantStatus(t, rec, http.StatusCreated)
+	var response ShortURLResponse
+	decode(t, rec, &response)
+	path := strings.TrimPrefix(response.ShortLink, "http://"+testHost)
+	if !strings.HasPrefix(path, "/s/") {
+		t.Fatalf("shortLink = %q, want a /s/ link", response.ShortLink)
+	}
+	if len(urlStore) != 0 {
+		t.Error("signed link was stored")
+	}
+
+	rec = do("GET", path, "")
+	wantStatus(t, rec, http.StatusFound)
+	if got := rec.Header().Get("Location"); got != "https://example.com/x" {
+		t.Errorf("Location = %q", got)
+	}
+	wantStatus(t, do("GET", path+"x", ""), http.StatusBadRequest)
+}
+
+func TestSignedLinksDisabled(t *testing.T) {
+	resetStore(t)
+	set(t, &signingSecret, nil)
+	wantStatus(t, do("POST", "/shorturls", `{"url": "https://example.com", "signed": true}`), http.StatusBadRequest)
+	wantStatus(t, do("GET", "/s/anything", ""), http.StatusNotFound)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type SummaryStats struct {
+	URLs             int `json:"urls"`
+	ActiveURLs       int `json:"activeUrls"`
+	TotalClicks      int `json:"totalClicks"`
+	RateLimitClients int `json:"rateLimitClients"`
+	// UTM totals clicks per campaign parameter across all links
+	UTM UTMBreakdown `json:"utm"`
+}
+
+// getSummaryStats reports store-wide totals and the size of internal
+// bookkeeping maps
+func getSummaryStats(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	summary := SummaryStats{RateLimitClients: creationLimiter.size(), UTM: newUTMBreakdown()}
+
+	storeLock.RLock()
+	summary.URLs = len(urlStore)
+	for code, url := range urlStore {
+		if url.IsActive && now.Before(url.ExpiresAt) {
+			summary.ActiveURLs++
+		}
+		total := clickTotal(code)
+		summary.TotalClicks += total
+		summary.UTM.add(url, analytics[code].Slice(), total)
+	}
+	storeLock.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	newJSONEncoder(w, r).Encode(summary)
+}
+
+// referrerDomain reduces a referrer URL to its host, reporting empty
+// referrers as "direct" and unparseable ones as "unknown"
+func referrerDomain(referrer string) string {
+	if referrer == "" {
+		return "direct"
+	}
+	u, err := url.Parse(referrer)
+	if err != nil || u.Hostname() == "" {
+		return "unknown"
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// clicksByReferrerDomain counts clicks per referring domain
+func clicksByReferrerDomain(clicks []Click) map[string]int {
+	counts := make(map[string]int)
+	for _, click := range clicks {
+		counts[referrerDomain(click.Referrer)]++
+	}
+	return counts
+}
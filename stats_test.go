@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReferrerDomain(t *testing.T) {
+	tests := map[string]string{
+		"":                               "direct",
+		"https://WWW.Example.com/a?b=c":  "www.example.com",
+		"http://news.example.org:8080/x": "news.example.org",
+		"not a url":                      "unknown",
+		"://bad":                         "unknown",
+	}
+	for referrer, want := range tests {
+		if got := referrerDomain(referrer); got != want {
+			t.Errorf("referrerDomain(%q) = %q, want %q", referrer, got, want)
+		}
+	}
+}
+
+func TestStatsReferrerDomains(t *testing.T) {
+	resetStore(t)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "ref"})
+	for _, referrer := range []string{"https://t.example/a", "https://t.example/b", ""} {
+		r := request("GET", "/ref", "")
+		r.Header.Set("Referer", referrer)
+		wantStatus(t, serve(r), http.StatusFound)
+	}
+
+	rec := do("GET", "/shorturls/ref", "")
+	wantStatus(t, rec, http.StatusOK)
+	var stats URLStats
+	decode(t, rec, &stats)
+	if stats.ClicksByReferrerDomain["t.example"] != 2 || stats.ClicksByReferrerDomain["direct"] != 1 {
+		t.Errorf("clicksByReferrerDomain = %v", stats.ClicksByReferrerDomain)
+	}
+}
+
+func TestTimeToFirstClick(t *testing.T) {
+	resetStore(t)
+	set(t, &rollupInterval, 0)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "ttfc"})
+	// Backdate the link so the clicks below are all in the past
+	storeLock.Lock()
+	url := urlStore["ttfc"]
+	url.CreatedAt = time.Now().Add(-2 * time.Hour)
+	urlStore["ttfc"] = url
+	storeLock.Unlock()
+
+	rec := do("GET", "/shorturls/ttfc", "")
+	if !strings.Contains(rec.Body.String(), `"timeToFirstClick":null`) {
+		t.Errorf("no clicks gives %s, want null", rec.Body)
+	}
+
+	first := url.CreatedAt.Add(90 * time.Second)
+	recordRedirect("ttfc", &Click{Timestamp: first}, false, first)
+	recordRedirect("ttfc", &Click{Timestamp: first.Add(time.Hour)}, false, first.Add(time.Hour))
+	stats, _ := GetStats("ttfc", clickPage{})
+	if stats.TimeToFirstClick == nil || *stats.TimeToFirstClick != 90 {
+		t.Fatalf("timeToFirstClick = %v, want 90", stats.TimeToFirstClick)
+	}
+
+	// The first click is remembered after its details are pruned
+	pruneClicksBefore(first.Add(time.Minute))
+	if stats, _ := GetStats("ttfc", clickPage{}); stats.TimeToFirstClick == nil || *stats.TimeToFirstClick != 90 {
+		t.Errorf("after pruning timeToFirstClick = %v, want 90", stats.TimeToFirstClick)
+	}
+
+	// An imported click from before the first redirect takes over
+	set(t, &adminEnabled, true)
+	earlier := url.CreatedAt.Add(30 * time.Second).UTC().Format(time.RFC3339Nano)
+	wantStatus(t, do("POST", "/shorturls/ttfc/clicks/import", `[{"timestamp": "`+earlier+`"}]`), http.StatusOK)
+	if stats, _ := GetStats("ttfc", clickPage{}); stats.TimeToFirstClick == nil || *stats.TimeToFirstClick != 30 {
+		t.Errorf("with an earlier import timeToFirstClick = %v, want 30", stats.TimeToFirstClick)
+	}
+}
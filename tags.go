@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+type TagStats struct {
+	Tag            string            `json:"tag"`
+	URLs           int               `json:"urls"`
+	TotalClicks    int               `json:"totalClicks"`
+	UniqueVisitors int               `json:"uniqueVisitors"`
+	TimeSeries     []DailyClickCount `json:"timeSeries"`
+}
+
+type DailyClickCount struct {
+	Date   string `json:"date"`
+	Clicks int    `json:"clicks"`
+}
+
+// hasTag reports whether url carries tag, ignoring case
+func hasTag(url ShortURL, tag string) bool {
+	for _, t := range url.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// getTagStats aggregates clicks across every URL carrying a tag. Visitors are
+// counted by IP address and the time series is bucketed by UTC day.
+func getTagStats(w http.ResponseWriter, r *http.Request) {
+	tag := mux.Vars(r)["tag"]
+	stats := TagStats{Tag: tag, TimeSeries: []DailyClickCount{}}
+	visitors := make(map[string]bool)
+	daily := make(map[string]int)
+
+	storeLock.RLock()
+	for code, url := range urlStore {
+		if !hasTag(url, tag) {
+			continue
+		}
+		stats.URLs++
+		stats.TotalClicks += clickTotal(code)
+		for _, click := range analytics[code].Slice() {
+			visitors[click.IPAddress] = true
+			daily[click.Timestamp.UTC().Format("2006-01-02")]++
+		}
+	}
+	storeLock.RUnlock()
+
+	stats.UniqueVisitors = len(visitors)
+	for date, clicks := range daily {
+		stats.TimeSeries = append(stats.TimeSeries, DailyClickCount{Date: date, Clicks: clicks})
+	}
+	sort.Slice(stats.TimeSeries, func(i, j int) bool {
+		return stats.TimeSeries[i].Date < stats.TimeSeries[j].Date
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	newJSONEncoder(w, r).Encode(stats)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestTagStats(t *testing.T) {
+	resetStore(t)
+	set(t, &adminEnabled, true)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com/a", Shortcode: "a", Tags: []string{"Spring", "email"}})
+	mustCreate(t, ShortURLRequest{URL: "https://example.com/b", Shortcode: "b", Tags: []string{"spring"}})
+	mustCreate(t, ShortURLRequest{URL: "https://example.com/c", Shortcode: "c", Tags: []string{"autumn"}})
+	for code, clicks := range map[string]string{
+		"a": `[{"timestamp": "2024-05-01T12:00:00Z", "ipAddress": "192.0.2.1"}, {"timestamp": "2024-05-02T12:00:00Z", "ipAddress": "192.0.2.2"}]`,
+		"b": `[{"timestamp": "2024-05-02T12:00:00Z", "ipAddress": "192.0.2.1"}]`,
+		"c": `[{"timestamp": "2024-05-02T12:00:00Z", "ipAddress": "192.0.2.9"}]`,
+	} {
+		wantStatus(t, do("POST", "/shorturls/"+code+"/clicks/import", clicks), http.StatusOK)
+	}
+
+	rec := do("GET", "/stats/tag/SPRING", "")
+	wantStatus(t, rec, http.StatusOK)
+	var stats TagStats
+	decode(t, rec, &stats)
+	if stats.URLs != 2 || stats.TotalClicks != 3 || stats.UniqueVisitors != 2 {
+		t.Errorf("stats = %+v, want 2 URLs, 3 clicks, 2 visitors", stats)
+	}
+	want := []DailyClickCount{{"2024-05-01", 1}, {"2024-05-02", 2}}
+	if len(stats.TimeSeries) != 2 || stats.TimeSeries[0] != want[0] || stats.TimeSeries[1] != want[1] {
+		t.Errorf("timeSeries = %v, want %v", stats.TimeSeries, want)
+	}
+
+	rec = do("GET", "/stats/tag/none", "")
+	decode(t, rec, &stats)
+	if stats.URLs != 0 || stats.TimeSeries == nil {
+		t.Errorf("unknown tag: %+v", stats)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// apiKeyTenants maps API keys to the tenant prefix of the codes they create,
+// populated from API_KEYS entries of the form key:prefix
+var apiKeyTenants map[string]string
+
+// parseAPIKeys parses API_KEYS entries. Prefixes must be alphanumeric so a
+// tenant's codes can never be mistaken for another's.
+func parseAPIKeys(entries []string) (map[string]string, error) {
+	tenants := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		key, prefix, ok := strings.Cut(entry, ":")
+		if !ok || key == "" || prefix == "" {
+			return nil, fmt.Errorf("entry %q is not of the form key:prefix", entry)
+		}
+		for _, c := range prefix {
+			if !strings.ContainsRune(base62Alphabet, c) {
+				return nil, fmt.Errorf("prefix %q must be alphanumeric", prefix)
+			}
+		}
+		tenants[key] = prefix
+	}
+	return tenants, nil
+}
+
+// requestTenant returns the tenant prefix for the request's X-API-Key, or ""
+// when it sends none. ok is false for keys that are not configured.
+func requestTenant(r *http.Request) (tenant string, ok bool) {
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		return "", true
+	}
+	for candidate, prefix := range apiKeyTenants {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(candidate)) == 1 {
+			tenant, ok = prefix, true
+		}
+	}
+	return tenant, ok
+}
+
+// inOtherNamespace reports whether code starts with the prefix of a tenant
+// other than tenant, so that only that tenant may hold it
+func inOtherNamespace(code, tenant string) bool {
+	for _, prefix := range apiKeyTenants {
+		if prefix != tenant && strings.HasPrefix(code, codePrefix(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// codePrefix is what a tenant's codes start with, e.g. "t1-"
+func codePrefix(tenant string) string {
+	if tenant == "" {
+		return ""
+	}
+	return tenant + "-"
+}
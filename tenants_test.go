@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// createAs creates a link with body, sending apiKey when it is set
+func createAs(t *testing.T, apiKey, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := request("POST", "/shorturls", body)
+	if apiKey != "" {
+		r.Header.Set("X-API-Key", apiKey)
+	}
+	return serve(r)
+}
+
+// createdCode returns the shortcode of a successful creation response
+func createdCode(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	wantStatus(t, rec, http.StatusCreated)
+	var response ShortURLResponse
+	decode(t, rec, &response)
+	return response.ShortLink[strings.LastIndex(response.ShortLink, "/")+1:]
+}
+
+func useTenants(t *testing.T) {
+	t.Helper()
+	tenants, err := parseAPIKeys([]string{"key-one:t1", "key-two:t2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	set(t, &apiKeyTenants, tenants)
+}
+
+func TestParseAPIKeys(t *testing.T) {
+	tenants, err := parseAPIKeys([]string{"abc:t1", "def:T2"})
+	if err != nil || tenants["abc"] != "t1" || tenants["def"] != "T2" {
+		t.Errorf("parseAPIKeys = %v, %v", tenants, err)
+	}
+	for _, entry := range []string{"abc", "abc:", ":t1", "abc:t-1", "abc:t_1"} {
+		if _, err := parseAPIKeys([]string{entry}); err == nil {
+			t.Errorf("entry %q accepted", entry)
+		}
+	}
+}
+
+func TestTenantPrefixedCodes(t *testing.T) {
+	resetStore(t)
+	useTenants(t)
+
+	one := createdCode(t, createAs(t, "key-one", `{"url": "https://example.com/one"}`))
+	two := createdCode(t, createAs(t, "key-two", `{"url": "https://example.com/two"}`))
+	anon := createdCode(t, createAs(t, "", `{"url": "https://example.com/anon"}`))
+	if !strings.HasPrefix(one, "t1-") || !strings.HasPrefix(two, "t2-") || strings.Contains(anon, "-") {
+		t.Errorf("codes = %q, %q, %q", one, two, anon)
+	}
+
+	// The same custom code lands in each tenant's own namespace
+	promoOne := createdCode(t, createAs(t, "key-one", `{"url": "https://example.com/one", "shortcode": "promo"}`))
+	promoTwo := createdCode(t, createAs(t, "key-two", `{"url": "https://example.com/two", "shortcode": "promo"}`))
+	if promoOne != "t1-promo" || promoTwo != "t2-promo" {
+		t.Errorf("custom codes = %q, %q", promoOne, promoTwo)
+	}
+	for code, want := range map[string]string{"t1-promo": "https://example.com/one", "t2-promo": "https://example.com/two"} {
+		rec := do("GET", "/"+code, "")
+		if rec.Code != http.StatusFound || rec.Header().Get("Location") != want {
+			t.Errorf("/%s: %d to %s, want %s", code, rec.Code, rec.Header().Get("Location"), want)
+		}
+	}
+
+	wantStatus(t, createAs(t, "wrong-key", `{"url": "https://example.com"}`), http.StatusUnauthorized)
+}
+
+func TestTenantNamespaceIsolation(t *testing.T) {
+	resetStore(t)
+	useTenants(t)
+
+	// Neither another tenant nor an anonymous client may squat on t2's codes
+	wantStatus(t, createAs(t, "key-one", `{"url": "https://example.com", "shortcode": "t2-promo"}`), http.StatusCreated)
+	if _, err := Resolve("t2-promo"); err != ErrNotFound {
+		t.Error("t1 created a code in t2's namespace")
+	}
+	wantStatus(t, createAs(t, "", `{"url": "https://example.com", "shortcode": "t2-promo"}`), http.StatusBadRequest)
+	if got := createdCode(t, createAs(t, "key-two", `{"url": "https://example.com", "shortcode": "promo"}`)); got != "t2-promo" {
+		t.Errorf("t2 got %q, want its own t2-promo", got)
+	}
+
+	tests := []struct {
+		apiKey, code string
+		want         AvailabilityResponse
+	}{
+		{"", "t2-sale", AvailabilityResponse{Shortcode: "t2-sale", Reason: "other tenant"}},
+		{"key-one", "sale", AvailabilityResponse{Shortcode: "t1-sale", Available: true}},
+		{"key-two", "promo", AvailabilityResponse{Shortcode: "t2-promo", Reason: "in use"}},
+	}
+	for _, tt := range tests {
+		r := request("GET", "/shorturls/"+tt.code+"/available", "")
+		if tt.apiKey != "" {
+			r.Header.Set("X-API-Key", tt.apiKey)
+		}
+		var got AvailabilityResponse
+		decode(t, serve(r), &got)
+		if got != tt.want {
+			t.Errorf("%q asking for %s: %+v, want %+v", tt.apiKey, tt.code, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// upsert posts body to the upsert endpoint, returning the status and
+// shortcode of the response
+func upsert(t *testing.T, body string) (int, string) {
+	t.Helper()
+	rec := do("POST", "/shorturls/upsert", body)
+	if rec.Code != http.StatusOK && rec.Code != http.StatusCreated {
+		return rec.Code, ""
+	}
+	var response ShortURLResponse
+	decode(t, rec, &response)
+	return rec.Code, response.ShortLink[strings.LastIndex(response.ShortLink, "/")+1:]
+}
+
+func TestUpsertReturnsExistingLink(t *testing.T) {
+	resetStore(t)
+	status, code := upsert(t, `{"url": "https://example.com/page"}`)
+	if status != http.StatusCreated {
+		t.Fatalf("first upsert status = %d, want 201", status)
+	}
+	// Equivalent spellings of the URL find the same link
+	for _, url := range []string{"https://example.com/page", "https://Example.COM:443/page", "https://example.com/page#top"} {
+		if status, again := upsert(t, `{"url": "`+url+`"}`); status != http.StatusOK || again != code {
+			t.Errorf("upsert %s = %d %q, want 200 %q", url, status, again, code)
+		}
+	}
+	if status, other := upsert(t, `{"url": "https://example.com/other"}`); status != http.StatusCreated || other == code {
+		t.Errorf("upsert of another URL = %d %q", status, other)
+	}
+	if len(urlStore) != 2 {
+		t.Errorf("%d links stored, want 2", len(urlStore))
+	}
+}
+
+func TestUpsertCustomCode(t *testing.T) {
+	resetStore(t)
+	if status, code := upsert(t, `{"url": "https://example.com", "shortcode": "mine"}`); status != http.StatusCreated || code != "mine" {
+		t.Fatalf("upsert = %d %q, want 201 mine", status, code)
+	}
+	if status, code := upsert(t, `{"url": "https://example.com", "shortcode": "mine"}`); status != http.StatusOK || code != "mine" {
+		t.Errorf("repeat upsert = %d %q, want 200 mine", status, code)
+	}
+	// The URL already has a link, so no second code is claimed for it
+	if status, code := upsert(t, `{"url": "https://example.com", "shortcode": "another"}`); status != http.StatusOK || code != "mine" {
+		t.Errorf("upsert under another code = %d %q, want 200 mine", status, code)
+	}
+	// A code taken by a different URL is still refused
+	if status, _ := upsert(t, `{"url": "https://example.org", "shortcode": "mine"}`); status != http.StatusConflict {
+		t.Errorf("upsert onto a taken code = %d, want 409", status)
+	}
+}
+
+func TestUpsertSkipsDeadLinks(t *testing.T) {
+	resetStore(t)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "expired"})
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "off"})
+	expireLink(t, "expired")
+	editLink(t, "off", func(url *ShortURL) { url.IsActive = false })
+
+	status, code := upsert(t, `{"url": "https://example.com"}`)
+	if status != http.StatusCreated || code == "expired" || code == "off" {
+		t.Errorf("upsert = %d %q, want a new link", status, code)
+	}
+	wantStatus(t, do("POST", "/shorturls/upsert", `{"url": "https://example.com", "signed": true}`), http.StatusBadRequest)
+	wantStatus(t, do("POST", "/shorturls/upsert", `{`), http.StatusBadRequest)
+}
+
+func TestUpsertConcurrent(t *testing.T) {
+	resetStore(t)
+	const clients = 32
+	var wg sync.WaitGroup
+	statuses := make([]int, clients)
+	codes := make([]string, clients)
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			statuses[i], codes[i] = upsert(t, `{"url": "https://example.com/race"}`)
+		}(i)
+	}
+	wg.Wait()
+
+	created := 0
+	for i := range codes {
+		if statuses[i] == http.StatusCreated {
+			created++
+		}
+		if codes[i] != codes[0] {
+			t.Errorf("client %d got %q, client 0 got %q", i, codes[i], codes[0])
+		}
+	}
+	if created != 1 {
+		t.Errorf("%d upserts created a link, want 1", created)
+	}
+	storeLock.RLock()
+	defer storeLock.RUnlock()
+	if len(urlStore) != 1 {
+		t.Errorf("%d links stored, want 1", len(urlStore))
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import "strings"
+
+// osFamily names the operating system in a user agent: Windows, macOS, iOS,
+// Android or Linux, and Other for anything else. Mobile systems are checked
+// first since their user agents also mention the desktop ones, as in
+// "iPhone; CPU iPhone OS 17_0 like Mac OS X" or "Linux; Android 14".
+func osFamily(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	switch {
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipad"), strings.Contains(ua, "ipod"):
+		return "iOS"
+	case strings.Contains(ua, "android"):
+		return "Android"
+	case strings.Contains(ua, "windows"):
+		return "Windows"
+	case strings.Contains(ua, "macintosh"), strings.Contains(ua, "mac os x"):
+		return "macOS"
+	case strings.Contains(ua, "; cros "):
+		// ChromeOS names Linux in some builds but is reported on its own
+		return "Other"
+	case strings.Contains(ua, "linux"):
+		return "Linux"
+	}
+	return "Other"
+}
+
+// clicksByOS counts clicks per operating system family
+func clicksByOS(clicks []Click) map[string]int {
+	counts := make(map[string]int)
+	for _, click := range clicks {
+		counts[osFamily(click.UserAgent)]++
+	}
+	return counts
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestOSFamily(t *testing.T) {
+	tests := map[string]string{
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/126.0 Safari/537.36":        "Windows",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 14_5) AppleWebKit/605.1.15 Version/17.5 Safari/605.1.15": "macOS",
+		iphoneUserAgent: "iOS",
+		"Mozilla/5.0 (iPad; CPU OS 17_5 like Mac OS X) AppleWebKit/605.1.15 Mobile/15E148": "iOS",
+		androidUserAgent: "Android",
+		browserUserAgent: "Linux",
+		"Mozilla/5.0 (X11; CrOS x86_64 14541.0.0) AppleWebKit/537.36 Chrome/126.0 Safari/537.36": "Other",
+		"curl/8.5.0": "Other",
+		"":           "Other",
+	}
+	for userAgent, want := range tests {
+		if got := osFamily(userAgent); got != want {
+			t.Errorf("osFamily(%q) = %s, want %s", userAgent, got, want)
+		}
+	}
+}
+
+func TestClicksByOS(t *testing.T) {
+	resetStore(t)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com", Shortcode: "os"})
+	for _, userAgent := range []string{iphoneUserAgent, androidUserAgent, iphoneUserAgent, browserUserAgent, "Opera/9.80 (J2ME/MIDP)"} {
+		r := request("GET", "/os", "")
+		r.Header.Set("User-Agent", userAgent)
+		wantStatus(t, serve(r), http.StatusFound)
+	}
+
+	stats, _ := GetStats("os", clickPage{})
+	want := map[string]int{"iOS": 2, "Android": 1, "Linux": 1, "Other": 1}
+	if len(stats.ClicksByOS) != len(want) {
+		t.Fatalf("clicksByOS = %v, want %v", stats.ClicksByOS, want)
+	}
+	for os, n := range want {
+		if stats.ClicksByOS[os] != n {
+			t.Errorf("clicksByOS = %v, want %v", stats.ClicksByOS, want)
+			break
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+)
+
+// parseUTM returns the utm_* query parameters of destination, keyed by name
+func parseUTM(destination string) map[string]string {
+	u, err := url.Parse(destination)
+	if err != nil {
+		return nil
+	}
+	var utm map[string]string
+	for key, values := range u.Query() {
+		if !strings.HasPrefix(key, "utm_") || len(values) == 0 || values[0] == "" {
+			continue
+		}
+		if utm == nil {
+			utm = make(map[string]string)
+		}
+		utm[key] = values[0]
+	}
+	return utm
+}
+
+// UTMBreakdown counts clicks per utm_source and utm_campaign of the
+// destination they were sent to
+type UTMBreakdown struct {
+	Source   map[string]int `json:"source"`
+	Campaign map[string]int `json:"campaign"`
+}
+
+func newUTMBreakdown() UTMBreakdown {
+	return UTMBreakdown{Source: make(map[string]int), Campaign: make(map[string]int)}
+}
+
+// add counts the total clicks on url into b, attributing those with details
+// by destination. Destinations are parsed once each, since most clicks share
+// one.
+func (b UTMBreakdown) add(url ShortURL, clicks []Click, total int) {
+	count := func(utm map[string]string, n int) {
+		if source := utm["utm_source"]; source != "" {
+			b.Source[source] += n
+		}
+		if campaign := utm["utm_campaign"]; campaign != "" {
+			b.Campaign[campaign] += n
+		}
+	}
+
+	parsed := map[string]map[string]string{url.OriginalURL: url.UTM}
+	for _, click := range clicks {
+		dest := click.Destination
+		if dest == "" {
+			dest = url.OriginalURL
+		}
+		utm, ok := parsed[dest]
+		if !ok {
+			utm = parseUTM(dest)
+			parsed[dest] = utm
+		}
+		count(utm, 1)
+	}
+	// Clicks without details have no destination recorded, so they are
+	// credited to the link's own parameters
+	count(url.UTM, max(total-len(clicks), 0))
+}
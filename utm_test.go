@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseUTM(t *testing.T) {
+	utm := parseUTM("https://example.com/?utm_source=news&utm_campaign=spring&utm_medium=&ref=x")
+	if len(utm) != 2 || utm["utm_source"] != "news" || utm["utm_campaign"] != "spring" {
+		t.Errorf("parseUTM = %v", utm)
+	}
+	if utm := parseUTM("https://example.com/?ref=x"); utm != nil {
+		t.Errorf("untagged URL gives %v", utm)
+	}
+}
+
+func TestUTMAttribution(t *testing.T) {
+	resetStore(t)
+	url := mustCreate(t, ShortURLRequest{URL: "https://example.com/?utm_source=news&utm_campaign=spring", Shortcode: "utm"})
+	if url.UTM["utm_source"] != "news" {
+		t.Fatalf("stored UTM = %v", url.UTM)
+	}
+	recordRedirect("utm", &Click{Timestamp: time.Now()}, false, time.Now())
+	recordRedirect("utm", &Click{Timestamp: time.Now()}, false, time.Now())
+	// Sampled-out clicks are credited to the link's own parameters
+	recordRedirect("utm", nil, false, time.Now())
+
+	stats, _ := GetStats("utm", clickPage{})
+	if stats.UTM.Source["news"] != 3 || stats.UTM.Campaign["spring"] != 3 {
+		t.Errorf("utm = %+v, want 3 clicks for news/spring", stats.UTM)
+	}
+}
+
+func TestUTMAttributionByDestination(t *testing.T) {
+	resetStore(t)
+	wantStatus(t, do("POST", "/shorturls", `{"shortcode": "grp", "urls": [
+		"https://example.com/?utm_source=mail", "https://example.com/?utm_source=social&utm_campaign=launch"]}`), http.StatusCreated)
+	for i := 0; i < 20; i++ {
+		wantStatus(t, do("GET", "/grp", ""), http.StatusFound)
+	}
+	mustCreate(t, ShortURLRequest{URL: "https://example.org/?utm_source=mail", Shortcode: "other"})
+	recordRedirect("other", &Click{Timestamp: time.Now()}, false, time.Now())
+
+	stats, _ := GetStats("grp", clickPage{limit: 100})
+	mail, social := stats.UTM.Source["mail"], stats.UTM.Source["social"]
+	if mail+social != 20 || social != stats.ClicksByDestination["https://example.com/?utm_source=social&utm_campaign=launch"] {
+		t.Errorf("utm = %+v, destinations = %v", stats.UTM, stats.ClicksByDestination)
+	}
+	if stats.UTM.Campaign["launch"] != social {
+		t.Errorf("launch campaign = %d, want %d", stats.UTM.Campaign["launch"], social)
+	}
+
+	// The summary adds up every link
+	var summary SummaryStats
+	decode(t, do("GET", "/stats/summary", ""), &summary)
+	if summary.UTM.Source["mail"] != mail+1 || summary.UTM.Source["social"] != social {
+		t.Errorf("summary utm = %+v", summary.UTM)
+	}
+}
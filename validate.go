@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// Self-reference settings, populated from the environment in main
+var (
+	// configuredBaseURL is the public base URL from BASE_URL, without a
+	// trailing slash. When empty, the request's Host is used instead.
+	configuredBaseURL string
+	// selfURLPattern optionally matches further destinations that point back
+	// at this service, e.g. alternate domains
+	selfURLPattern *regexp.Regexp
+	// resolveNestedLinks makes creation follow destinations that are our own
+	// short links instead of rejecting them as self-referencing
+	resolveNestedLinks bool
+)
+
+// rejectedSchemes run code, read local files or embed content in the browser
+// instead of linking to a web page. checkScheme names them in its error.
+var rejectedSchemes = map[string]bool{
+	"javascript": true, "data": true, "file": true, "vbscript": true,
+	"blob": true, "about": true, "filesystem": true, "view-source": true,
+}
+
+// checkScheme is the one check every destination goes through: it must be an
+// absolute http:// or https:// URL with a host. Everything else, dangerous
+// schemes above all, is rejected with a ValidationError.
+func checkScheme(dest string) error {
+	u, err := url.Parse(dest)
+	if err == nil && rejectedSchemes[strings.ToLower(u.Scheme)] {
+		return invalid(fmt.Sprintf("URL scheme %s: is not allowed", strings.ToLower(u.Scheme)))
+	}
+	if err != nil || !strings.HasPrefix(dest, "http://") && !strings.HasPrefix(dest, "https://") {
+		return invalid("URL must start with http:// or https://")
+	}
+	if u.Hostname() == "" {
+		return invalid("URL must include a host")
+	}
+	return nil
+}
+
+// checkStoredSchemes runs checkScheme over every destination of url
+func checkStoredSchemes(url ShortURL) error {
+	dests := []string{url.OriginalURL}
+	for _, dest := range url.Destinations {
+		dests = append(dests, dest.URL)
+	}
+	for _, rule := range url.UserAgentRules {
+		dests = append(dests, rule.URL)
+	}
+	for _, dest := range url.CountryRules {
+		dests = append(dests, dest)
+	}
+	for _, dest := range dests {
+		if err := checkScheme(dest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// defaultScheme is prepended to destinations pasted without one, such as
+// "example.com/page", from DEFAULT_URL_SCHEME. When empty they are rejected.
+var defaultScheme string
+
+// schemelessHost matches the host part of a schemeless destination: dotted
+// hostname labels ending in a top-level domain, with an optional port
+var schemelessHost = regexp.MustCompile(`^([a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?\.)+[a-zA-Z]{2,}(:[0-9]{1,5})?$`)
+
+// withDefaultScheme prepends defaultScheme to dest when it has no scheme but
+// starts with something that looks like a host, and returns dest unchanged
+// otherwise
+func withDefaultScheme(dest string) string {
+	if defaultScheme == "" || strings.Contains(dest, "://") {
+		return dest
+	}
+	host := dest
+	if i := strings.IndexAny(dest, "/?#"); i >= 0 {
+		host = dest[:i]
+	}
+	if !schemelessHost.MatchString(host) {
+		return dest
+	}
+	return defaultScheme + "://" + dest
+}
+
+// blockedShortenerDomains holds the other URL shorteners whose links may not
+// be shortened again, since chains hide the real destination. Subdomains are
+// blocked too. It is atomic so SIGHUP can replace the list.
+var blockedShortenerDomains atomic.Pointer[[]string]
+
+// defaultBlockedShortenerDomains applies unless BLOCKED_SHORTENER_DOMAINS is set
+var defaultBlockedShortenerDomains = []string{
+	"bit.ly", "t.co", "tinyurl.com", "goo.gl", "ow.ly", "is.gd", "buff.ly",
+	"rebrand.ly", "cutt.ly", "shorturl.at", "tiny.cc", "rb.gy", "t.ly", "lnkd.in",
+}
+
+// isBlockedShortener reports whether dest is hosted by a blocked shortener
+func isBlockedShortener(dest string) bool {
+	u, err := url.Parse(dest)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	domains := blockedShortenerDomains.Load()
+	if domains == nil {
+		return false
+	}
+	for _, domain := range *domains {
+		domain = strings.ToLower(domain)
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSelfReferencing reports whether dest points back at this service, which
+// would create a redirect loop
+func isSelfReferencing(dest, requestHost string) bool {
+	u, err := url.Parse(dest)
+	if err != nil {
+		return false
+	}
+	if selfURLPattern != nil && selfURLPattern.MatchString(dest) {
+		return true
+	}
+	return isOwnHost(u, requestHost)
+}
+
+// isOwnHost reports whether u is served by this service, judged by BASE_URL
+// when set and the request's Host otherwise
+func isOwnHost(u *url.URL, requestHost string) bool {
+	selfHost := requestHost
+	selfScheme := "http"
+	if configuredBaseURL != "" {
+		if base, err := url.Parse(configuredBaseURL); err == nil {
+			selfHost, selfScheme = base.Host, base.Scheme
+		}
+	}
+	if selfHost == "" {
+		return false
+	}
+	return strings.EqualFold(normalizeHost(u.Scheme, u.Host), normalizeHost(selfScheme, selfHost))
+}
+
+// resolveNested follows dest when it is one of our own short links, returning
+// the stored destination it points at. Other URLs are returned unchanged.
+func resolveNested(dest, requestHost string) string {
+	u, err := url.Parse(dest)
+	if err != nil || !isOwnHost(u, requestHost) {
+		return dest
+	}
+	code, ok := strings.CutPrefix(u.Path, routePrefix+"/")
+	if !ok || code == "" || strings.Contains(code, "/") {
+		return dest
+	}
+
+	storeLock.RLock()
+	target, exists := urlStore[code]
+	storeLock.RUnlock()
+	if !exists {
+		return dest
+	}
+	return target.OriginalURL
+}
+
+// normalizeURL canonicalizes a destination for comparison: scheme and host
+// are lowercased, default ports and fragments dropped and an empty path
+// treated as "/"
+func normalizeURL(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return raw
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(normalizeHost(u.Scheme, u.Host))
+	u.Fragment = ""
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	return u.String()
+}
+
+// normalizeHost strips the default port for the scheme so that
+// example.com and example.com:80 compare equal
+func normalizeHost(scheme, host string) string {
+	switch {
+	case scheme == "http" && strings.HasSuffix(host, ":80"):
+		return strings.TrimSuffix(host, ":80")
+	case scheme == "https" && strings.HasSuffix(host, ":443"):
+		return strings.TrimSuffix(host, ":443")
+	}
+	return host
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestIsSelfReferencing(t *testing.T) {
+	set(t, &configuredBaseURL, "")
+	set(t, &selfURLPattern, regexp.MustCompile(`^https://mirror\.test/`))
+	tests := []struct {
+		dest string
+		want bool
+	}{
+		{"http://" + testHost + "/abc", true},
+		{"http://SHORT.test:80/abc", true},
+		{"https://mirror.test/abc", true},
+		{"https://" + testHost + ":443/abc", true},
+		{"https://cdn." + testHost + "/abc", false},
+		{"https://example.com", false},
+	}
+	for _, tt := range tests {
+		if got := isSelfReferencing(tt.dest, testHost); got != tt.want {
+			t.Errorf("isSelfReferencing(%q) = %v, want %v", tt.dest, got, tt.want)
+		}
+	}
+
+	set(t, &configuredBaseURL, "https://sho.rt")
+	if !isSelfReferencing("https://sho.rt/abc", testHost) {
+		t.Error("link to BASE_URL not detected")
+	}
+}
+
+func TestCreateRejectsRedirectLoops(t *testing.T) {
+	resetStore(t)
+	for _, req := range []ShortURLRequest{
+		{URL: "http://" + testHost + "/abc"},
+		{URLs: []string{"https://example.com", "http://" + testHost + "/abc"}},
+		{URL: "https://example.com", UserAgentRules: []UserAgentRule{{Pattern: "iPhone", URL: "http://" + testHost + "/x"}}},
+	} {
+		_, _, err := CreateURL(req, testHost)
+		var validation *ValidationError
+		if !errors.As(err, &validation) {
+			t.Errorf("CreateURL(%+v): err = %v, want a ValidationError", req, err)
+		}
+	}
+}
+
+func TestResolveNestedLinks(t *testing.T) {
+	resetStore(t)
+	set(t, &resolveNestedLinks, true)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com/deep", Shortcode: "inner"})
+
+	outer := mustCreate(t, ShortURLRequest{URL: "http://" + testHost + "/inner"})
+	if outer.OriginalURL != "https://example.com/deep" {
+		t.Errorf("OriginalURL = %q, want the nested link's destination", outer.OriginalURL)
+	}
+	// A link to a code that does not exist still loops back at us
+	if _, _, err := CreateURL(ShortURLRequest{URL: "http://" + testHost + "/nope"}, testHost); err == nil {
+		t.Error("link to an unknown own code was accepted")
+	}
+}
+
+func TestResolveNested(t *testing.T) {
+	resetStore(t)
+	set(t, &routePrefix, "/go")
+	set(t, &configuredBaseURL, "https://sho.rt")
+	mustCreate(t, ShortURLRequest{URL: "https://example.com/deep", Shortcode: "inner"})
+
+	tests := map[string]string{
+		"https://sho.rt/go/inner":     "https://example.com/deep",
+		"https://sho.rt/inner":        "https://sho.rt/inner",
+		"https://sho.rt/go/inner/x":   "https://sho.rt/go/inner/x",
+		"https://sho.rt/go/unknown":   "https://sho.rt/go/unknown",
+		"https://example.com/go/x":    "https://example.com/go/x",
+		"http://" + testHost + "/go/": "http://" + testHost + "/go/",
+	}
+	for dest, want := range tests {
+		if got := resolveNested(dest, testHost); got != want {
+			t.Errorf("resolveNested(%q) = %q, want %q", dest, got, want)
+		}
+	}
+}
+
+func TestCreateResolvesNestedLinkGroups(t *testing.T) {
+	resetStore(t)
+	set(t, &resolveNestedLinks, true)
+	mustCreate(t, ShortURLRequest{URL: "https://example.com/deep", Shortcode: "inner"})
+
+	rec := do("POST", "/shorturls", `{"urls": ["https://example.org", "http://`+testHost+`/inner"], "shortcode": "grp"}`)
+	wantStatus(t, rec, http.StatusCreated)
+	url, _ := Resolve("grp")
+	if len(url.Destinations) != 2 || url.Destinations[1].URL != "https://example.com/deep" {
+		t.Errorf("destinations = %+v", url.Destinations)
+	}
+}
+
+func TestRejectsShortenerDestinations(t *testing.T) {
+	resetStore(t)
+	for _, dest := range []string{"https://bit.ly/abc", "https://BIT.LY/abc", "http://www.tinyurl.com/x", "https://t.co/x"} {
+		rec := do("POST", "/shorturls", `{"url": "`+dest+`"}`)
+		wantStatus(t, rec, http.StatusBadRequest)
+	}
+	for _, dest := range []string{"https://example.com/bit.ly", "https://notbit.ly/abc", "https://t.com/x"} {
+		wantStatus(t, do("POST", "/shorturls", `{"url": "`+dest+`"}`), http.StatusCreated)
+	}
+	// Link groups may not hide a shortener among their destinations either
+	wantStatus(t, do("POST", "/shorturls", `{"urls": ["https://example.com", "https://ow.ly/x"]}`), http.StatusBadRequest)
+}
+
+func TestBlockedShortenerList(t *testing.T) {
+	if got := blockedShortenerList(nil); len(got) != len(defaultBlockedShortenerDomains) {
+		t.Errorf("unset list gives %v, want the defaults", got)
+	}
+	if got := blockedShortenerList([]string{"none"}); got != nil {
+		t.Errorf("none gives %v", got)
+	}
+
+	old := blockedShortenerDomains.Load()
+	t.Cleanup(func() { blockedShortenerDomains.Store(old) })
+	custom := blockedShortenerList([]string{"sho.rt"})
+	blockedShortenerDomains.Store(&custom)
+	if !isBlockedShortener("https://go.sho.rt/x") || isBlockedShortener("https://bit.ly/x") {
+		t.Error("custom list not applied in place of the defaults")
+	}
+	blockedShortenerDomains.Store(nil)
+	if isBlockedShortener("https://bit.ly/x") {
+		t.Error("nothing blocked, but bit.ly rejected")
+	}
+}
+
+func TestWithDefaultScheme(t *testing.T) {
+	if got := withDefaultScheme("example.com"); got != "example.com" {
+		t.Errorf("without DEFAULT_URL_SCHEME, example.com became %q", got)
+	}
+
+	set(t, &defaultScheme, "https")
+	tests := map[string]string{
+		"example.com":                "https://example.com",
+		"www.example.co.uk/page?q=1": "https://www.example.co.uk/page?q=1",
+		"example.com:8443#top":       "https://example.com:8443#top",
+		"http://example.com":         "http://example.com",
+		"ftp://example.com":          "ftp://example.com",
+		"localhost/admin":            "localhost/admin",
+		"example":                    "example",
+		"javascript:alert(1)":        "javascript:alert(1)",
+		"-bad-.example.com":          "-bad-.example.com",
+		"/relative/path":             "/relative/path",
+		"user@example.com":           "user@example.com",
+	}
+	for dest, want := range tests {
+		if got := withDefaultScheme(dest); got != want {
+			t.Errorf("withDefaultScheme(%q) = %q, want %q", dest, got, want)
+		}
+	}
+}
+
+func TestCreateWithDefaultScheme(t *testing.T) {
+	resetStore(t)
+	wantStatus(t, do("POST", "/shorturls", `{"url": "example.com", "shortcode": "strict"}`), http.StatusBadRequest)
+
+	set(t, &defaultScheme, "https")
+	wantStatus(t, do("POST", "/shorturls", `{"url": "example.com", "shortcode": "lenient"}`), http.StatusCreated)
+	if url, _ := Resolve("lenient"); url.OriginalURL != "https://example.com" {
+		t.Errorf("stored %q, want https://example.com", url.OriginalURL)
+	}
+	wantStatus(t, do("POST", "/shorturls", `{"url": "not a host"}`), http.StatusBadRequest)
+}
+
+var dangerousURLs = []string{
+	"javascript:alert(1)",
+	"JavaScript:alert(document.cookie)",
+	"data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==",
+	"file:///etc/passwd",
+	"vbscript:msgbox(1)",
+	"blob:https://example.com/550e8400-e29b-41d4-a716-446655440000",
+	"about:blank",
+	"filesystem:https://example.com/temporary/x",
+	"view-source:https://example.com",
+}
+
+func TestCheckScheme(t *testing.T) {
+	for _, dest := range dangerousURLs {
+		var validation *ValidationError
+		err := checkScheme(dest)
+		if !errors.As(err, &validation) || !strings.Contains(err.Error(), "is not allowed") {
+			t.Errorf("checkScheme(%q) = %v, want the scheme refused by name", dest, err)
+		}
+	}
+	for _, dest := range []string{"ftp://example.com", "mailto:me@example.com", "//example.com", "example.com", "http://"} {
+		if err := checkScheme(dest); err == nil {
+			t.Errorf("checkScheme(%q) accepted", dest)
+		}
+	}
+	for _, dest := range []string{"http://example.com", "https://example.com:8443/a?b=c#d"} {
+		if err := checkScheme(dest); err != nil {
+			t.Errorf("checkScheme(%q) = %v", dest, err)
+		}
+	}
+}
+
+func TestCreateRejectsDangerousSchemes(t *testing.T) {
+	resetStore(t)
+	set(t, &adminEnabled, true)
+	// Even with a default scheme to fill in, these are never taken as hosts
+	set(t, &defaultScheme, "https")
+	for _, dest := range dangerousURLs {
+		quoted, _ := json.Marshal(dest)
+		bodies := map[string]string{
+			"url":          `{"url": ` + string(quoted) + `}`,
+			"link group":   `{"urls": ["https://example.com", ` + string(quoted) + `]}`,
+			"agent rule":   `{"url": "https://example.com", "userAgentRules": [{"pattern": "iPhone", "url": ` + string(quoted) + `}]}`,
+			"country rule": `{"url": "https://example.com", "countryRules": {"GB": ` + string(quoted) + `}}`,
+		}
+		for name, body := range bodies {
+			if rec := do("POST", "/shorturls", body); rec.Code != http.StatusBadRequest {
+				t.Errorf("%s %s: status %d, want 400", name, dest, rec.Code)
+			}
+		}
+		wantStatus(t, do("POST", "/shorturls/upsert", `{"url": `+string(quoted)+`}`), http.StatusBadRequest)
+		wantStatus(t, do("POST", "/admin/import", `{"urls": [{"shortCode": "x", "originalUrl": "https://example.com", "destinations": [{"url": `+string(quoted)+`, "weight": 1}]}]}`), http.StatusBadRequest)
+	}
+	if len(urlStore) != 0 {
+		t.Errorf("%d links stored", len(urlStore))
+	}
+}